@@ -0,0 +1,311 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"vimail/internal/auth"
+	"vimail/internal/config"
+	"vimail/internal/email"
+
+	"github.com/charmbracelet/x/term"
+	"golang.org/x/oauth2"
+)
+
+var accountCmd = &Command{
+	Name:  "account",
+	Usage: "account list | add NAME [--backend " + strings.Join(config.Backends, "|") + "] [--login auto|browser|device|manual] [--credentials FILE | --service-account KEYFILE --subject ADDRESS] | remove NAME | default NAME",
+	Short: "Manage the mail accounts vimail connects to",
+}
+
+func init() {
+	accountCmd.Run = runAccount
+	register(accountCmd)
+}
+
+func runAccount(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return usageError(accountCmd)
+	}
+
+	// Adding the first account creates the configuration
+	cfg := config.NewConfig()
+	if config.Exists() {
+		var err error
+		cfg, err = config.Load()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Only listing works without unlocking the credentials
+	if args[0] != "list" {
+		if err := UnlockConfig(cfg); err != nil {
+			return err
+		}
+	}
+
+	switch args[0] {
+	case "list":
+		if len(cfg.Accounts) == 0 {
+			fmt.Println("No accounts configured, add one with: vimail account add NAME")
+			return nil
+		}
+		defaultName := cfg.DefaultAccountName()
+		for _, account := range cfg.Accounts {
+			marker := " "
+			if account.Name == defaultName {
+				marker = "*"
+			}
+			fmt.Printf("%s %-16s %-8s %s\n", marker, account.Name, account.Backend, account.UserEmail)
+		}
+		return nil
+
+	case "add":
+		opts, err := parseSetupFlags(accountCmd, args[1:])
+		if err != nil {
+			return err
+		}
+		if opts.Name == "" {
+			return usageError(accountCmd)
+		}
+		account, err := SetupAccount(ctx, cfg, opts)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Added account %s (%s)\n", account.Name, account.UserEmail)
+		return nil
+
+	case "remove":
+		if len(args) != 2 {
+			return usageError(accountCmd)
+		}
+		if err := cfg.RemoveAccount(args[1]); err != nil {
+			return err
+		}
+		if err := cfg.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Removed account %s\n", args[1])
+		return nil
+
+	case "default":
+		if len(args) != 2 {
+			return usageError(accountCmd)
+		}
+		if err := cfg.SetDefault(args[1]); err != nil {
+			return err
+		}
+		if err := cfg.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Default account is now %s\n", args[1])
+		return nil
+	}
+
+	return usageError(accountCmd)
+}
+
+// parseSetupFlags reads the flags shared by `account add` and `setup`,
+// plus at most one NAME argument
+func parseSetupFlags(c *Command, args []string) (SetupOptions, error) {
+	var opts SetupOptions
+	var login, credentials, keyFile, subject string
+	for i := 0; i < len(args); i++ {
+		flag, value, hasValue := strings.Cut(args[i], "=")
+		if !hasValue && strings.HasPrefix(flag, "--") && i+1 < len(args) {
+			i++
+			value, hasValue = args[i], true
+		}
+		switch {
+		case flag == "--backend" && hasValue:
+			opts.Backend = value
+		case flag == "--login" && hasValue:
+			login = value
+		case flag == "--credentials" && hasValue:
+			credentials = value
+		case flag == "--service-account" && hasValue:
+			keyFile = value
+		case flag == "--subject" && hasValue:
+			subject = value
+		case flag == "--name" && hasValue:
+			opts.Name = value
+		case opts.Name == "" && !strings.HasPrefix(args[i], "-"):
+			opts.Name = args[i]
+		default:
+			return opts, usageError(c)
+		}
+	}
+
+	var err error
+	if opts.Login, err = auth.ParseMode(login); err != nil {
+		return opts, err
+	}
+	if credentials != "" {
+		if opts.Credentials, err = auth.LoadClientFile(credentials); err != nil {
+			return opts, err
+		}
+	}
+	if keyFile != "" || subject != "" {
+		if keyFile == "" || subject == "" || credentials != "" {
+			return opts, fmt.Errorf("a service account needs --service-account KEYFILE and --subject ADDRESS, without --credentials")
+		}
+		// Check the key now rather than after the account is named
+		if _, err := auth.LoadServiceAccount(keyFile, subject); err != nil {
+			return opts, err
+		}
+		if keyFile, err = filepath.Abs(keyFile); err != nil {
+			return opts, err
+		}
+		opts.ServiceAccount = &config.ServiceAccountConfig{KeyFile: keyFile, Subject: subject}
+	}
+	return opts, nil
+}
+
+// SetupOptions controls how SetupAccount adds an account
+type SetupOptions struct {
+	// Name of the account; empty names it after its address
+	Name    string
+	Backend string
+	Login   auth.Mode
+	// Credentials imported from a credentials.json; asked for when nil
+	Credentials *auth.ClientFile
+	// ServiceAccount logs in with domain-wide delegation instead of OAuth
+	ServiceAccount *config.ServiceAccountConfig
+}
+
+// SetupAccount authenticates with the service account or OAuth client
+// from opts, or an OAuth client the user types in, and adds the
+// resulting account to cfg, saving it
+func SetupAccount(ctx context.Context, cfg *config.Config, opts SetupOptions) (*config.Account, error) {
+	name := opts.Name
+	placeholder := name
+	if placeholder == "" {
+		placeholder = "default"
+	}
+	account, err := config.NewAccount(placeholder, opts.Backend)
+	if err != nil {
+		return nil, err
+	}
+	if name != "" {
+		if _, err := cfg.Account(name); err == nil {
+			return nil, fmt.Errorf("account %q already exists", name)
+		}
+	}
+
+	var source oauth2.TokenSource
+	if opts.ServiceAccount != nil {
+		fmt.Printf("🔐 Logging in as %s with a service account...\n", opts.ServiceAccount.Subject)
+		if source, err = ServiceAccountSource(ctx, opts.ServiceAccount); err != nil {
+			return nil, err
+		}
+		account.ServiceAccount = opts.ServiceAccount
+	} else {
+		if account.OAuth, err = authorizeClient(ctx, opts); err != nil {
+			return nil, err
+		}
+		source = auth.NewTokenSource(ctx, account.OAuth.ClientID, account.OAuth.ClientSecret, account.OAuth.Token, nil)
+	}
+
+	// Test the connection
+	fmt.Println("🧪 Testing Gmail API connection...")
+	emailClient, err := email.NewClient(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create email client: %w", err)
+	}
+
+	if err := emailClient.TestConnection(ctx); err != nil {
+		return nil, fmt.Errorf("Gmail API connection test failed: %w", err)
+	}
+
+	account.UserEmail = emailClient.GetUserEmail()
+	if name == "" {
+		account.Name = config.SuggestAccountName(account.UserEmail)
+	}
+
+	if err := cfg.AddAccount(account); err != nil {
+		return nil, err
+	}
+	if err := cfg.Save(); err != nil {
+		return nil, fmt.Errorf("failed to save configuration: %w", err)
+	}
+
+	return account, nil
+}
+
+// authorizeClient runs the OAuth flow with the client from opts, or one
+// the user types in
+func authorizeClient(ctx context.Context, opts SetupOptions) (config.OAuthConfig, error) {
+	client := opts.Credentials
+	if client == nil {
+		var err error
+		if client, err = promptClient(); err != nil {
+			return config.OAuthConfig{}, err
+		}
+	}
+
+	fmt.Println()
+	fmt.Println("🔐 Starting OAuth authentication...")
+
+	// Perform OAuth flow
+	oauthFlow := auth.NewOAuthFlow(client.ClientID, client.ClientSecret)
+	oauthFlow.SetRedirectURIs(client.RedirectURIs)
+	if opts.Credentials != nil {
+		oauthFlow.SetEndpoint(client.Endpoint())
+	}
+	token, err := oauthFlow.AuthenticateWith(ctx, opts.Login)
+	if err != nil {
+		return config.OAuthConfig{}, fmt.Errorf("OAuth authentication failed: %w", err)
+	}
+
+	fmt.Println("✅ Authentication successful!")
+
+	return config.OAuthConfig{
+		ClientID:     client.ClientID,
+		ClientSecret: client.ClientSecret,
+		RedirectURIs: client.RedirectURIs,
+		Token:        token,
+	}, nil
+}
+
+// promptClient asks for the OAuth client ID and secret. The secret is
+// read without echo, and mistyped credentials may be entered again.
+func promptClient() (*auth.ClientFile, error) {
+	fmt.Println("To use this email client, you need to create a Google OAuth application.")
+	fmt.Println("Visit: https://console.developers.google.com/")
+	fmt.Println("1. Create a new project or select existing")
+	fmt.Println("2. Enable Gmail API")
+	fmt.Println("3. Create OAuth 2.0 credentials (Desktop application)")
+	fmt.Println("4. Download the credentials and enter them below,")
+	fmt.Println("   or import the file with: vimail setup --credentials credentials.json")
+	fmt.Println()
+
+	input := bufio.NewReader(os.Stdin)
+	for attempt := 1; ; attempt++ {
+		fmt.Print("Enter Client ID: ")
+		clientID, err := input.ReadString('\n')
+		if err != nil && clientID == "" {
+			return nil, fmt.Errorf("failed to read client ID: %w", err)
+		}
+
+		fmt.Print("Enter Client Secret: ")
+		secret, err := term.ReadPassword(os.Stdin.Fd())
+		fmt.Println()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client secret: %w", err)
+		}
+
+		clientID, clientSecret := strings.TrimSpace(clientID), strings.TrimSpace(string(secret))
+		err = auth.ValidateCredentials(clientID, clientSecret)
+		if err == nil {
+			return &auth.ClientFile{ClientID: clientID, ClientSecret: clientSecret}, nil
+		}
+		if attempt == passphraseAttempts {
+			return nil, err
+		}
+		fmt.Printf("%v, try again.\n", err)
+	}
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"vimail/internal/config"
+	"vimail/internal/contacts"
+	"vimail/internal/email"
+)
+
+var contactsCmd = &Command{
+	Name:  "contacts",
+	Usage: "contacts list | import FILE.vcf | add EMAIL [NAME] | remove EMAIL | group NAME [EMAIL...] | ungroup NAME",
+	Short: "Manage the address book",
+}
+
+func init() {
+	contactsCmd.Run = runContacts
+	register(contactsCmd)
+}
+
+func runContacts(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return usageError(contactsCmd)
+	}
+
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return err
+	}
+
+	store, err := contacts.OpenDefault(dataDir)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		for _, contact := range store.Contacts() {
+			fmt.Printf("%-40s sent %d, seen %d\n", contact.Address(), contact.TimesSent, contact.TimesSeen)
+		}
+		for name, members := range store.Groups() {
+			fmt.Printf("%-40s group: %s\n", name, strings.Join(members, ", "))
+		}
+		return nil
+
+	case "import":
+		if len(args) != 2 {
+			return usageError(contactsCmd)
+		}
+
+		file, err := os.Open(args[1])
+		if err != nil {
+			return fmt.Errorf("failed to open vCard file: %w", err)
+		}
+		defer file.Close()
+
+		imported, err := contacts.ParseVCards(file)
+		if err != nil {
+			return err
+		}
+		for _, contact := range imported {
+			store.Add(contact.Name, contact.Email)
+		}
+		fmt.Printf("Imported %d contacts\n", len(imported))
+
+	case "add":
+		if len(args) < 2 {
+			return usageError(contactsCmd)
+		}
+		if err := email.ValidateEmailAddress(args[1]); err != nil {
+			return err
+		}
+		store.Add(strings.Join(args[2:], " "), args[1])
+
+	case "remove":
+		if len(args) != 2 {
+			return usageError(contactsCmd)
+		}
+		if !store.Remove(args[1]) {
+			return fmt.Errorf("no contact with address %s", args[1])
+		}
+
+	case "group":
+		if len(args) < 2 {
+			return usageError(contactsCmd)
+		}
+		if len(args) == 2 {
+			members, ok := store.ExpandGroup(args[1])
+			if !ok {
+				return fmt.Errorf("no group named %s", args[1])
+			}
+			fmt.Println(members)
+			return nil
+		}
+		for _, member := range args[2:] {
+			if err := email.ValidateEmailAddress(member); err != nil {
+				return err
+			}
+		}
+		store.SetGroup(args[1], args[2:])
+
+	case "ungroup":
+		if len(args) != 2 {
+			return usageError(contactsCmd)
+		}
+		if !store.RemoveGroup(args[1]) {
+			return fmt.Errorf("no group named %s", args[1])
+		}
+
+	default:
+		return usageError(contactsCmd)
+	}
+
+	return store.Save()
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"vimail/internal/auth"
+	"vimail/internal/config"
+)
+
+// logoutCmd removes the whole account, not only its token: an account
+// without a token would fail to connect on every start
+var logoutCmd = &Command{
+	Name:  "logout",
+	Usage: "logout [NAME | --all]",
+	Short: "Revoke an account's sign-in and remove the account and its secrets from the config, keeping a backup",
+}
+
+func init() {
+	logoutCmd.Run = runLogout
+	register(logoutCmd)
+}
+
+func runLogout(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return usageError(logoutCmd)
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	var accounts []*config.Account
+	switch {
+	case len(args) == 1 && args[0] == "--all":
+		accounts = append(accounts, cfg.Accounts...)
+	case len(args) == 1 && strings.HasPrefix(args[0], "-"):
+		return usageError(logoutCmd)
+	default:
+		name := ""
+		if len(args) == 1 {
+			name = args[0]
+		}
+		account, err := cfg.Account(name)
+		if err != nil {
+			return err
+		}
+		accounts = append(accounts, account)
+	}
+
+	// The backup keeps the account settings, so logging in again only
+	// needs a new token
+	if err := config.BackupConfig(); err != nil {
+		return err
+	}
+
+	for _, account := range accounts {
+		// A service account has no grant to revoke; its key stays valid
+		// until deleted in the Cloud console
+		if account.ServiceAccount == nil {
+			if err := auth.RevokeToken(ctx, account.OAuth.Token); err != nil {
+				fmt.Printf("Warning: %s: %v\n", account.Name, err)
+				fmt.Println("  Remove vimail's access at https://myaccount.google.com/permissions")
+			}
+		}
+		if err := cfg.RemoveAccount(account.Name); err != nil {
+			return err
+		}
+		fmt.Printf("Logged out of %s (%s) and removed the account\n", account.Name, account.UserEmail)
+	}
+
+	// Saving drops the removed accounts' secrets from the store
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save configuration: %w", err)
+	}
+	fmt.Println("The previous configuration was kept as config.json.backup")
+	fmt.Println("Add an account again with: vimail account add NAME")
+	return nil
+}
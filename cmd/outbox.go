@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"vimail/internal/config"
+	"vimail/internal/outbox"
+)
+
+var outboxCmd = &Command{
+	Name:  "outbox",
+	Usage: "outbox list | flush | cancel ID",
+	Short: "Manage scheduled and queued messages; flush sends the ones that are due",
+}
+
+func init() {
+	outboxCmd.Run = runOutbox
+	register(outboxCmd)
+}
+
+func runOutbox(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return usageError(outboxCmd)
+	}
+
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return err
+	}
+	store := outbox.OpenDefault(dataDir)
+
+	switch args[0] {
+	case "list":
+		messages, err := store.List()
+		if err != nil {
+			return err
+		}
+		for _, msg := range messages {
+			fmt.Printf("%s  %s  %-12s %-30s %s\n", msg.ID, msg.SendAt.Format("2006-01-02 15:04"), msg.Account, msg.Data.To, msg.Data.Subject)
+			switch {
+			case msg.Failed:
+				fmt.Printf("    failed, edit it in vimail: %s\n", msg.LastError)
+			case msg.Retrying():
+				fmt.Printf("    attempt %d failed, next retry %s: %s\n", msg.Attempts, msg.NextAttempt.Format("2006-01-02 15:04:05"), msg.LastError)
+			}
+		}
+		return nil
+
+	case "flush":
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+		security := LoadSecurity(cfg)
+		if err := store.AssignAccount(cfg.DefaultAccountName()); err != nil {
+			return err
+		}
+
+		var results []outbox.Result
+		unreachable := 0
+		for _, account := range cfg.Accounts {
+			client, _, err := ConnectAccount(ctx, cfg, account)
+			if err != nil {
+				unreachable++
+				fmt.Printf("Skipping %v\n", err)
+				continue
+			}
+			client.SetSecurity(security)
+
+			sent, err := store.Flush(ctx, account.Name, client, time.Now())
+			results = append(results, sent...)
+			if err != nil {
+				return err
+			}
+		}
+
+		failed := 0
+		for _, result := range results {
+			if result.Error != nil {
+				failed++
+				fmt.Printf("Failed to send %q to %s: %v\n", result.Message.Data.Subject, result.Message.Data.To, result.Error)
+				if !result.Permanent() {
+					fmt.Printf("    will retry after %s\n", result.Message.NextAttempt.Format("15:04:05"))
+				}
+				continue
+			}
+			fmt.Printf("Sent %q to %s\n", result.Message.Data.Subject, result.Message.Data.To)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d message(s) could not be sent and stay in the outbox", failed)
+		}
+		if unreachable > 0 {
+			return fmt.Errorf("%d account(s) could not be reached", unreachable)
+		}
+		return nil
+
+	case "cancel":
+		if len(args) != 2 {
+			return usageError(outboxCmd)
+		}
+		found, err := store.Remove(args[1])
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("no scheduled message with ID %s", args[1])
+		}
+		fmt.Printf("Cancelled %s\n", args[1])
+		return nil
+	}
+
+	return usageError(outboxCmd)
+}
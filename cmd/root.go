@@ -1,28 +1,45 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"os"
+	"sort"
 )
 
-// This file is optional for the MVP
-// We keep the main logic in main.go for simplicity
-// This could be used later for more complex CLI commands
+// Command is a vimail subcommand such as "vimail contacts import"
+type Command struct {
+	Name  string
+	Usage string
+	Short string
+	Run   func(ctx context.Context, args []string) error
+}
 
-// Execute is the main entry point for the cobra CLI
-// Currently unused but kept for future expansion
-func Execute() {
-	fmt.Println("Veloci Mail - Terminal Email Client")
-	fmt.Println("Run 'go run .' from the project root to start the application")
-	os.Exit(0)
+var commands = map[string]*Command{}
+
+// register adds a subcommand; called from the init of each command file
+func register(c *Command) {
+	commands[c.Name] = c
 }
 
-// RootCmd would be used if we implement cobra CLI
-// For MVP, we keep it simple with direct main.go execution
-var RootCmd = struct {
-	Use   string
-	Short string
-}{
-	Use:   "vimail",
-	Short: "A fast terminal email client",
+// Lookup returns the subcommand with the given name
+func Lookup(name string) (*Command, bool) {
+	c, ok := commands[name]
+	return c, ok
+}
+
+// Commands returns every subcommand sorted by name
+func Commands() []*Command {
+	list := make([]*Command, 0, len(commands))
+	for _, c := range commands {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// usageError reports a command invoked with the wrong arguments
+func usageError(c *Command) error {
+	return fmt.Errorf("usage: vimail %s", c.Usage)
 }
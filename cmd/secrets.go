@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"vimail/internal/config"
+	"vimail/internal/secrets"
+
+	"github.com/charmbracelet/x/term"
+)
+
+var secretsCmd = &Command{
+	Name:  "secrets",
+	Usage: "secrets agent [--ttl DURATION] | lock | passwd",
+	Short: "Run the passphrase agent, forget cached keys or change the passphrase",
+}
+
+func init() {
+	secretsCmd.Run = runSecrets
+	register(secretsCmd)
+}
+
+// passphraseAttempts is how often a mistyped passphrase may be retried
+const passphraseAttempts = 3
+
+func runSecrets(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return usageError(secretsCmd)
+	}
+
+	switch args[0] {
+	case "agent":
+		ttl := secrets.DefaultAgentTTL
+		switch {
+		case len(args) == 3 && args[1] == "--ttl":
+			var err error
+			if ttl, err = time.ParseDuration(args[2]); err != nil {
+				return fmt.Errorf("invalid TTL %q: %w", args[2], err)
+			}
+		case len(args) != 1:
+			return usageError(secretsCmd)
+		}
+
+		ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		path := secrets.AgentSocketPath()
+		fmt.Printf("Caching the secrets key for %s at %s\n", ttl, path)
+		return secrets.NewAgent(ttl).Serve(ctx, path)
+
+	case "lock":
+		if err := secrets.AgentForget(); err != nil {
+			return fmt.Errorf("no agent running: %w", err)
+		}
+		fmt.Println("Agent forgot the secrets key")
+		return nil
+
+	case "passwd":
+		cfg, err := LoadConfig()
+		if err != nil {
+			return err
+		}
+		passphrase, err := readNewPassphrase()
+		if err != nil {
+			return err
+		}
+		if err := cfg.ChangePassphrase(passphrase); err != nil {
+			return err
+		}
+		store := cfg.Secrets()
+		if secrets.CheckAgent() == nil {
+			secrets.AgentStore(store.ID(), store.Key())
+		}
+		fmt.Println("Passphrase changed")
+		return nil
+	}
+
+	return usageError(secretsCmd)
+}
+
+// LoadConfig loads the configuration and unlocks the account
+// credentials
+func LoadConfig() (*config.Config, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if err := UnlockConfig(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// UnlockConfig opens the encrypted secrets store for cfg, creating it on
+// first use. Credentials found in plaintext in the config file are moved
+// into the store.
+func UnlockConfig(cfg *config.Config) error {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return err
+	}
+	store, err := secrets.OpenDefault(configDir)
+	if err != nil {
+		return err
+	}
+
+	plaintext := cfg.HasPlaintextSecrets()
+	if plaintext && !store.Exists() {
+		fmt.Println("🔒 Account credentials will now be stored encrypted.")
+	}
+	if err := unlockSecrets(store); err != nil {
+		return err
+	}
+	cfg.UseSecrets(store)
+
+	if plaintext {
+		if err := cfg.Save(); err != nil {
+			return fmt.Errorf("failed to move credentials into the secrets store: %w", err)
+		}
+		// Replace the backup too, it still holds the plaintext credentials
+		if err := config.BackupConfig(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unlockSecrets unlocks the store with the key cached by the agent, the
+// passphrase in the environment, or one typed at the prompt. A store
+// that doesn't exist yet is created with a new passphrase. The key is
+// only handed to an agent whose socket is the user's own.
+func unlockSecrets(store *secrets.Store) error {
+	if !store.Exists() {
+		passphrase, err := readNewPassphrase()
+		if err != nil {
+			return err
+		}
+		return store.Init(passphrase)
+	}
+
+	agent := secrets.CheckAgent() == nil
+	if agent {
+		if key, ok := secrets.AgentKey(store.ID()); ok {
+			if err := store.UnlockWithKey(key); err == nil {
+				return nil
+			}
+		}
+	}
+
+	if passphrase := os.Getenv(secrets.PassphraseEnv); passphrase != "" {
+		if err := store.Unlock([]byte(passphrase)); err != nil {
+			return fmt.Errorf("%s: %w", secrets.PassphraseEnv, err)
+		}
+		if agent {
+			secrets.AgentStore(store.ID(), store.Key())
+		}
+		return nil
+	}
+
+	for attempt := 1; ; attempt++ {
+		passphrase, err := readPassphrase("Passphrase for stored credentials: ")
+		if err != nil {
+			return err
+		}
+		err = store.Unlock(passphrase)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, secrets.ErrWrongPassphrase) || attempt == passphraseAttempts {
+			return err
+		}
+		fmt.Println("Wrong passphrase, try again.")
+	}
+
+	if agent {
+		secrets.AgentStore(store.ID(), store.Key())
+	}
+	return nil
+}
+
+// readNewPassphrase asks for a new passphrase twice, or takes it from
+// the environment
+func readNewPassphrase() ([]byte, error) {
+	if passphrase := os.Getenv(secrets.PassphraseEnv); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+
+	passphrase, err := readPassphrase("New passphrase for stored credentials: ")
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase must not be empty")
+	}
+	repeated, err := readPassphrase("Repeat passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(passphrase, repeated) {
+		return nil, fmt.Errorf("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+func readPassphrase(prompt string) ([]byte, error) {
+	fmt.Print(prompt)
+	passphrase, err := term.ReadPassword(os.Stdin.Fd())
+	fmt.Println()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return passphrase, nil
+}
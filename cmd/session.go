@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"vimail/internal/auth"
+	"vimail/internal/config"
+	"vimail/internal/email"
+	"vimail/internal/pgp"
+	"vimail/internal/smime"
+
+	"github.com/charmbracelet/x/term"
+	"golang.org/x/oauth2"
+)
+
+// ConnectAccount returns a Gmail client for one account of cfg, along
+// with its token source, which is nil for service accounts. Every
+// refreshed token is saved back to the configuration, as is the
+// account's address. It is shared by the TUI and commands that send
+// mail; callers load the signing and encryption keys once with
+// LoadSecurity.
+func ConnectAccount(ctx context.Context, cfg *config.Config, account *config.Account) (*email.Client, *auth.TokenSource, error) {
+	if account.Backend != config.BackendGmail {
+		return nil, nil, fmt.Errorf("account %s: unsupported backend %q", account.Name, account.Backend)
+	}
+
+	// Service accounts sign a new JWT when needed and have nothing to save
+	var source oauth2.TokenSource
+	var tokens *auth.TokenSource
+	if account.ServiceAccount != nil {
+		var err error
+		if source, err = ServiceAccountSource(ctx, account.ServiceAccount); err != nil {
+			return nil, nil, fmt.Errorf("account %s: %w", account.Name, err)
+		}
+	} else {
+		tokens = auth.NewTokenSource(ctx, account.OAuth.ClientID, account.OAuth.ClientSecret, account.OAuth.Token,
+			func(token *oauth2.Token) error {
+				return cfg.SaveToken(account, token)
+			})
+		source = tokens
+	}
+
+	emailClient, err := email.NewClient(ctx, source)
+	if err != nil {
+		return nil, nil, fmt.Errorf("account %s: failed to create email client: %w", account.Name, err)
+	}
+
+	if err := emailClient.TestConnection(ctx); err != nil {
+		return nil, nil, fmt.Errorf("account %s: gmail API connection failed: %w", account.Name, err)
+	}
+	if tokens != nil {
+		if err := tokens.SaveError(); err != nil {
+			log.Printf("Warning: Failed to save updated token: %v", err)
+		}
+	}
+
+	// Update user email in config
+	if account.UserEmail != emailClient.GetUserEmail() {
+		account.UserEmail = emailClient.GetUserEmail()
+		if err := cfg.Save(); err != nil {
+			log.Printf("Warning: Failed to save user email: %v", err)
+		}
+	}
+
+	return emailClient, tokens, nil
+}
+
+// ServiceAccountSource returns tokens for the user a service account
+// acts as
+func ServiceAccountSource(ctx context.Context, sa *config.ServiceAccountConfig) (oauth2.TokenSource, error) {
+	keyFile, err := sa.KeyFilePath()
+	if err != nil {
+		return nil, err
+	}
+	account, err := auth.LoadServiceAccount(keyFile, sa.Subject)
+	if err != nil {
+		return nil, err
+	}
+	return account.TokenSource(ctx), nil
+}
+
+// Reauthenticate logs in again with the account's stored client
+// credentials after its refresh token was revoked, and saves the new
+// token
+func Reauthenticate(ctx context.Context, cfg *config.Config, account *config.Account, mode auth.Mode) error {
+	fmt.Printf("🔐 The sign-in for account %s (%s) has expired. Logging in again...\n", account.Name, account.UserEmail)
+
+	oauthFlow := auth.NewOAuthFlow(account.OAuth.ClientID, account.OAuth.ClientSecret)
+	oauthFlow.SetRedirectURIs(account.OAuth.RedirectURIs)
+	token, err := oauthFlow.AuthenticateWith(ctx, mode)
+	if err != nil {
+		return fmt.Errorf("account %s: %w", account.Name, err)
+	}
+	return cfg.SaveToken(account, token)
+}
+
+// LoadSecurity loads the OpenPGP keyring and the S/MIME certificates.
+// Either one failing to load only disables that scheme.
+func LoadSecurity(cfg *config.Config) *email.Security {
+	security := &email.Security{}
+
+	keyring, err := loadKeyring(cfg)
+	if err != nil {
+		log.Printf("Warning: Failed to load OpenPGP keyring: %v", err)
+	}
+	security.PGP = keyring
+
+	store, err := loadSMIME(cfg)
+	if err != nil {
+		log.Printf("Warning: Failed to load S/MIME certificates: %v", err)
+	}
+	security.SMIME = store
+
+	return security
+}
+
+// loadSMIME loads the S/MIME CA bundle and our certificate and key
+func loadSMIME(cfg *config.Config) (*smime.Store, error) {
+	caBundle, certificate, key, err := cfg.SMIME.Paths()
+	if err != nil {
+		return nil, err
+	}
+	return smime.LoadStore(caBundle, certificate, key)
+}
+
+// loadKeyring loads the OpenPGP keyring, asking for the passphrase of
+// locked secret keys unless it is set in the environment
+func loadKeyring(cfg *config.Config) (*pgp.Keyring, error) {
+	publicPath, secretPath, err := cfg.PGP.KeyringPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	keyring, err := pgp.LoadKeyring(publicPath, secretPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if keyring.Locked() {
+		passphrase := []byte(os.Getenv(pgp.PassphraseEnv))
+		if len(passphrase) == 0 {
+			fmt.Print("OpenPGP key passphrase: ")
+			passphrase, err = term.ReadPassword(os.Stdin.Fd())
+			fmt.Println()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read passphrase: %w", err)
+			}
+		}
+		if err := keyring.Unlock(passphrase); err != nil {
+			return nil, err
+		}
+	}
+
+	return keyring, nil
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"vimail/internal/config"
+)
+
+var setupCmd = &Command{
+	Name:  "setup",
+	Usage: "setup (--credentials FILE [--login auto|browser|device|manual] | --service-account KEYFILE --subject ADDRESS) [--name NAME]",
+	Short: "Set up an account from a downloaded credentials.json or service account key",
+}
+
+func init() {
+	setupCmd.Run = runSetup
+	register(setupCmd)
+}
+
+func runSetup(ctx context.Context, args []string) error {
+	opts, err := parseSetupFlags(setupCmd, args)
+	if err != nil {
+		return err
+	}
+	if opts.Credentials == nil && opts.ServiceAccount == nil {
+		return usageError(setupCmd)
+	}
+
+	// The first account creates the configuration
+	cfg := config.NewConfig()
+	if config.Exists() {
+		if cfg, err = config.Load(); err != nil {
+			return err
+		}
+	}
+	if err := UnlockConfig(cfg); err != nil {
+		return err
+	}
+
+	if opts.Credentials != nil {
+		fmt.Printf("Using %s client %s\n", opts.Credentials.Type, opts.Credentials.ClientID)
+	}
+	account, err := SetupAccount(ctx, cfg, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ Setup complete! Connected as: %s (account %s)\n", account.UserEmail, account.Name)
+	return nil
+}
@@ -1,8 +1,11 @@
 package auth
 
 import (
+	"encoding/json"
 	"fmt"
 	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"os"
 	"time"
 )
 
@@ -47,3 +50,76 @@ func ValidateCredentials(clientID, clientSecret string) error {
 	}
 	return nil
 }
+
+// ClientFile is an OAuth client as downloaded from the Google Cloud
+// console, in either its "installed" (desktop) or "web" form
+type ClientFile struct {
+	Type         string
+	ClientID     string
+	ClientSecret string
+	AuthURI      string
+	TokenURI     string
+	RedirectURIs []string
+}
+
+type clientFileSection struct {
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	AuthURI      string   `json:"auth_uri"`
+	TokenURI     string   `json:"token_uri"`
+	RedirectURIs []string `json:"redirect_uris"`
+}
+
+// LoadClientFile reads and validates a downloaded credentials.json
+func LoadClientFile(path string) (*ClientFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials file: %w", err)
+	}
+	return ParseClientFile(data)
+}
+
+// ParseClientFile parses and validates the contents of a credentials.json
+func ParseClientFile(data []byte) (*ClientFile, error) {
+	var file struct {
+		Installed *clientFileSection `json:"installed"`
+		Web       *clientFileSection `json:"web"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials file: %w", err)
+	}
+
+	kind, section := "installed", file.Installed
+	if section == nil {
+		kind, section = "web", file.Web
+	}
+	if section == nil {
+		return nil, fmt.Errorf("credentials file has neither an \"installed\" nor a \"web\" client")
+	}
+
+	if err := ValidateCredentials(section.ClientID, section.ClientSecret); err != nil {
+		return nil, err
+	}
+
+	return &ClientFile{
+		Type:         kind,
+		ClientID:     section.ClientID,
+		ClientSecret: section.ClientSecret,
+		AuthURI:      section.AuthURI,
+		TokenURI:     section.TokenURI,
+		RedirectURIs: section.RedirectURIs,
+	}, nil
+}
+
+// Endpoint returns the authorization server named in the file, falling
+// back to Google's for fields it leaves out
+func (f *ClientFile) Endpoint() oauth2.Endpoint {
+	endpoint := google.Endpoint
+	if f.AuthURI != "" {
+		endpoint.AuthURL = f.AuthURI
+	}
+	if f.TokenURI != "" {
+		endpoint.TokenURL = f.TokenURI
+	}
+	return endpoint
+}
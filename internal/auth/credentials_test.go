@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2/google"
+)
+
+func TestParseClientFile(t *testing.T) {
+	const (
+		clientID     = "1234567890-abc.apps.googleusercontent.com"
+		clientSecret = "GOCSPX-secret-value"
+	)
+
+	tests := []struct {
+		name     string
+		data     string
+		wantType string
+		// wantRedirects are the redirect URIs taken from the file
+		wantRedirects []string
+		wantTokenURL  string
+		wantErr       string
+	}{
+		{
+			name: "installed",
+			data: `{"installed": {"client_id": "` + clientID + `", "client_secret": "` + clientSecret + `",
+				"auth_uri": "https://accounts.google.com/o/oauth2/auth", "token_uri": "https://oauth2.googleapis.com/token",
+				"redirect_uris": ["http://localhost"]}}`,
+			wantType:      "installed",
+			wantRedirects: []string{"http://localhost"},
+			wantTokenURL:  "https://oauth2.googleapis.com/token",
+		},
+		{
+			name: "web",
+			data: `{"web": {"client_id": "` + clientID + `", "client_secret": "` + clientSecret + `",
+				"token_uri": "https://tokens.example.com/token",
+				"redirect_uris": ["https://example.com/callback", "http://127.0.0.1:8085/callback"]}}`,
+			wantType:      "web",
+			wantRedirects: []string{"https://example.com/callback", "http://127.0.0.1:8085/callback"},
+			wantTokenURL:  "https://tokens.example.com/token",
+		},
+		{
+			name:         "token endpoint left out",
+			data:         `{"installed": {"client_id": "` + clientID + `", "client_secret": "` + clientSecret + `"}}`,
+			wantType:     "installed",
+			wantTokenURL: google.Endpoint.TokenURL,
+		},
+		{
+			name:    "neither client",
+			data:    `{"service_account": {}}`,
+			wantErr: "neither",
+		},
+		{
+			name:    "short client ID",
+			data:    `{"web": {"client_id": "short", "client_secret": "` + clientSecret + `"}}`,
+			wantErr: "client ID",
+		},
+		{
+			name:    "missing secret",
+			data:    `{"installed": {"client_id": "` + clientID + `"}}`,
+			wantErr: "client secret",
+		},
+		{
+			name:    "not JSON",
+			data:    "client_id=abc",
+			wantErr: "failed to parse",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file, err := ParseClientFile([]byte(test.data))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want one about %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if file.Type != test.wantType || file.ClientID != clientID || file.ClientSecret != clientSecret {
+				t.Errorf("got %s client %q, %q", file.Type, file.ClientID, file.ClientSecret)
+			}
+			if !slices.Equal(file.RedirectURIs, test.wantRedirects) {
+				t.Errorf("got redirect URIs %v, want %v", file.RedirectURIs, test.wantRedirects)
+			}
+			endpoint := file.Endpoint()
+			if endpoint.TokenURL != test.wantTokenURL || endpoint.AuthURL == "" {
+				t.Errorf("got endpoint %+v, want token URL %s", endpoint, test.wantTokenURL)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Mode selects how the user logs in
+type Mode string
+
+const (
+	// ModeAuto picks ModeBrowser when a browser can be opened on this
+	// machine and ModeManual otherwise
+	ModeAuto Mode = "auto"
+	// ModeBrowser opens the browser and waits on a loopback callback
+	ModeBrowser Mode = "browser"
+	// ModeDevice uses the device authorization grant: the user enters a
+	// short code on another device. Google only allows it for clients
+	// of the "TVs and Limited Input devices" type.
+	ModeDevice Mode = "device"
+	// ModeManual prints the login URL and reads back the URL the browser
+	// was redirected to, or just the code in it
+	ModeManual Mode = "manual"
+)
+
+// Modes lists the login modes, for help text and flag validation
+var Modes = []Mode{ModeAuto, ModeBrowser, ModeDevice, ModeManual}
+
+// ParseMode reads a login mode given on the command line
+func ParseMode(text string) (Mode, error) {
+	if text == "" {
+		return ModeAuto, nil
+	}
+	for _, mode := range Modes {
+		if strings.EqualFold(text, string(mode)) {
+			return mode, nil
+		}
+	}
+	names := make([]string, len(Modes))
+	for i, mode := range Modes {
+		names[i] = string(mode)
+	}
+	return "", fmt.Errorf("unknown login mode %q, use %s", text, strings.Join(names, ", "))
+}
+
+// DetectMode resolves ModeAuto for this machine. Over SSH, or without a
+// display on systems that need one, the browser would open on the wrong
+// machine or not at all, and its callback couldn't reach us.
+func DetectMode(mode Mode) Mode {
+	if mode != ModeAuto && mode != "" {
+		return mode
+	}
+	if os.Getenv("SSH_CONNECTION") != "" || os.Getenv("SSH_TTY") != "" {
+		return ModeManual
+	}
+	switch runtime.GOOS {
+	case "windows", "darwin":
+		return ModeBrowser
+	}
+	if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+		return ModeManual
+	}
+	return ModeBrowser
+}
+
+// manualRedirectURI is where the browser is sent in manual mode. Nothing
+// listens there; the user copies the URL from the address bar.
+var manualRedirectURI = "http://" + LoopbackHost + CallbackPath
+
+// SetEndpoint points the flow at another authorization server, such as a
+// local stand-in for testing
+func (o *OAuthFlow) SetEndpoint(endpoint oauth2.Endpoint) {
+	o.config.Endpoint = endpoint
+}
+
+// SetInput changes where manual mode reads the pasted URL from
+func (o *OAuthFlow) SetInput(input io.Reader) {
+	o.input = input
+}
+
+// SetOutput changes where the flow prints the login URL and instructions
+func (o *OAuthFlow) SetOutput(output io.Writer) {
+	o.output = output
+}
+
+// AuthenticateWith logs in using the given mode
+func (o *OAuthFlow) AuthenticateWith(ctx context.Context, mode Mode) (*oauth2.Token, error) {
+	switch DetectMode(mode) {
+	case ModeDevice:
+		return o.authenticateDevice(ctx)
+	case ModeManual:
+		return o.authenticateManual(ctx)
+	default:
+		return o.Authenticate(ctx)
+	}
+}
+
+// authenticateDevice runs the device authorization grant: the user visits
+// a URL on any device and enters the code shown, while we poll for the
+// token
+func (o *OAuthFlow) authenticateDevice(ctx context.Context) (*oauth2.Token, error) {
+	response, err := o.config.DeviceAuth(ctx, oauth2.AccessTypeOffline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start device login: %w", describeRetrieveError(err))
+	}
+
+	verificationURL := response.VerificationURIComplete
+	if verificationURL == "" {
+		verificationURL = response.VerificationURI
+	}
+	fmt.Fprintf(o.output, "On any device, visit:\n  %s\nand enter the code: %s\n\n", verificationURL, response.UserCode)
+	fmt.Fprintln(o.output, "Waiting for you to approve access...")
+
+	if !response.Expiry.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, response.Expiry)
+		defer cancel()
+	}
+
+	token, err := o.config.DeviceAccessToken(ctx, response)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("the device code expired before access was approved")
+		}
+		return nil, describeRetrieveError(err)
+	}
+	return token, nil
+}
+
+// authenticateManual prints the login URL and waits for the user to
+// paste back the URL the browser ended up on, which carries the code
+func (o *OAuthFlow) authenticateManual(ctx context.Context) (*oauth2.Token, error) {
+	if err := o.begin(); err != nil {
+		return nil, err
+	}
+	o.config.RedirectURL = manualRedirectURI
+	if len(o.redirectURIs) > 0 {
+		o.config.RedirectURL = o.redirectURIs[0]
+	}
+
+	authURL := o.authCodeURL()
+
+	fmt.Fprintf(o.output, "Open this URL in a browser on any machine:\n%s\n\n", authURL)
+	fmt.Fprintln(o.output, "After approving access the browser is sent to a page that fails to load.")
+	fmt.Fprintln(o.output, "Copy the whole address of that page and paste it here.")
+
+	lines := make(chan string, 1)
+	errs := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(o.input)
+		fmt.Fprint(o.output, "Redirected URL or code: ")
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			errs <- fmt.Errorf("failed to read the redirected URL: %w", err)
+			return
+		}
+		lines <- line
+	}()
+
+	var pasted string
+	select {
+	case pasted = <-lines:
+	case err := <-errs:
+		return nil, err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(10 * time.Minute):
+		return nil, fmt.Errorf("authentication timeout")
+	}
+
+	code, err := o.parsePasted(pasted)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := o.config.Exchange(ctx, code, oauth2.VerifierOption(o.verifier))
+	if err != nil {
+		return nil, fmt.Errorf("token exchange failed: %w", describeRetrieveError(err))
+	}
+	return token, nil
+}
+
+// parsePasted extracts the authorization code from a pasted redirect URL,
+// checking its state, or accepts a bare code
+func (o *OAuthFlow) parsePasted(pasted string) (string, error) {
+	pasted = strings.TrimSpace(pasted)
+	if pasted == "" {
+		return "", fmt.Errorf("no authorization code received")
+	}
+
+	if !strings.Contains(pasted, "?") && !strings.Contains(pasted, "=") {
+		return pasted, nil
+	}
+
+	query := pasted
+	if parsed, err := url.Parse(pasted); err == nil && parsed.RawQuery != "" {
+		query = parsed.RawQuery
+	}
+	values, err := url.ParseQuery(strings.TrimPrefix(query, "?"))
+	if err != nil {
+		return "", fmt.Errorf("could not read the pasted URL: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(values.Get("state")), []byte(o.state)) != 1 {
+		return "", fmt.Errorf("the pasted URL is from a different login attempt")
+	}
+	if errorCode := values.Get("error"); errorCode != "" {
+		return "", authorizationError(errorCode, values.Get("error_description"))
+	}
+	code := values.Get("code")
+	if code == "" {
+		return "", fmt.Errorf("no authorization code received")
+	}
+	return code, nil
+}
+
+// describeRetrieveError explains errors returned by the token endpoint
+// the same way as errors returned to the redirect URI
+func describeRetrieveError(err error) error {
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) && retrieveErr.ErrorCode != "" {
+		return authorizationError(retrieveErr.ErrorCode, retrieveErr.ErrorDescription)
+	}
+	return err
+}
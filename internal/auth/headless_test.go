@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// deviceServer stands in for Google's device authorization and token
+// endpoints. Each poll of the token endpoint gets the next error in
+// replies, and a token once they run out.
+type deviceServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	replies []string
+	polls   int
+}
+
+func newDeviceServer(t *testing.T, replies ...string) *deviceServer {
+	s := &deviceServer{replies: replies}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"device_code":      "device-123",
+			"user_code":        "ABCD-EFGH",
+			"verification_uri": "https://example.com/device",
+			"expires_in":       60,
+			"interval":         1,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.FormValue("device_code"); got != "device-123" {
+			t.Errorf("token request for device code %q", got)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.polls++
+		if len(s.replies) > 0 {
+			reply := s.replies[0]
+			s.replies = s.replies[1:]
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": reply})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token":  "access",
+			"refresh_token": "refresh",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		})
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *deviceServer) endpoint() oauth2.Endpoint {
+	return oauth2.Endpoint{
+		DeviceAuthURL: s.URL + "/device",
+		TokenURL:      s.URL + "/token",
+		AuthStyle:     oauth2.AuthStyleInParams,
+	}
+}
+
+// pollCount is how often the token endpoint was polled
+func (s *deviceServer) pollCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.polls
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func testFlow(endpoint oauth2.Endpoint) *OAuthFlow {
+	flow := NewOAuthFlow("client-id", "client-secret")
+	flow.SetEndpoint(endpoint)
+	flow.SetOutput(io.Discard)
+	return flow
+}
+
+func TestDeviceLoginWaitsWhilePending(t *testing.T) {
+	t.Parallel()
+	server := newDeviceServer(t, "authorization_pending")
+
+	token, err := testFlow(server.endpoint()).AuthenticateWith(context.Background(), ModeDevice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "access" || token.RefreshToken != "refresh" {
+		t.Errorf("got token %+v", token)
+	}
+	if server.pollCount() != 2 {
+		t.Errorf("token endpoint polled %d times, want 2", server.pollCount())
+	}
+}
+
+func TestDeviceLoginSlowsDown(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for the slowed down polling interval")
+	}
+	t.Parallel()
+	server := newDeviceServer(t, "slow_down")
+
+	token, err := testFlow(server.endpoint()).AuthenticateWith(context.Background(), ModeDevice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "access" || server.pollCount() != 2 {
+		t.Errorf("got token %+v after %d polls", token, server.pollCount())
+	}
+}
+
+func TestDeviceLoginDenied(t *testing.T) {
+	t.Parallel()
+	server := newDeviceServer(t, "authorization_pending", "access_denied")
+
+	_, err := testFlow(server.endpoint()).AuthenticateWith(context.Background(), ModeDevice)
+	if err == nil || !strings.Contains(err.Error(), "access was denied") {
+		t.Fatalf("got error %v, want access denied", err)
+	}
+	if server.pollCount() != 2 {
+		t.Errorf("token endpoint polled %d times after the denial, want 2", server.pollCount())
+	}
+}
+
+func TestParsePasted(t *testing.T) {
+	flow := NewOAuthFlow("client-id", "client-secret")
+	flow.state = "state-123"
+
+	tests := []struct {
+		name    string
+		pasted  string
+		code    string
+		wantErr string
+	}{
+		{
+			name:   "redirect URL",
+			pasted: "http://127.0.0.1:8085/callback?state=state-123&code=4/0AbC-xyz&scope=gmail\n",
+			code:   "4/0AbC-xyz",
+		},
+		{
+			name:   "query only",
+			pasted: "?state=state-123&code=abc",
+			code:   "abc",
+		},
+		{
+			name:   "bare code",
+			pasted: "  4/0AbC-xyz  ",
+			code:   "4/0AbC-xyz",
+		},
+		{
+			name:    "state mismatch",
+			pasted:  "http://127.0.0.1:8085/callback?state=other&code=abc",
+			wantErr: "different login attempt",
+		},
+		{
+			name:    "missing state",
+			pasted:  "http://127.0.0.1:8085/callback?code=abc",
+			wantErr: "different login attempt",
+		},
+		{
+			name:    "denied",
+			pasted:  "http://127.0.0.1:8085/callback?state=state-123&error=access_denied",
+			wantErr: "access was denied",
+		},
+		{
+			name:    "empty",
+			pasted:  "\n",
+			wantErr: "no authorization code",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, err := flow.parsePasted(test.pasted)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got code %q, error %v; want error %q", code, err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code != test.code {
+				t.Errorf("got code %q, want %q", code, test.code)
+			}
+		})
+	}
+}
+
+func TestManualLoginExchangesPastedCode(t *testing.T) {
+	verifiers := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.FormValue("code"); got != "pasted-code" {
+			t.Errorf("exchanged code %q", got)
+		}
+		verifiers <- r.FormValue("code_verifier")
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	defer server.Close()
+
+	flow := testFlow(oauth2.Endpoint{
+		AuthURL:   server.URL + "/auth",
+		TokenURL:  server.URL + "/token",
+		AuthStyle: oauth2.AuthStyleInParams,
+	})
+	flow.SetInput(strings.NewReader("pasted-code\n"))
+
+	token, err := flow.AuthenticateWith(context.Background(), ModeManual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "access" {
+		t.Errorf("got token %+v", token)
+	}
+	if verifier := <-verifiers; verifier == "" || verifier != flow.verifier {
+		t.Errorf("token request carried verifier %q, want the flow's PKCE verifier", verifier)
+	}
+}
@@ -2,10 +2,20 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
+	"sync"
 	"time"
 
 	"golang.org/x/oauth2"
@@ -14,8 +24,11 @@ import (
 )
 
 const (
-	// OAuth 2.0 redirect URI for installed applications
-	RedirectURI = "http://localhost:8080/callback"
+	// The callback server for installed applications listens on the
+	// loopback interface on a port chosen by the OS, which Google allows
+	// for desktop clients
+	LoopbackHost = "127.0.0.1"
+	CallbackPath = "/callback"
 	// OAuth 2.0 scopes required for Gmail access
 	GmailReadScope = gmail.GmailReadonlyScope
 	GmailSendScope = gmail.GmailSendScope
@@ -27,7 +40,21 @@ type OAuthFlow struct {
 	server *http.Server
 	token  *oauth2.Token
 	done   chan struct{}
+	once   sync.Once
 	err    error
+
+	// state ties the callback to this login attempt and verifier is the
+	// PKCE secret the authorization code can only be redeemed with
+	state    string
+	verifier string
+
+	// input is where manual mode reads the pasted redirect URL, and
+	// output is where the flow tells the user what to do
+	input  io.Reader
+	output io.Writer
+
+	// redirectURIs are the ones registered for the client, when known
+	redirectURIs []string
 }
 
 // NewOAuthFlow creates a new OAuth flow with the given client credentials
@@ -35,7 +62,6 @@ func NewOAuthFlow(clientID, clientSecret string) *OAuthFlow {
 	config := &oauth2.Config{
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
-		RedirectURL:  RedirectURI,
 		Scopes: []string{
 			GmailReadScope,
 			GmailSendScope,
@@ -46,27 +72,33 @@ func NewOAuthFlow(clientID, clientSecret string) *OAuthFlow {
 	return &OAuthFlow{
 		config: config,
 		done:   make(chan struct{}),
+		input:  os.Stdin,
+		output: os.Stdout,
 	}
 }
 
 // Authenticate starts the OAuth flow and returns a token
 func (o *OAuthFlow) Authenticate(ctx context.Context) (*oauth2.Token, error) {
-	// Start local server for callback
+	// Generate the state and PKCE verifier before any callback can arrive
+	if err := o.begin(); err != nil {
+		return nil, err
+	}
+
+	// Start local server for callback; the redirect URI depends on its port
 	if err := o.startCallbackServer(); err != nil {
 		return nil, fmt.Errorf("failed to start callback server: %w", err)
 	}
 	defer o.stopCallbackServer()
 
 	// Generate authorization URL
-	state := generateRandomState()
-	authURL := o.config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.SetAuthURLParam("prompt", "consent"))
+	authURL := o.authCodeURL()
 
-	fmt.Printf("Opening browser for authentication...\n")
-	fmt.Printf("If browser doesn't open, visit this URL manually:\n%s\n\n", authURL)
+	fmt.Fprintf(o.output, "Opening browser for authentication...\n")
+	fmt.Fprintf(o.output, "If browser doesn't open, visit this URL manually:\n%s\n\n", authURL)
 
 	// Open browser
 	if err := o.openBrowser(authURL); err != nil {
-		fmt.Printf("Failed to open browser automatically: %v\n", err)
+		fmt.Fprintf(o.output, "Failed to open browser automatically: %v\n", err)
 	}
 
 	// Wait for callback or context cancellation
@@ -83,20 +115,98 @@ func (o *OAuthFlow) Authenticate(ctx context.Context) (*oauth2.Token, error) {
 	}
 }
 
-// startCallbackServer starts the local HTTP server for OAuth callback
+// begin starts a login attempt with a new state and PKCE verifier
+func (o *OAuthFlow) begin() error {
+	state, err := generateRandomState()
+	if err != nil {
+		return err
+	}
+	o.state = state
+	o.verifier = oauth2.GenerateVerifier()
+	return nil
+}
+
+// authCodeURL returns the URL where the user grants access, carrying the
+// state and the PKCE challenge of the current attempt
+func (o *OAuthFlow) authCodeURL() string {
+	return o.config.AuthCodeURL(o.state,
+		oauth2.AccessTypeOffline,
+		oauth2.SetAuthURLParam("prompt", "consent"),
+		oauth2.S256ChallengeOption(o.verifier),
+	)
+}
+
+// SetRedirectURIs restricts the flow to the redirect URIs registered for
+// the client, as listed in its credentials file
+func (o *OAuthFlow) SetRedirectURIs(uris []string) {
+	o.redirectURIs = uris
+}
+
+// loopbackRedirect returns the redirect URI the callback server answers
+// on: the first loopback URI registered for the client, or our default.
+// A URI without a port gets one from the OS, which Google allows for
+// loopback redirects.
+func (o *OAuthFlow) loopbackRedirect() (*url.URL, error) {
+	if len(o.redirectURIs) == 0 {
+		return &url.URL{Scheme: "http", Host: LoopbackHost, Path: CallbackPath}, nil
+	}
+	for _, uri := range o.redirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || u.Scheme != "http" {
+			continue
+		}
+		switch u.Hostname() {
+		case "localhost", "127.0.0.1", "::1":
+			return u, nil
+		}
+	}
+	return nil, fmt.Errorf("none of the client's redirect URIs is a loopback address, log in with --login manual")
+}
+
+// startCallbackServer starts the local HTTP server for OAuth callback on
+// the loopback interface and points the redirect URI at it
 func (o *OAuthFlow) startCallbackServer() error {
+	redirect, err := o.loopbackRedirect()
+	if err != nil {
+		return err
+	}
+
+	// localhost is resolved here so we never listen beyond loopback
+	host := redirect.Hostname()
+	if host == "localhost" {
+		host = LoopbackHost
+	}
+	port := redirect.Port()
+	if port == "" {
+		port = "0"
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return err
+	}
+	if redirect.Port() == "" {
+		port = strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+		redirect.Host = net.JoinHostPort(redirect.Hostname(), port)
+	}
+	path := redirect.Path
+	if path == "" {
+		path = "/"
+	}
+	o.config.RedirectURL = redirect.String()
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("/callback", o.handleCallback)
+	mux.HandleFunc(path, o.handleCallback)
 
 	o.server = &http.Server{
-		Addr:    ":8080",
-		Handler: mux,
+		Addr:              listener.Addr().String(),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
 	}
 
 	go func() {
-		if err := o.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			o.err = err
-			close(o.done)
+		if err := o.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			o.finish(nil, err)
 		}
 	}()
 
@@ -112,28 +222,49 @@ func (o *OAuthFlow) stopCallbackServer() {
 	}
 }
 
+// finish ends the flow with its result; only the first result counts
+func (o *OAuthFlow) finish(token *oauth2.Token, err error) {
+	o.once.Do(func() {
+		o.token, o.err = token, err
+		close(o.done)
+	})
+}
+
 // handleCallback processes the OAuth callback
 func (o *OAuthFlow) handleCallback(w http.ResponseWriter, r *http.Request) {
-	defer close(o.done)
-
 	// Parse query parameters
 	query := r.URL.Query()
+
+	// A callback that doesn't carry our state wasn't started by this
+	// login and is ignored, so a forged link can't complete it
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(o.state)) != 1 {
+		http.Error(w, "Invalid state parameter", http.StatusBadRequest)
+		return
+	}
+
+	if errorCode := query.Get("error"); errorCode != "" {
+		err := authorizationError(errorCode, query.Get("error_description"))
+		o.finish(nil, err)
+		http.Error(w, "Authorization failed: "+err.Error(), http.StatusForbidden)
+		return
+	}
+
 	code := query.Get("code")
 	if code == "" {
-		o.err = fmt.Errorf("no authorization code received")
+		o.finish(nil, fmt.Errorf("no authorization code received"))
 		http.Error(w, "Authorization failed", http.StatusBadRequest)
 		return
 	}
 
 	// Exchange code for token
-	token, err := o.config.Exchange(context.Background(), code)
+	token, err := o.config.Exchange(context.Background(), code, oauth2.VerifierOption(o.verifier))
 	if err != nil {
-		o.err = fmt.Errorf("token exchange failed: %w", err)
+		o.finish(nil, fmt.Errorf("token exchange failed: %w", err))
 		http.Error(w, "Token exchange failed", http.StatusInternalServerError)
 		return
 	}
 
-	o.token = token
+	o.finish(token, nil)
 
 	// Send success response
 	w.Header().Set("Content-Type", "text/html")
@@ -195,9 +326,39 @@ func RefreshTokenIfNeeded(token *oauth2.Token, clientID, clientSecret string) (*
 	return newToken, nil
 }
 
-// generateRandomState generates a random state parameter for OAuth
-func generateRandomState() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
+// authorizationError turns an error returned to the redirect URI into a
+// message the user can act on
+func authorizationError(code, description string) error {
+	var message string
+	switch code {
+	case "access_denied":
+		message = "access was denied; vimail needs you to allow reading and sending mail"
+	case "invalid_scope":
+		message = "the requested Gmail permissions were rejected; check that the Gmail API is enabled for the project"
+	case "invalid_client":
+		message = "the OAuth client ID or secret was rejected"
+	case "expired_token":
+		message = "the login expired before access was approved, try again"
+	case "unauthorized_client":
+		message = "this OAuth client may not use this login; create Desktop application credentials"
+	case "temporarily_unavailable", "server_error":
+		message = "Google's login service is unavailable, try again later"
+	default:
+		message = "authorization failed: " + code
+	}
+	if description != "" {
+		message += " (" + description + ")"
+	}
+	return errors.New(message)
+}
+
+// generateRandomState generates an unguessable state parameter for OAuth
+func generateRandomState() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate OAuth state: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
 }
 
 // ValidateToken checks if a token is valid and not expired
@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestAuthCodeURLChallenge(t *testing.T) {
+	flow := testFlow(oauth2.Endpoint{AuthURL: "https://accounts.example.com/auth"})
+	if err := flow.begin(); err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := url.Parse(flow.authCodeURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := authURL.Query()
+
+	if got := query.Get("state"); got == "" || got != flow.state {
+		t.Errorf("got state %q, want the flow's %q", got, flow.state)
+	}
+	if got := query.Get("code_challenge_method"); got != "S256" {
+		t.Errorf("got challenge method %q, want S256", got)
+	}
+	sum := sha256.Sum256([]byte(flow.verifier))
+	if got, want := query.Get("code_challenge"), base64.RawURLEncoding.EncodeToString(sum[:]); got != want {
+		t.Errorf("got challenge %q, want %q for the verifier", got, want)
+	}
+	if query.Get("code_verifier") != "" {
+		t.Error("verifier sent to the authorization endpoint")
+	}
+
+	// Every attempt gets its own secrets
+	state, verifier := flow.state, flow.verifier
+	if err := flow.begin(); err != nil {
+		t.Fatal(err)
+	}
+	if flow.state == state || flow.verifier == verifier {
+		t.Error("new login attempt reused the state or verifier")
+	}
+}
+
+func TestCallbackServerListensOnLoopback(t *testing.T) {
+	tests := []struct {
+		name         string
+		redirectURIs []string
+		wantHost     string
+		wantPath     string
+		wantErr      bool
+	}{
+		{name: "default", wantHost: "127.0.0.1", wantPath: CallbackPath},
+		{
+			name:         "registered localhost",
+			redirectURIs: []string{"https://example.com/callback", "http://localhost/oauth"},
+			wantHost:     "localhost",
+			wantPath:     "/oauth",
+		},
+		{name: "no loopback registered", redirectURIs: []string{"https://example.com/callback"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flow := testFlow(oauth2.Endpoint{})
+			flow.SetRedirectURIs(test.redirectURIs)
+			err := flow.startCallbackServer()
+			if test.wantErr {
+				if err == nil {
+					flow.stopCallbackServer()
+					t.Fatal("callback server started without a loopback redirect URI")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer flow.stopCallbackServer()
+
+			// localhost could resolve to other addresses, so only
+			// 127.0.0.1 is listened on
+			host, _, err := net.SplitHostPort(flow.server.Addr)
+			if err != nil || host != LoopbackHost {
+				t.Errorf("listening on %q, want %s only", flow.server.Addr, LoopbackHost)
+			}
+
+			redirect, err := url.Parse(flow.config.RedirectURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if redirect.Hostname() != test.wantHost || redirect.Path != test.wantPath {
+				t.Errorf("got redirect URI %s, want host %s and path %s", redirect, test.wantHost, test.wantPath)
+			}
+			if redirect.Port() == "" || redirect.Port() == "0" {
+				t.Errorf("redirect URI %s lacks the listener's port", redirect)
+			}
+		})
+	}
+}
+
+func TestCallbackChecksState(t *testing.T) {
+	verifiers := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.FormValue("code"); got != "callback-code" {
+			t.Errorf("exchanged code %q", got)
+		}
+		verifiers <- r.FormValue("code_verifier")
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	defer server.Close()
+
+	flow := testFlow(oauth2.Endpoint{TokenURL: server.URL + "/token", AuthStyle: oauth2.AuthStyleInParams})
+	if err := flow.begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := flow.startCallbackServer(); err != nil {
+		t.Fatal(err)
+	}
+	defer flow.stopCallbackServer()
+
+	callback := func(query url.Values) int {
+		t.Helper()
+		resp, err := http.Get(flow.config.RedirectURL + "?" + query.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// A forged callback is turned away and leaves the login waiting
+	for _, state := range []string{"", "forged-state"} {
+		query := url.Values{"code": {"attacker-code"}}
+		if state != "" {
+			query.Set("state", state)
+		}
+		if status := callback(query); status != http.StatusBadRequest {
+			t.Errorf("callback with state %q got status %d, want %d", state, status, http.StatusBadRequest)
+		}
+	}
+	select {
+	case <-flow.done:
+		t.Fatalf("forged callback ended the login: %v", flow.err)
+	default:
+	}
+
+	if status := callback(url.Values{"state": {flow.state}, "code": {"callback-code"}}); status != http.StatusOK {
+		t.Fatalf("callback got status %d", status)
+	}
+	<-flow.done
+	if flow.err != nil || flow.token == nil || flow.token.AccessToken != "access" {
+		t.Fatalf("got token %+v, error %v", flow.token, flow.err)
+	}
+	if verifier := <-verifiers; verifier == "" || verifier != flow.verifier {
+		t.Errorf("token request carried verifier %q, want the flow's PKCE verifier", verifier)
+	}
+}
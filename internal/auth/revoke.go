@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// RevokeURL is Google's token revocation endpoint
+var RevokeURL = "https://oauth2.googleapis.com/revoke"
+
+// RevokeToken revokes the grant behind token, so neither its access nor
+// its refresh token work any more. A token Google no longer knows, for
+// example one already revoked from the account settings, counts as
+// revoked.
+func RevokeToken(ctx context.Context, token *oauth2.Token) error {
+	if token == nil {
+		return nil
+	}
+
+	// Revoking the refresh token also revokes the access tokens issued
+	// with it
+	value := token.RefreshToken
+	if value == "" {
+		value = token.AccessToken
+	}
+	if value == "" {
+		return nil
+	}
+
+	form := url.Values{"token": {value}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, RevokeURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the revocation endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	var response struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	json.Unmarshal(body, &response)
+	if response.Error == "invalid_token" {
+		return nil
+	}
+	if response.Error != "" {
+		return fmt.Errorf("token revocation failed: %w", authorizationError(response.Error, response.Description))
+	}
+	return fmt.Errorf("token revocation failed: %s", resp.Status)
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestRevokeToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  *oauth2.Token
+		status int
+		body   string
+		// wantSent is the token the endpoint should get, none when empty
+		wantSent string
+		wantErr  string
+	}{
+		{name: "no token"},
+		{
+			name:     "revokes the refresh token",
+			token:    &oauth2.Token{AccessToken: "access", RefreshToken: "refresh"},
+			status:   http.StatusOK,
+			wantSent: "refresh",
+		},
+		{
+			name:     "access token only",
+			token:    &oauth2.Token{AccessToken: "access"},
+			status:   http.StatusOK,
+			wantSent: "access",
+		},
+		{
+			name:     "already revoked",
+			token:    &oauth2.Token{RefreshToken: "refresh"},
+			status:   http.StatusBadRequest,
+			body:     `{"error": "invalid_token", "error_description": "Token expired or revoked"}`,
+			wantSent: "refresh",
+		},
+		{
+			name:     "server error",
+			token:    &oauth2.Token{RefreshToken: "refresh"},
+			status:   http.StatusInternalServerError,
+			body:     "<html>Internal error</html>",
+			wantSent: "refresh",
+			wantErr:  "500 Internal Server Error",
+		},
+		{
+			name:     "service unavailable",
+			token:    &oauth2.Token{RefreshToken: "refresh"},
+			status:   http.StatusServiceUnavailable,
+			body:     `{"error": "temporarily_unavailable"}`,
+			wantSent: "refresh",
+			wantErr:  "unavailable",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var sent string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost {
+					t.Errorf("got %s request", r.Method)
+				}
+				sent = r.FormValue("token")
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+			defer func(url string) { RevokeURL = url }(RevokeURL)
+			RevokeURL = server.URL
+
+			err := RevokeToken(context.Background(), test.token)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("got error %v, want one about %q", err, test.wantErr)
+				}
+			} else if err != nil {
+				t.Errorf("got error %v", err)
+			}
+			if sent != test.wantSent {
+				t.Errorf("revoked %q, want %q", sent, test.wantSent)
+			}
+		})
+	}
+}
+
+func TestRevokeTokenUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	defer func(url string) { RevokeURL = url }(RevokeURL)
+	RevokeURL = server.URL
+
+	err := RevokeToken(context.Background(), &oauth2.Token{RefreshToken: "refresh"})
+	if err == nil || !strings.Contains(err.Error(), "failed to reach") {
+		t.Errorf("got error %v, want the endpoint to be unreachable", err)
+	}
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"golang.org/x/oauth2/jwt"
+)
+
+// ServiceAccount logs in as a Google Workspace user through a service
+// account with domain-wide delegation. Instead of a browser login, a
+// JWT signed with the service account's key is exchanged for a token
+// that acts as Subject. A Workspace admin must grant the service
+// account's client ID the Gmail scopes in the Admin console.
+type ServiceAccount struct {
+	// Email of the service account, from its key file
+	Email string
+	// Subject is the user whose mailbox is accessed
+	Subject string
+
+	config *jwt.Config
+}
+
+// LoadServiceAccount reads a service account key file as downloaded from
+// the Google Cloud console and prepares to impersonate subject
+func LoadServiceAccount(keyFile, subject string) (*ServiceAccount, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account key: %w", err)
+	}
+	return ParseServiceAccount(data, subject)
+}
+
+// ParseServiceAccount parses the contents of a service account key file.
+// The token endpoint is taken from the file's token_uri.
+func ParseServiceAccount(data []byte, subject string) (*ServiceAccount, error) {
+	if err := ValidateSubject(subject); err != nil {
+		return nil, err
+	}
+
+	var key struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("failed to parse service account key: %w", err)
+	}
+	if key.Type != "service_account" {
+		return nil, fmt.Errorf("not a service account key file (type %q)", key.Type)
+	}
+
+	config, err := google.JWTConfigFromJSON(data, GmailReadScope, GmailSendScope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse service account key: %w", err)
+	}
+	config.Subject = subject
+
+	return &ServiceAccount{Email: config.Email, Subject: subject, config: config}, nil
+}
+
+// ValidateSubject checks the address of the user to impersonate
+func ValidateSubject(subject string) error {
+	if subject == "" {
+		return fmt.Errorf("the address of the user to act as is required")
+	}
+	local, domain, ok := strings.Cut(subject, "@")
+	if !ok || local == "" || domain == "" || strings.ContainsAny(subject, " \t\r\n") {
+		return fmt.Errorf("%q is not an email address", subject)
+	}
+	return nil
+}
+
+// TokenSource returns tokens for the subject. There is no refresh token:
+// a new JWT is signed whenever the access token expires.
+func (s *ServiceAccount) TokenSource(ctx context.Context) oauth2.TokenSource {
+	return oauth2.ReuseTokenSource(nil, &delegationTokenSource{
+		account: s,
+		base:    s.config.TokenSource(ctx),
+	})
+}
+
+// delegationTokenSource explains why the token endpoint refused to let
+// the service account act as the subject
+type delegationTokenSource struct {
+	account *ServiceAccount
+	base    oauth2.TokenSource
+}
+
+func (s *delegationTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.base.Token()
+	if err != nil {
+		return nil, s.account.describeError(err)
+	}
+	return token, nil
+}
+
+func (s *ServiceAccount) describeError(err error) error {
+	var retrieveErr *oauth2.RetrieveError
+	if !errors.As(err, &retrieveErr) {
+		return err
+	}
+
+	// The JWT flow leaves the error response unparsed
+	code, description := retrieveErr.ErrorCode, retrieveErr.ErrorDescription
+	if code == "" {
+		var body struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if json.Unmarshal(retrieveErr.Body, &body) == nil {
+			code, description = body.Error, body.Description
+		}
+	}
+
+	switch code {
+	case "unauthorized_client":
+		return fmt.Errorf("service account %s may not act as %s; a Workspace admin must grant it domain-wide delegation for the Gmail scopes: %w",
+			s.Email, s.Subject, err)
+	case "invalid_grant":
+		return fmt.Errorf("service account %s could not act as %s; check that the user exists and the key is still valid: %w",
+			s.Email, s.Subject, err)
+	}
+	if code != "" {
+		return authorizationError(code, description)
+	}
+	return err
+}
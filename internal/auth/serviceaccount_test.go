@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	testServiceEmail = "mailer@project.iam.gserviceaccount.com"
+	testSubject      = "alice@example.com"
+)
+
+// serviceAccountKey returns a key file for a new RSA key whose token_uri
+// points at tokenURL
+func serviceAccountKey(t *testing.T, tokenURL string) ([]byte, *rsa.PublicKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "project",
+		"private_key_id": "key-1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   testServiceEmail,
+		"client_id":      "1234567890",
+		"token_uri":      tokenURL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, &key.PublicKey
+}
+
+func TestParseServiceAccount(t *testing.T) {
+	key, _ := serviceAccountKey(t, "https://oauth2.googleapis.com/token")
+
+	account, err := ParseServiceAccount(key, testSubject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Email != testServiceEmail || account.Subject != testSubject {
+		t.Errorf("got service account %s acting as %s", account.Email, account.Subject)
+	}
+
+	tests := []struct {
+		name    string
+		data    string
+		subject string
+		wantErr string
+	}{
+		{"not JSON", "not json", testSubject, "failed to parse"},
+		{"user credentials", `{"type": "authorized_user"}`, testSubject, "not a service account key file"},
+		{"client secrets", `{"installed": {"client_id": "x"}}`, testSubject, "not a service account key file"},
+		{"no subject", string(key), "", "user to act as is required"},
+		{"bad subject", string(key), "alice", "not an email address"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseServiceAccount([]byte(test.data), test.subject)
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("got error %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+// decodeAssertion checks the signature of a JWT bearer assertion and
+// returns its claims
+func decodeAssertion(t *testing.T, assertion string, public *rsa.PublicKey) map[string]any {
+	t.Helper()
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		t.Fatalf("assertion has %d parts", len(parts))
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature); err != nil {
+		t.Fatalf("assertion signature: %v", err)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func TestServiceAccountTokenGrant(t *testing.T) {
+	var public *rsa.PublicKey
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.FormValue("grant_type"); got != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			t.Errorf("grant type %q", got)
+		}
+		claims := decodeAssertion(t, r.FormValue("assertion"), public)
+		if claims["iss"] != testServiceEmail || claims["sub"] != testSubject {
+			t.Errorf("assertion issued by %v for %v", claims["iss"], claims["sub"])
+		}
+		if scope, _ := claims["scope"].(string); !strings.Contains(scope, GmailReadScope) || !strings.Contains(scope, GmailSendScope) {
+			t.Errorf("assertion scope %q", scope)
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token": "delegated",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	defer server.Close()
+
+	key, publicKey := serviceAccountKey(t, server.URL)
+	public = publicKey
+	account, err := ParseServiceAccount(key, testSubject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := account.TokenSource(context.Background()).Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "delegated" || token.RefreshToken != "" {
+		t.Errorf("got token %+v", token)
+	}
+}
+
+func TestServiceAccountDelegationErrors(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"unauthorized_client", "may not act as " + testSubject + "; a Workspace admin must grant it domain-wide delegation"},
+		{"invalid_grant", "could not act as " + testSubject + "; check that the user exists"},
+		{"invalid_scope", "the requested Gmail permissions were rejected"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.code, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, http.StatusUnauthorized, map[string]any{
+					"error":             test.code,
+					"error_description": "refused by the stand-in",
+				})
+			}))
+			defer server.Close()
+
+			key, _ := serviceAccountKey(t, server.URL)
+			account, err := ParseServiceAccount(key, testSubject)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = account.TokenSource(context.Background()).Token()
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("got error %v, want %q", err, test.want)
+			}
+			if !strings.Contains(err.Error(), testServiceEmail) && test.code != "invalid_scope" {
+				t.Errorf("error doesn't name the service account: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// ErrReauthRequired is wrapped by errors from a token source whose
+// refresh token was revoked or expired; only logging in again helps
+var ErrReauthRequired = errors.New("sign-in expired or was revoked, log in again")
+
+// SaveFunc stores a token after it was refreshed
+type SaveFunc func(*oauth2.Token) error
+
+// TokenSource refreshes OAuth tokens like the one from oauth2.Config,
+// and hands every new token to a save function so refreshed access
+// tokens and rotated refresh tokens survive a restart
+type TokenSource struct {
+	ctx    context.Context
+	config *oauth2.Config
+	save   SaveFunc
+
+	mu      sync.Mutex
+	base    oauth2.TokenSource
+	last    *oauth2.Token
+	revoked error
+	saveErr error
+}
+
+// NewTokenSource returns a token source for the installed application
+// credentials, starting from token
+func NewTokenSource(ctx context.Context, clientID, clientSecret string, token *oauth2.Token, save SaveFunc) *TokenSource {
+	config := &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Endpoint:     google.Endpoint,
+		Scopes:       []string{GmailReadScope, GmailSendScope},
+	}
+	return &TokenSource{
+		ctx:    ctx,
+		config: config,
+		save:   save,
+		base:   config.TokenSource(ctx, token),
+		last:   token,
+	}
+}
+
+// Token returns a valid token, refreshing and saving it when needed
+func (s *TokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Once revoked, don't ask the server again until Reset
+	if s.revoked != nil {
+		return nil, s.revoked
+	}
+
+	token, err := s.base.Token()
+	if err != nil {
+		if IsRevoked(err) {
+			s.revoked = fmt.Errorf("%w: %w", ErrReauthRequired, err)
+			return nil, s.revoked
+		}
+		return nil, err
+	}
+
+	if s.changed(token) {
+		s.last = token
+		if s.save != nil {
+			// A failed save doesn't fail the request, the token is
+			// still good for this session
+			s.saveErr = s.save(token)
+		}
+	}
+	return token, nil
+}
+
+func (s *TokenSource) changed(token *oauth2.Token) bool {
+	return s.last == nil ||
+		token.AccessToken != s.last.AccessToken ||
+		token.RefreshToken != s.last.RefreshToken
+}
+
+// Reset starts over from a token obtained by logging in again, and
+// saves it
+func (s *TokenSource) Reset(token *oauth2.Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.base = s.config.TokenSource(s.ctx, token)
+	s.last = token
+	s.revoked = nil
+	if s.save == nil {
+		return nil
+	}
+	s.saveErr = s.save(token)
+	return s.saveErr
+}
+
+// Credentials returns the client ID and secret, for logging in again
+func (s *TokenSource) Credentials() (clientID, clientSecret string) {
+	return s.config.ClientID, s.config.ClientSecret
+}
+
+// NeedsReauth reports whether the refresh token was rejected
+func (s *TokenSource) NeedsReauth() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.revoked != nil
+}
+
+// SaveError returns the error from the last attempt to save a token
+func (s *TokenSource) SaveError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saveErr
+}
+
+// IsRevoked reports whether err is the token endpoint rejecting the
+// refresh token, as happens when access is revoked, the password
+// changes or the token expires
+func IsRevoked(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		return retrieveErr.ErrorCode == "invalid_grant"
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// refreshServer stands in for the token endpoint, answering refresh
+// requests with reply
+func refreshServer(t *testing.T, reply func(w http.ResponseWriter, r *http.Request)) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if got := r.FormValue("grant_type"); got != "refresh_token" {
+			t.Errorf("got grant type %q", got)
+		}
+		reply(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// testTokenSource returns a token source refreshing at server
+func testTokenSource(server *httptest.Server, token *oauth2.Token, save SaveFunc) *TokenSource {
+	source := NewTokenSource(context.Background(), "client-id", "client-secret", token, save)
+	source.config.Endpoint = oauth2.Endpoint{TokenURL: server.URL, AuthStyle: oauth2.AuthStyleInParams}
+	source.base = source.config.TokenSource(source.ctx, token)
+	return source
+}
+
+func expiredToken() *oauth2.Token {
+	return &oauth2.Token{
+		AccessToken:  "old-access",
+		RefreshToken: "old-refresh",
+		TokenType:    "Bearer",
+		Expiry:       time.Now().Add(-time.Minute),
+	}
+}
+
+func TestTokenSourceSavesRefreshedToken(t *testing.T) {
+	server, requests := refreshServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.FormValue("refresh_token"); got != "old-refresh" {
+			t.Errorf("refreshed with %q", got)
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token":  "new-access",
+			"refresh_token": "rotated-refresh",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		})
+	})
+
+	var saved []*oauth2.Token
+	source := testTokenSource(server, expiredToken(), func(token *oauth2.Token) error {
+		saved = append(saved, token)
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		token, err := source.Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.AccessToken != "new-access" {
+			t.Errorf("got access token %q", token.AccessToken)
+		}
+	}
+	if requests.Load() != 1 {
+		t.Errorf("token endpoint asked %d times, want once", requests.Load())
+	}
+	// The rotated refresh token must survive a restart
+	if len(saved) != 1 || saved[0].AccessToken != "new-access" || saved[0].RefreshToken != "rotated-refresh" {
+		t.Fatalf("saved %+v, want the refreshed token once", saved)
+	}
+}
+
+func TestTokenSourceSaveFailure(t *testing.T) {
+	server, _ := refreshServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"access_token": "new-access", "token_type": "Bearer", "expires_in": 3600})
+	})
+	failure := errors.New("disk full")
+	source := testTokenSource(server, expiredToken(), func(*oauth2.Token) error { return failure })
+
+	// The token still serves this session
+	if _, err := source.Token(); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(source.SaveError(), failure) {
+		t.Errorf("got save error %v, want %v", source.SaveError(), failure)
+	}
+}
+
+func TestTokenSourceRevoked(t *testing.T) {
+	server, requests := refreshServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusBadRequest, map[string]any{
+			"error":             "invalid_grant",
+			"error_description": "Token has been expired or revoked.",
+		})
+	})
+	source := testTokenSource(server, expiredToken(), func(*oauth2.Token) error {
+		t.Error("saved a token after the refresh failed")
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := source.Token(); !errors.Is(err, ErrReauthRequired) {
+			t.Fatalf("got error %v, want ErrReauthRequired", err)
+		}
+	}
+	if !source.NeedsReauth() {
+		t.Error("revoked token source doesn't ask to log in again")
+	}
+	if requests.Load() != 1 {
+		t.Errorf("token endpoint asked %d times after the revocation, want once", requests.Load())
+	}
+
+	// Logging in again starts over with the new token
+	var saved *oauth2.Token
+	source.save = func(token *oauth2.Token) error {
+		saved = token
+		return nil
+	}
+	fresh := &oauth2.Token{AccessToken: "fresh", TokenType: "Bearer", Expiry: time.Now().Add(time.Hour)}
+	if err := source.Reset(fresh); err != nil {
+		t.Fatal(err)
+	}
+	if source.NeedsReauth() || saved != fresh {
+		t.Fatalf("reset left reauth %v, saved %+v", source.NeedsReauth(), saved)
+	}
+	if token, err := source.Token(); err != nil || token.AccessToken != "fresh" {
+		t.Errorf("got token %+v, error %v after the reset", token, err)
+	}
+}
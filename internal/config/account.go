@@ -0,0 +1,197 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// BackendGmail is the Gmail API backend, the only one supported so far
+const BackendGmail = "gmail"
+
+// Backends lists the account backends vimail can connect to
+var Backends = []string{BackendGmail}
+
+// Account is one mailbox vimail can read and send from
+type Account struct {
+	Name       string      `json:"name"`
+	Backend    string      `json:"backend"`
+	OAuth      OAuthConfig `json:"oauth"`
+	UserEmail  string      `json:"user_email,omitempty"`
+	Signature  string      `json:"signature,omitempty"`
+	Identities []Identity  `json:"identities,omitempty"`
+	Markdown   bool        `json:"markdown,omitempty"`
+
+	// ServiceAccount, when set, logs in with a Workspace service account
+	// instead of OAuth
+	ServiceAccount *ServiceAccountConfig `json:"service_account,omitempty"`
+}
+
+// ServiceAccountConfig logs in through a service account with
+// domain-wide delegation, acting as Subject. A relative key file path is
+// resolved against the config directory.
+type ServiceAccountConfig struct {
+	KeyFile string `json:"key_file"`
+	Subject string `json:"subject"`
+}
+
+// KeyFilePath returns the absolute path of the service account key
+func (s *ServiceAccountConfig) KeyFilePath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return resolveConfigPath(configDir, s.KeyFile, ""), nil
+}
+
+// NewAccount creates an account using the given backend
+func NewAccount(name, backend string) (*Account, error) {
+	if err := ValidateAccountName(name); err != nil {
+		return nil, err
+	}
+	if backend == "" {
+		backend = BackendGmail
+	}
+	if !validBackend(backend) {
+		return nil, fmt.Errorf("unknown backend %q, available: %s", backend, strings.Join(Backends, ", "))
+	}
+	return &Account{Name: name, Backend: backend}, nil
+}
+
+// ValidateAccountName checks that name can be used on the command line
+// and in the config file
+func ValidateAccountName(name string) error {
+	if name == "" {
+		return fmt.Errorf("account name is required")
+	}
+	if strings.ContainsAny(name, " \t\r\n/\\") {
+		return fmt.Errorf("account name %q must not contain spaces or slashes", name)
+	}
+	return nil
+}
+
+// SuggestAccountName names an account after the local part of its
+// address, falling back to "default"
+func SuggestAccountName(email string) string {
+	if local, _, ok := strings.Cut(email, "@"); ok && ValidateAccountName(local) == nil {
+		return local
+	}
+	return "default"
+}
+
+func validBackend(backend string) bool {
+	for _, b := range Backends {
+		if b == backend {
+			return true
+		}
+	}
+	return false
+}
+
+// Account returns the account with the given name, or the default
+// account when name is empty
+func (c *Config) Account(name string) (*Account, error) {
+	if len(c.Accounts) == 0 {
+		return nil, fmt.Errorf("no accounts configured, add one with: vimail account add NAME")
+	}
+
+	if name == "" {
+		name = c.DefaultAccount
+		if name == "" {
+			return c.Accounts[0], nil
+		}
+	}
+
+	for _, account := range c.Accounts {
+		if account.Name == name {
+			return account, nil
+		}
+	}
+	return nil, fmt.Errorf("no account named %q", name)
+}
+
+// DefaultAccountName returns the name of the account used when none is
+// chosen
+func (c *Config) DefaultAccountName() string {
+	if account, err := c.Account(""); err == nil {
+		return account.Name
+	}
+	return ""
+}
+
+// AddAccount adds an account; names must be unique
+func (c *Config) AddAccount(account *Account) error {
+	if err := ValidateAccountName(account.Name); err != nil {
+		return err
+	}
+	for _, existing := range c.Accounts {
+		if existing.Name == account.Name {
+			return fmt.Errorf("account %q already exists", account.Name)
+		}
+	}
+	c.Accounts = append(c.Accounts, account)
+	return nil
+}
+
+// RemoveAccount removes the named account. If it was the default, the
+// first remaining account becomes the default.
+func (c *Config) RemoveAccount(name string) error {
+	for i, account := range c.Accounts {
+		if account.Name == name {
+			c.Accounts = append(c.Accounts[:i], c.Accounts[i+1:]...)
+			if c.DefaultAccount == name {
+				c.DefaultAccount = ""
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no account named %q", name)
+}
+
+// SetDefault makes the named account the one used when none is chosen
+func (c *Config) SetDefault(name string) error {
+	if _, err := c.Account(name); err != nil {
+		return err
+	}
+	c.DefaultAccount = name
+	return nil
+}
+
+// legacyConfig is the single account layout used before multiple
+// accounts were supported
+type legacyConfig struct {
+	OAuth      OAuthConfig `json:"oauth"`
+	UserEmail  string      `json:"user_email,omitempty"`
+	Signature  string      `json:"signature,omitempty"`
+	Identities []Identity  `json:"identities,omitempty"`
+	Markdown   bool        `json:"markdown,omitempty"`
+}
+
+// migrateSingleAccount moves the account settings of an old config file
+// into an account of their own, reporting whether anything changed
+func migrateSingleAccount(data []byte, cfg *Config) (bool, error) {
+	if len(cfg.Accounts) > 0 {
+		return false, nil
+	}
+
+	var legacy legacyConfig
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return false, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if legacy.OAuth.ClientID == "" && legacy.OAuth.Token == nil {
+		return false, nil
+	}
+
+	name := SuggestAccountName(legacy.UserEmail)
+	cfg.Accounts = []*Account{{
+		Name:       name,
+		Backend:    BackendGmail,
+		OAuth:      legacy.OAuth,
+		UserEmail:  legacy.UserEmail,
+		Signature:  legacy.Signature,
+		Identities: legacy.Identities,
+		Markdown:   legacy.Markdown,
+	}}
+	cfg.DefaultAccount = name
+	return true, nil
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const legacyConfigFile = `{
+  "oauth": {
+    "client_id": "client-id",
+    "client_secret": "client-secret",
+    "token": {
+      "access_token": "access",
+      "refresh_token": "refresh",
+      "token_type": "Bearer",
+      "expiry": "2030-01-02T15:04:05Z"
+    }
+  },
+  "user_email": "alice@example.com",
+  "signature": "Alice",
+  "markdown": true,
+  "created_at": "2024-01-01T00:00:00Z"
+}`
+
+func TestLoadMigratesSingleAccount(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ConfigFileName)
+	t.Setenv(ConfigEnv, path)
+	if err := os.WriteFile(path, []byte(legacyConfigFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Accounts) != 1 || cfg.DefaultAccount != "alice" {
+		t.Fatalf("got %d accounts, default %q; want the single account alice", len(cfg.Accounts), cfg.DefaultAccount)
+	}
+	account := cfg.Accounts[0]
+	if account.Name != "alice" || account.Backend != BackendGmail || account.UserEmail != "alice@example.com" ||
+		account.Signature != "Alice" || !account.Markdown {
+		t.Errorf("migrated account %+v", account)
+	}
+	if account.OAuth.ClientID != "client-id" || account.OAuth.ClientSecret != "client-secret" {
+		t.Errorf("migrated client %+v", account.OAuth)
+	}
+	if token := account.OAuth.Token; token == nil || token.RefreshToken != "refresh" || token.Expiry.Year() != 2030 {
+		t.Errorf("migrated token %+v", token)
+	}
+
+	// The migration is saved, with the old file kept as a backup
+	backup, err := os.ReadFile(path + ".backup")
+	if err != nil || string(backup) != legacyConfigFile {
+		t.Errorf("backup holds %q, %v; want the legacy file", backup, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"accounts"`) {
+		t.Errorf("migrated config not saved:\n%s", data)
+	}
+	again, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.Accounts) != 1 || again.Accounts[0].OAuth.Token == nil {
+		t.Errorf("reloading the migrated file gave %+v", again.Accounts)
+	}
+}
+
+func TestMigrateSingleAccountLeavesCurrentConfig(t *testing.T) {
+	data := []byte(`{"accounts": [{"name": "work", "backend": "gmail"}], "oauth": {"client_id": "stale"}}`)
+	cfg := &Config{Accounts: []*Account{{Name: "work", Backend: BackendGmail}}}
+	migrated, err := migrateSingleAccount(data, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated || len(cfg.Accounts) != 1 || cfg.Accounts[0].Name != "work" {
+		t.Fatalf("config with accounts migrated again: %+v", cfg.Accounts)
+	}
+}
@@ -5,46 +5,135 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
+	"vimail/internal/safefile"
+	"vimail/internal/secrets"
 
 	"golang.org/x/oauth2"
 )
 
-// Config represents the application configuration
+// Config represents the application configuration: the mail accounts
+// and the settings shared by all of them
 type Config struct {
-	OAuth     OAuthConfig `json:"oauth"`
-	UserEmail string      `json:"user_email,omitempty"`
-	CreatedAt time.Time   `json:"created_at"`
-	UpdatedAt time.Time   `json:"updated_at"`
+	Accounts       []*Account  `json:"accounts"`
+	DefaultAccount string      `json:"default_account,omitempty"`
+	Spell          SpellConfig `json:"spell"`
+	PGP            PGPConfig   `json:"pgp"`
+	SMIME          SMIMEConfig `json:"smime"`
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+
+	// SendDelay is the undo delay in seconds from before it moved to the
+	// preferences; a negative value sent immediately
+	SendDelay int `json:"send_delay,omitempty"`
+
+	// secrets holds the client secrets and tokens once unlocked; they
+	// are then kept out of the config file
+	secrets *secrets.Store
+
+	// loaded is the config as last read or saved, so Save can tell the
+	// edits made here from those of other vimail processes
+	loaded *Config
 }
 
 // OAuthConfig holds OAuth 2.0 configuration and tokens
 type OAuthConfig struct {
-	ClientID     string       `json:"client_id"`
-	ClientSecret string       `json:"client_secret"`
+	ClientID     string        `json:"client_id"`
+	ClientSecret string        `json:"client_secret,omitempty"`
 	Token        *oauth2.Token `json:"token,omitempty"`
+
+	// RedirectURIs are those registered for the client, when it was
+	// imported from a credentials file
+	RedirectURIs []string `json:"redirect_uris,omitempty"`
+}
+
+// SpellConfig controls offline spell checking in the composer
+type SpellConfig struct {
+	Disabled       bool     `json:"disabled,omitempty"`
+	Language       string   `json:"language,omitempty"`
+	DictionaryDirs []string `json:"dictionary_dirs,omitempty"`
+}
+
+// DefaultSpellLanguage is used when no language is configured
+const DefaultSpellLanguage = "en_US"
+
+// SpellLanguage returns the configured dictionary language
+func (s SpellConfig) SpellLanguage() string {
+	if s.Language == "" {
+		return DefaultSpellLanguage
+	}
+	return s.Language
+}
+
+// DefaultSendDelay is how long a sent message can still be undone
+const DefaultSendDelay = 10 * time.Second
+
+// PGPConfig locates the OpenPGP keyrings. Relative paths are resolved
+// against the config directory.
+type PGPConfig struct {
+	PublicKeyring string `json:"public_keyring,omitempty"`
+	SecretKeyring string `json:"secret_keyring,omitempty"`
+}
+
+// Default keyring file names in the config directory
+const (
+	DefaultPublicKeyring = "pubring.asc"
+	DefaultSecretKeyring = "secring.asc"
+)
+
+// KeyringPaths returns the absolute public and secret keyring paths
+func (p PGPConfig) KeyringPaths() (public, secret string, err error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", "", err
+	}
+
+	return resolveConfigPath(configDir, p.PublicKeyring, DefaultPublicKeyring),
+		resolveConfigPath(configDir, p.SecretKeyring, DefaultSecretKeyring), nil
 }
 
+// SMIMEConfig locates the S/MIME trust anchors and our own certificate
+// and key, all PEM encoded. Relative paths are resolved against the
+// config directory. Without a CA bundle the system roots are used.
+type SMIMEConfig struct {
+	CABundle    string `json:"ca_bundle,omitempty"`
+	Certificate string `json:"certificate,omitempty"`
+	Key         string `json:"key,omitempty"`
+}
+
+// Default S/MIME file names in the config directory
 const (
-	ConfigFileName = "config.json"
-	ConfigDirName  = ".terminal-email"
+	DefaultSMIMECertificate = "smime.crt"
+	DefaultSMIMEKey         = "smime.key"
 )
 
-// GetConfigPath returns the full path to the config file
-func GetConfigPath() (string, error) {
-	homeDir, err := os.UserHomeDir()
+// Paths returns the absolute CA bundle, certificate and key paths. The
+// CA bundle path is empty when none is configured.
+func (s SMIMEConfig) Paths() (caBundle, certificate, key string, err error) {
+	configDir, err := GetConfigDir()
 	if err != nil {
-		return "", fmt.Errorf("failed to get user home directory: %w", err)
+		return "", "", "", err
 	}
 
-	configDir := filepath.Join(homeDir, ConfigDirName)
-	
-	// Ensure config directory exists
-	if err := os.MkdirAll(configDir, 0700); err != nil {
-		return "", fmt.Errorf("failed to create config directory: %w", err)
+	if s.CABundle != "" {
+		caBundle = resolveConfigPath(configDir, s.CABundle, "")
 	}
+	return caBundle,
+		resolveConfigPath(configDir, s.Certificate, DefaultSMIMECertificate),
+		resolveConfigPath(configDir, s.Key, DefaultSMIMEKey), nil
+}
 
-	return filepath.Join(configDir, ConfigFileName), nil
+// resolveConfigPath makes a configured path absolute, falling back to a
+// default file name in the config directory
+func resolveConfigPath(configDir, path, fallback string) string {
+	if path == "" {
+		path = fallback
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(configDir, path)
+	}
+	return path
 }
 
 // Load reads and parses the configuration file
@@ -59,43 +148,422 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("configuration file not found at %s", configPath)
 	}
 
+	config, migrated, err := readMigrated(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Older versions stored a single account at the top level. The file
+	// is read again under the lock, as another vimail may be migrating it
+	// too.
+	if migrated {
+		err = safefile.Update(configPath, func() error {
+			if config, migrated, err = readMigrated(configPath); err != nil || !migrated {
+				return err
+			}
+			if err := BackupConfig(); err != nil {
+				return fmt.Errorf("failed to back up config before migration: %w", err)
+			}
+			if err := config.save(configPath); err != nil {
+				return fmt.Errorf("failed to save migrated config: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	config.loaded = config.snapshot()
+	return config, nil
+}
+
+// readMigrated reads the config file, bringing an old one up to date in
+// memory and reporting whether it had to
+func readMigrated(configPath string) (*Config, bool, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, false, fmt.Errorf("failed to read config file: %w", err)
 	}
 
 	var config Config
 	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+		return nil, false, fmt.Errorf("failed to parse config file: %w", err)
 	}
-
-	return &config, nil
+	migrated, err := migrateSingleAccount(data, &config)
+	if err != nil {
+		return nil, false, err
+	}
+	return &config, migrated, nil
 }
 
-// Save writes the configuration to file
+// saveMu serializes saves, which also come from token refreshes in
+// background requests. Other vimail processes are kept out with a lock
+// on the config file.
+var saveMu sync.Mutex
+
+// Save writes the configuration to file. Edits another vimail saved
+// since this one loaded are kept: accounts it added or removed, and the
+// settings and accounts this one didn't change itself. So are tokens it
+// saved that are newer than ours.
 func (c *Config) Save() error {
+	saveMu.Lock()
+	defer saveMu.Unlock()
+
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return err
+	}
+	return safefile.Update(configPath, func() error {
+		stored, err := readConfigFile(configPath)
+		if err != nil {
+			return err
+		}
+		if err := c.adoptStoredTokens(stored); err != nil {
+			return err
+		}
+		c.merge(stored)
+		if err := c.save(configPath); err != nil {
+			return err
+		}
+		c.loaded = c.snapshot()
+		return nil
+	})
+}
+
+// SaveToken stores a refreshed token for account and saves it. It is
+// safe to call from the goroutines making API requests. Only the token
+// is written into what is on disk, so changes another vimail made to
+// the config meanwhile are kept, and if that vimail saved a newer token
+// for the account it is kept and used here too.
+func (c *Config) SaveToken(account *Account, token *oauth2.Token) error {
+	saveMu.Lock()
+	defer saveMu.Unlock()
+
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return err
+	}
+	return safefile.Update(configPath, func() error {
+		if c.secrets != nil {
+			return c.saveSecretToken(account, token)
+		}
+
+		stored, err := readConfigFile(configPath)
+		if err != nil {
+			return err
+		}
+		storedAccount, err := stored.Account(account.Name)
+		if err != nil {
+			// Removed by another vimail, or not saved yet; a later Save
+			// writes the token with the account
+			account.OAuth.Token = token
+			return nil
+		}
+
+		token = newerToken(token, storedAccount.OAuth.Token)
+		account.OAuth.Token = token
+		storedAccount.OAuth.Token = token
+		stored.UpdatedAt = time.Now()
+		return writeConfigFile(configPath, stored)
+	})
+}
+
+// ChangePassphrase re-encrypts the secrets store under a new passphrase.
+// It holds the lock saves take, so a token another vimail saves
+// meanwhile is neither lost nor written under the old passphrase.
+func (c *Config) ChangePassphrase(passphrase []byte) error {
+	saveMu.Lock()
+	defer saveMu.Unlock()
+
+	if c.secrets == nil {
+		return fmt.Errorf("credentials are not in a secrets store")
+	}
 	configPath, err := GetConfigPath()
 	if err != nil {
 		return err
 	}
+	return safefile.Update(configPath, func() error {
+		if err := c.secrets.Reload(); err != nil {
+			return err
+		}
+		return c.secrets.ChangePassphrase(passphrase)
+	})
+}
+
+// saveSecretToken writes a token into the secrets store as it is on disk
+func (c *Config) saveSecretToken(account *Account, token *oauth2.Token) error {
+	if err := c.secrets.Reload(); err != nil {
+		return err
+	}
+	entry, ok := c.secrets.Get(account.Name)
+	if !ok {
+		account.OAuth.Token = token
+		return nil
+	}
+
+	token = newerToken(token, entry.Token)
+	account.OAuth.Token = token
+	entry.Token = token
+	c.secrets.Put(account.Name, entry)
+	return c.secrets.Save()
+}
+
+// adoptStoredTokens takes the tokens saved on disk that are newer than
+// the accounts' own, so saving doesn't overwrite a token another vimail
+// refreshed with an older one
+func (c *Config) adoptStoredTokens(stored *Config) error {
+	tokens := map[string]*oauth2.Token{}
+	if c.secrets != nil {
+		if err := c.secrets.Reload(); err != nil {
+			return err
+		}
+		for _, name := range c.secrets.Accounts() {
+			entry, _ := c.secrets.Get(name)
+			tokens[name] = entry.Token
+		}
+	} else {
+		for _, account := range stored.Accounts {
+			tokens[account.Name] = account.OAuth.Token
+		}
+	}
 
+	for _, account := range c.Accounts {
+		account.OAuth.Token = newerToken(account.OAuth.Token, tokens[account.Name])
+	}
+	return nil
+}
+
+// merge takes into c the edits in stored that another vimail made since
+// c was loaded or last saved. Where both changed something, c wins.
+func (c *Config) merge(stored *Config) {
+	base := c.loaded
+	if base == nil {
+		base = &Config{}
+	}
+
+	c.DefaultAccount = pick(c.DefaultAccount, base.DefaultAccount, stored.DefaultAccount)
+	c.Spell = pick(c.Spell, base.Spell, stored.Spell)
+	c.PGP = pick(c.PGP, base.PGP, stored.PGP)
+	c.SMIME = pick(c.SMIME, base.SMIME, stored.SMIME)
+	c.SendDelay = pick(c.SendDelay, base.SendDelay, stored.SendDelay)
+
+	loaded := accountsByName(base.Accounts)
+	onDisk := accountsByName(stored.Accounts)
+	ours := accountsByName(c.Accounts)
+
+	var accounts []*Account
+	for _, account := range c.Accounts {
+		old, wasLoaded := loaded[account.Name]
+		current, exists := onDisk[account.Name]
+		switch {
+		case !wasLoaded || !sameSettings(account, old):
+			// Added or changed here
+		case !exists:
+			// Removed by another vimail
+			continue
+		default:
+			account.takeSettings(current)
+		}
+		accounts = append(accounts, account)
+	}
+	for _, account := range stored.Accounts {
+		_, wasLoaded := loaded[account.Name]
+		if _, kept := ours[account.Name]; !kept && !wasLoaded {
+			// Added by another vimail, whose credentials are in the
+			// secrets store when there is one
+			if c.secrets != nil {
+				entry, _ := c.secrets.Get(account.Name)
+				account.OAuth.ClientSecret = entry.ClientSecret
+				account.OAuth.Token = entry.Token
+			}
+			accounts = append(accounts, account)
+		}
+	}
+	c.Accounts = accounts
+}
+
+// pick returns ours if it was changed since base, and stored otherwise
+func pick[T any](ours, base, stored T) T {
+	if sameJSON(ours, base) {
+		return stored
+	}
+	return ours
+}
+
+// sameSettings compares accounts without their credentials, which are
+// kept in step by adoptStoredTokens and the secrets store
+func sameSettings(a, b *Account) bool {
+	left, right := *a, *b
+	left.OAuth.ClientSecret, left.OAuth.Token = "", nil
+	right.OAuth.ClientSecret, right.OAuth.Token = "", nil
+	return sameJSON(left, right)
+}
+
+// takeSettings replaces the account's settings with from's, keeping its
+// credentials
+func (a *Account) takeSettings(from *Account) {
+	oauth := a.OAuth
+	*a = *from
+	a.OAuth.ClientSecret = oauth.ClientSecret
+	a.OAuth.Token = oauth.Token
+}
+
+func sameJSON(a, b any) bool {
+	left, errLeft := json.Marshal(a)
+	right, errRight := json.Marshal(b)
+	return errLeft == nil && errRight == nil && string(left) == string(right)
+}
+
+func accountsByName(accounts []*Account) map[string]*Account {
+	byName := map[string]*Account{}
+	for _, account := range accounts {
+		byName[account.Name] = account
+	}
+	return byName
+}
+
+// snapshot copies the config as it is saved, for telling later edits
+// apart
+func (c *Config) snapshot() *Config {
+	var copied Config
+	if data, err := json.Marshal(c); err == nil {
+		json.Unmarshal(data, &copied)
+	}
+	return &copied
+}
+
+// newerToken returns whichever token expires later
+func newerToken(ours, stored *oauth2.Token) *oauth2.Token {
+	if stored == nil {
+		return ours
+	}
+	if ours == nil || stored.Expiry.After(ours.Expiry) {
+		return stored
+	}
+	return ours
+}
+
+func (c *Config) save(configPath string) error {
 	c.UpdatedAt = time.Now()
 	if c.CreatedAt.IsZero() {
 		c.CreatedAt = c.UpdatedAt
 	}
 
-	data, err := json.MarshalIndent(c, "", "  ")
+	// With a secrets store the credentials go there, encrypted, and the
+	// file only keeps the client ID
+	out := c
+	if c.secrets != nil {
+		stripped, err := c.saveSecrets()
+		if err != nil {
+			return err
+		}
+		out = stripped
+	}
+	return writeConfigFile(configPath, out)
+}
+
+// readConfigFile reads the config file as it is on disk. A missing file
+// gives an empty config.
+func readConfigFile(configPath string) (*Config, error) {
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	return &config, nil
+}
+
+// writeConfigFile replaces the config file, so a crash while saving
+// leaves the previous one in place
+func writeConfigFile(configPath string, config *Config) error {
+	data, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
-
-	if err := os.WriteFile(configPath, data, 0600); err != nil {
+	if err := safefile.WriteFile(configPath, data, 0600); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
-
 	return nil
 }
 
+// UseSecrets keeps the accounts' client secrets and tokens in store from
+// now on. Credentials still in the config file take precedence and are
+// moved into the store on the next Save.
+func (c *Config) UseSecrets(store *secrets.Store) {
+	c.secrets = store
+	for _, account := range c.Accounts {
+		entry, ok := store.Get(account.Name)
+		if !ok {
+			continue
+		}
+		if account.OAuth.ClientSecret == "" {
+			account.OAuth.ClientSecret = entry.ClientSecret
+		}
+		if account.OAuth.Token == nil {
+			account.OAuth.Token = entry.Token
+		}
+	}
+}
+
+// Secrets returns the secrets store in use, or nil when the credentials
+// live in the config file
+func (c *Config) Secrets() *secrets.Store {
+	return c.secrets
+}
+
+// HasPlaintextSecrets reports whether any account has credentials that
+// are not yet in a secrets store
+func (c *Config) HasPlaintextSecrets() bool {
+	if c.secrets != nil {
+		return false
+	}
+	for _, account := range c.Accounts {
+		if account.OAuth.ClientSecret != "" || account.OAuth.Token != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// saveSecrets writes the credentials of every account to the secrets
+// store and returns a copy of the config without them
+func (c *Config) saveSecrets() (*Config, error) {
+	stripped := *c
+	stripped.Accounts = make([]*Account, len(c.Accounts))
+
+	kept := map[string]bool{}
+	for i, account := range c.Accounts {
+		c.secrets.Put(account.Name, secrets.Entry{
+			ClientSecret: account.OAuth.ClientSecret,
+			Token:        account.OAuth.Token,
+		})
+		kept[account.Name] = true
+
+		copied := *account
+		copied.OAuth.ClientSecret = ""
+		copied.OAuth.Token = nil
+		stripped.Accounts[i] = &copied
+	}
+	for _, name := range c.secrets.Accounts() {
+		if !kept[name] {
+			c.secrets.Remove(name)
+		}
+	}
+
+	if err := c.secrets.Save(); err != nil {
+		return nil, err
+	}
+	return &stripped, nil
+}
+
 // Exists checks if a configuration file already exists
 func Exists() bool {
 	configPath, err := GetConfigPath()
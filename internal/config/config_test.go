@@ -0,0 +1,151 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// useConfigFile points the config path at a new file holding cfg
+func useConfigFile(t *testing.T, cfg *Config) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ConfigFileName)
+	t.Setenv(ConfigEnv, path)
+	if err := writeConfigFile(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func mustLoad(t *testing.T) *Config {
+	t.Helper()
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestSaveKeepsOtherProcessEdits(t *testing.T) {
+	path := useConfigFile(t, &Config{
+		Accounts: []*Account{
+			{Name: "work", Backend: BackendGmail, Signature: "Work"},
+			{Name: "old", Backend: BackendGmail},
+		},
+		DefaultAccount: "work",
+	})
+
+	first := mustLoad(t)
+	second := mustLoad(t)
+
+	// The first vimail adds an account and makes it the default
+	if err := first.AddAccount(&Account{Name: "home", Backend: BackendGmail}); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.SetDefault("home"); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second, which loaded before that, changes a signature and
+	// removes an account
+	account, err := second.Account("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	account.Signature = "Work, edited"
+	if err := second.RemoveAccount("old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := readConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, account := range stored.Accounts {
+		names = append(names, account.Name)
+	}
+	if len(names) != 2 || names[0] != "work" || names[1] != "home" {
+		t.Errorf("saved accounts %v, want work and home", names)
+	}
+	if stored.DefaultAccount != "home" {
+		t.Errorf("default account %q, want the other vimail's home", stored.DefaultAccount)
+	}
+	if work, err := stored.Account("work"); err != nil || work.Signature != "Work, edited" {
+		t.Errorf("work account lost its edited signature: %+v", work)
+	}
+	if _, err := second.Account("home"); err != nil {
+		t.Error("saving didn't take in the account the other vimail added")
+	}
+}
+
+func TestSaveTokenAcrossProcesses(t *testing.T) {
+	now := time.Now()
+	path := useConfigFile(t, &Config{Accounts: []*Account{{Name: "work", Backend: BackendGmail}}})
+
+	first := mustLoad(t)
+	second := mustLoad(t)
+	firstAccount, _ := first.Account("work")
+	secondAccount, _ := second.Account("work")
+
+	newer := &oauth2.Token{AccessToken: "newer", Expiry: now.Add(2 * time.Hour)}
+	older := &oauth2.Token{AccessToken: "older", Expiry: now.Add(time.Hour)}
+	if err := first.SaveToken(firstAccount, newer); err != nil {
+		t.Fatal(err)
+	}
+	// The second vimail refreshed earlier but saves later
+	if err := second.SaveToken(secondAccount, older); err != nil {
+		t.Fatal(err)
+	}
+	if secondAccount.OAuth.Token.AccessToken != "newer" {
+		t.Errorf("second vimail uses token %q, want the newer one saved by the first", secondAccount.OAuth.Token.AccessToken)
+	}
+
+	// Saving the whole config must not bring the older token back either
+	secondAccount.OAuth.Token = older
+	if err := second.Save(); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := readConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token := stored.Accounts[0].OAuth.Token; token == nil || token.AccessToken != "newer" {
+		t.Fatalf("stored token %+v, want the newer one", token)
+	}
+}
+
+func TestNewerToken(t *testing.T) {
+	now := time.Now()
+	early := &oauth2.Token{AccessToken: "early", Expiry: now}
+	late := &oauth2.Token{AccessToken: "late", Expiry: now.Add(time.Hour)}
+
+	tests := []struct {
+		name   string
+		ours   *oauth2.Token
+		stored *oauth2.Token
+		want   *oauth2.Token
+	}{
+		{name: "nothing stored", ours: early, want: early},
+		{name: "none of ours", stored: early, want: early},
+		{name: "stored is newer", ours: early, stored: late, want: late},
+		{name: "ours is newer", ours: late, stored: early, want: late},
+		{name: "same expiry keeps ours", ours: early, stored: &oauth2.Token{AccessToken: "other", Expiry: now}, want: early},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := newerToken(test.ours, test.stored); got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
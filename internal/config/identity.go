@@ -0,0 +1,72 @@
+package config
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// Identity is a From address the account can send as, with an optional
+// signature that overrides the account signature
+type Identity struct {
+	Email     string `json:"email"`
+	Name      string `json:"name,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// Address returns the identity formatted for a From header
+func (i Identity) Address() string {
+	if i.Name == "" {
+		return i.Email
+	}
+	addr := mail.Address{Name: i.Name, Address: i.Email}
+	return addr.String()
+}
+
+// SignatureFor returns the signature to use when sending from the given
+// address, falling back to the account signature
+func (a *Account) SignatureFor(email string) string {
+	for _, identity := range a.Identities {
+		if strings.EqualFold(identity.Email, email) && identity.Signature != "" {
+			return identity.Signature
+		}
+	}
+	return a.Signature
+}
+
+// MergeIdentities combines the configured identities with the addresses
+// discovered on the server. Configured names and signatures win, the
+// account address comes first, and every identity has its signature
+// resolved.
+func (a *Account) MergeIdentities(discovered []Identity) []Identity {
+	var merged []Identity
+	seen := make(map[string]int)
+
+	add := func(identity Identity) {
+		key := strings.ToLower(identity.Email)
+		if key == "" {
+			return
+		}
+		if idx, ok := seen[key]; ok {
+			if merged[idx].Name == "" {
+				merged[idx].Name = identity.Name
+			}
+			return
+		}
+		seen[key] = len(merged)
+		merged = append(merged, identity)
+	}
+
+	add(Identity{Email: a.UserEmail})
+	for _, identity := range a.Identities {
+		add(identity)
+	}
+	for _, identity := range discovered {
+		add(identity)
+	}
+
+	for i := range merged {
+		merged[i].Signature = a.SignatureFor(merged[i].Email)
+	}
+
+	return merged
+}
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Actions that keys can be bound to in the preferences keymap
+const (
+	ActionQuit        = "quit"
+	ActionUp          = "up"
+	ActionDown        = "down"
+	ActionOpen        = "open"
+	ActionBack        = "back"
+	ActionCompose     = "compose"
+	ActionReply       = "reply"
+	ActionForward     = "forward"
+	ActionSave        = "save"
+	ActionOutbox      = "outbox"
+	ActionAccounts    = "accounts"
+	ActionNextAccount = "next_account"
+	ActionPrevAccount = "prev_account"
+	ActionUndoSend    = "undo_send"
+	ActionLogin       = "login"
+
+	ActionEditScheduled   = "edit_scheduled"
+	ActionCancelScheduled = "cancel_scheduled"
+	ActionSendNow         = "send_now"
+)
+
+// DefaultKeymap returns the keys bound to each action when the keymap
+// doesn't rebind it
+func DefaultKeymap() map[string][]string {
+	return map[string][]string{
+		ActionQuit:        {"q"},
+		ActionUp:          {"up", "k"},
+		ActionDown:        {"down", "j"},
+		ActionOpen:        {"enter"},
+		ActionBack:        {"esc"},
+		ActionCompose:     {"c"},
+		ActionReply:       {"r"},
+		ActionForward:     {"f"},
+		ActionSave:        {"s"},
+		ActionOutbox:      {"o"},
+		ActionAccounts:    {"a"},
+		ActionNextAccount: {"tab"},
+		ActionPrevAccount: {"shift+tab"},
+		ActionUndoSend:    {"u"},
+		ActionLogin:       {"L"},
+
+		ActionEditScheduled:   {"e"},
+		ActionCancelScheduled: {"d", "x"},
+		ActionSendNow:         {"s"},
+	}
+}
+
+// outboxActions only apply in the outbox view and mailActions only in
+// the inbox and reader, so a key may be bound to one of each
+var (
+	outboxActions = map[string]bool{
+		ActionEditScheduled: true, ActionCancelScheduled: true, ActionSendNow: true,
+	}
+	mailActions = map[string]bool{
+		ActionCompose: true, ActionReply: true, ActionForward: true, ActionSave: true,
+		ActionAccounts: true, ActionNextAccount: true, ActionPrevAccount: true,
+	}
+)
+
+// IsOutboxAction reports whether action only applies in the outbox view
+func IsOutboxAction(action string) bool {
+	return outboxActions[action]
+}
+
+// sharesKeys reports whether two actions are never active in the same
+// view, so they can be bound to the same key
+func sharesKeys(a, b string) bool {
+	return outboxActions[a] && mailActions[b] || mailActions[a] && outboxActions[b]
+}
+
+// namedKeys are the keys with names, as Bubble Tea reports them
+var namedKeys = map[string]bool{
+	"enter": true, "esc": true, "tab": true, "shift+tab": true, "backspace": true,
+	"delete": true, "insert": true, "up": true, "down": true, "left": true,
+	"right": true, "home": true, "end": true, "pgup": true, "pgdown": true,
+	"space": true, "f1": true, "f2": true, "f3": true, "f4": true, "f5": true,
+	"f6": true, "f7": true, "f8": true, "f9": true, "f10": true, "f11": true, "f12": true,
+}
+
+// validateKey checks that key is one vimail can receive: a single
+// character, a named key, or either with ctrl+ or alt+
+func validateKey(key string) error {
+	if key == "ctrl+c" {
+		return fmt.Errorf("ctrl+c always quits and can't be bound")
+	}
+	name := key
+	if rest, ok := strings.CutPrefix(name, "alt+"); ok {
+		name = rest
+	}
+	if rest, ok := strings.CutPrefix(name, "ctrl+"); ok {
+		if utf8.RuneCountInString(rest) == 1 && rest >= "a" && rest <= "z" {
+			return nil
+		}
+		name = rest
+	}
+	if namedKeys[name] || utf8.RuneCountInString(name) == 1 && name != " " {
+		return nil
+	}
+	return fmt.Errorf("unknown key %q", key)
+}
+
+// parseKeymap fills prefs.Keymap from the keymap object, where each
+// action takes a key or a list of keys. Every action must end up with
+// a key of its own.
+func parseKeymap(raw json.RawMessage, pos positions, data []byte, prefs *Preferences) []Problem {
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return []Problem{pos.valueProblem(data, "keymap", "keymap: must be an object of actions and keys")}
+	}
+
+	defaults := DefaultKeymap()
+	var problems []Problem
+	keymap := map[string][]string{}
+	for action, value := range entries {
+		path := "keymap." + action
+		if _, ok := defaults[action]; !ok {
+			problems = append(problems, pos.problem(data, path,
+				fmt.Sprintf("unknown action %q, available: %s", action, strings.Join(KeyActions(), ", "))))
+			continue
+		}
+
+		var keys []string
+		var single string
+		if err := json.Unmarshal(value, &single); err == nil {
+			keys = []string{single}
+		} else if err := json.Unmarshal(value, &keys); err != nil {
+			problems = append(problems, pos.valueProblem(data, path, path+": must be a key or a list of keys"))
+			continue
+		}
+		if len(keys) == 0 {
+			problems = append(problems, pos.valueProblem(data, path, path+": needs at least one key"))
+			continue
+		}
+
+		valid := true
+		for i, key := range keys {
+			if err := validateKey(key); err != nil {
+				keyPath := path
+				if single == "" {
+					keyPath = fmt.Sprintf("%s[%d]", path, i)
+				}
+				problems = append(problems, pos.valueProblem(data, keyPath, fmt.Sprintf("%s: %v", path, err)))
+				valid = false
+			}
+		}
+		if valid {
+			keymap[action] = keys
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	prefs.Keymap = keymap
+
+	// A key bound to two actions of the same view would only ever trigger
+	// one of them
+	bound := map[string][]string{}
+	for _, action := range KeyActions() {
+		for _, key := range prefs.Bindings()[action] {
+			for _, other := range bound[key] {
+				if sharesKeys(action, other) {
+					continue
+				}
+				path := "keymap." + action
+				if _, ok := keymap[action]; !ok {
+					path = "keymap." + other
+				}
+				problems = append(problems, pos.valueProblem(data, path,
+					fmt.Sprintf("key %q is bound to both %s and %s", key, other, action)))
+				break
+			}
+			bound[key] = append(bound[key], action)
+		}
+	}
+	return problems
+}
+
+// KeyActions returns the names of the actions keys can be bound to
+func KeyActions() []string {
+	actions := make([]string, 0, len(DefaultKeymap()))
+	for action := range DefaultKeymap() {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	return actions
+}
@@ -0,0 +1,204 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	ConfigFileName = "config.json"
+	// AppDirName is the directory vimail uses under each XDG base
+	// directory
+	AppDirName = "vimail"
+	// LegacyDirName is the directory in $HOME that held everything
+	// before the XDG base directories were used
+	LegacyDirName = ".terminal-email"
+	// ConfigEnv overrides the config file path, as the --config flag does
+	ConfigEnv = "VIMAIL_CONFIG"
+)
+
+// configPathOverride is the config file given with --config
+var configPathOverride string
+
+// SetConfigPath makes vimail read and write the config file at path, and
+// keep the files that belong with it, such as the secrets, next to it.
+// It takes precedence over VIMAIL_CONFIG.
+func SetConfigPath(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("invalid config path %q: %w", path, err)
+	}
+	configPathOverride = abs
+	return nil
+}
+
+// GetConfigPath returns the full path to the config file: the one given
+// with --config or VIMAIL_CONFIG, or config.json in the XDG config
+// directory. Nothing is created; files are written with their
+// directories when saved.
+func GetConfigPath() (string, error) {
+	if configPathOverride != "" {
+		return configPathOverride, nil
+	}
+	if path := os.Getenv(ConfigEnv); path != "" {
+		return filepath.Abs(path)
+	}
+
+	base, err := xdgDir("XDG_CONFIG_HOME", ".config")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, AppDirName, ConfigFileName), nil
+}
+
+// GetConfigDir returns the directory of the config file, which also holds
+// the secrets, keys and certificates, and dictionaries
+func GetConfigDir() (string, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(configPath), nil
+}
+
+// GetDataDir returns the directory for data vimail creates, such as the
+// address book and the outbox: $XDG_DATA_HOME/vimail
+func GetDataDir() (string, error) {
+	base, err := xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share"))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, AppDirName), nil
+}
+
+// xdgDir returns the XDG base directory in env, or its default under the
+// home directory. Relative values are ignored, as the spec requires.
+func xdgDir(env, fallback string) (string, error) {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(homeDir, fallback), nil
+}
+
+// MigrateLegacyDir moves the files of the old ~/.terminal-email directory
+// to the XDG directories, the first time vimail runs without a config
+// file there. The files named in dataFiles go to the data directory and
+// everything else to the config directory. It returns the legacy
+// directory when files were moved.
+func MigrateLegacyDir(dataFiles ...string) (string, error) {
+	// An explicit config path is used as given
+	if configPathOverride != "" || os.Getenv(ConfigEnv) != "" {
+		return "", nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", nil
+	}
+	legacyDir := filepath.Join(homeDir, LegacyDirName)
+	if _, err := os.Stat(filepath.Join(legacyDir, ConfigFileName)); err != nil {
+		return "", nil
+	}
+	if Exists() {
+		return "", nil
+	}
+
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dataDir, err := GetDataDir()
+	if err != nil {
+		return "", err
+	}
+
+	isData := map[string]bool{}
+	for _, name := range dataFiles {
+		isData[name] = true
+	}
+
+	entries, err := os.ReadDir(legacyDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", legacyDir, err)
+	}
+
+	// The config file goes last, so an interrupted migration is retried
+	for _, last := range []bool{false, true} {
+		for _, entry := range entries {
+			if (entry.Name() == ConfigFileName) != last {
+				continue
+			}
+			target := configDir
+			if isData[entry.Name()] {
+				target = dataDir
+			}
+			src, dst := filepath.Join(legacyDir, entry.Name()), filepath.Join(target, entry.Name())
+			if _, err := os.Lstat(dst); err == nil {
+				// Never overwrite files already in the new location
+				continue
+			}
+			if err := movePath(src, dst); err != nil {
+				return "", fmt.Errorf("failed to move %s to %s: %w", src, dst, err)
+			}
+		}
+	}
+
+	// Only removed when everything was moved
+	os.Remove(legacyDir)
+	return legacyDir, nil
+}
+
+// movePath renames src to dst, copying when they are on different file
+// systems
+func movePath(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	err := filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0700)
+		}
+		return copyFile(path, target)
+	})
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// legacyHome makes a home directory holding ~/.terminal-email with files
+func legacyHome(t *testing.T, files map[string]string) (home, legacyDir string) {
+	t.Helper()
+	home = t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(ConfigEnv, "")
+	legacyDir = filepath.Join(home, LegacyDirName)
+	for name, content := range files {
+		writeFile(t, filepath.Join(legacyDir, name), content)
+	}
+	return home, legacyDir
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestMigrateLegacyDir(t *testing.T) {
+	files := map[string]string{
+		ConfigFileName:  "config",
+		"secrets.json":  "secrets",
+		"contacts.json": "contacts",
+	}
+	tests := []struct {
+		name string
+		// configHome and dataHome are the XDG variables, joined to the
+		// home directory when absolute is set
+		configHome, dataHome string
+		absolute             bool
+		// wantConfig and wantData are relative to the home directory
+		wantConfig, wantData string
+	}{
+		{
+			name:       "defaults",
+			wantConfig: filepath.Join(".config", AppDirName),
+			wantData:   filepath.Join(".local", "share", AppDirName),
+		},
+		{
+			name:       "XDG overrides",
+			configHome: "xdg-config",
+			dataHome:   "xdg-data",
+			absolute:   true,
+			wantConfig: filepath.Join("xdg-config", AppDirName),
+			wantData:   filepath.Join("xdg-data", AppDirName),
+		},
+		{
+			name:       "relative XDG values ignored",
+			configHome: "xdg-config",
+			dataHome:   "xdg-data",
+			wantConfig: filepath.Join(".config", AppDirName),
+			wantData:   filepath.Join(".local", "share", AppDirName),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			home, legacyDir := legacyHome(t, files)
+			for env, value := range map[string]string{"XDG_CONFIG_HOME": test.configHome, "XDG_DATA_HOME": test.dataHome} {
+				if test.absolute {
+					value = filepath.Join(home, value)
+				}
+				t.Setenv(env, value)
+			}
+			configDir, dataDir := filepath.Join(home, test.wantConfig), filepath.Join(home, test.wantData)
+
+			moved, err := MigrateLegacyDir("contacts.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if moved != legacyDir {
+				t.Errorf("got moved directory %q, want %q", moved, legacyDir)
+			}
+			for path, want := range map[string]string{
+				filepath.Join(configDir, ConfigFileName): "config",
+				filepath.Join(configDir, "secrets.json"): "secrets",
+				filepath.Join(dataDir, "contacts.json"):  "contacts",
+			} {
+				if got := readFile(t, path); got != want {
+					t.Errorf("%s holds %q, want %q", path, got, want)
+				}
+			}
+			if _, err := os.Stat(legacyDir); !os.IsNotExist(err) {
+				t.Errorf("legacy directory left behind: %v", err)
+			}
+		})
+	}
+}
+
+func TestMigrateLegacyDirKeepsExistingFiles(t *testing.T) {
+	home, legacyDir := legacyHome(t, map[string]string{
+		ConfigFileName:  "legacy config",
+		"contacts.json": "legacy contacts",
+	})
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, "data"))
+	contacts := filepath.Join(home, "data", AppDirName, "contacts.json")
+	writeFile(t, contacts, "new contacts")
+
+	if _, err := MigrateLegacyDir("contacts.json"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, contacts); got != "new contacts" {
+		t.Errorf("existing contacts overwritten with %q", got)
+	}
+	if got := readFile(t, filepath.Join(home, "config", AppDirName, ConfigFileName)); got != "legacy config" {
+		t.Errorf("config holds %q", got)
+	}
+	// The file that wasn't moved stays, and so does its directory
+	if got := readFile(t, filepath.Join(legacyDir, "contacts.json")); got != "legacy contacts" {
+		t.Errorf("legacy contacts hold %q", got)
+	}
+}
+
+func TestMigrateLegacyDirSkipped(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, home string)
+	}{
+		{
+			name: "config already moved",
+			setup: func(t *testing.T, home string) {
+				writeFile(t, filepath.Join(home, "config", AppDirName, ConfigFileName), "new config")
+			},
+		},
+		{
+			name: "config path from the environment",
+			setup: func(t *testing.T, home string) {
+				t.Setenv(ConfigEnv, filepath.Join(home, "elsewhere.json"))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			home, legacyDir := legacyHome(t, map[string]string{ConfigFileName: "legacy config"})
+			t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+			test.setup(t, home)
+
+			moved, err := MigrateLegacyDir()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if moved != "" {
+				t.Errorf("got moved directory %q, want none", moved)
+			}
+			if got := readFile(t, filepath.Join(legacyDir, ConfigFileName)); got != "legacy config" {
+				t.Errorf("legacy config holds %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,545 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"vimail/internal/safefile"
+)
+
+// PreferencesFileName is the preferences file in the config directory,
+// kept apart from config.json so it can be edited by hand
+const PreferencesFileName = "preferences.json"
+
+// PreferencesVersion is the schema version written by this build. Files
+// with an older version are migrated one version at a time.
+const PreferencesVersion = 1
+
+// Defaults for preferences left out of the file
+const (
+	DefaultPageSize   = 20
+	DefaultDateFormat = "Mon 2 Jan 15:04"
+	DefaultTimeZone   = "Local"
+	DefaultTheme      = "zen"
+	MaxPageSize       = 500
+	MinWrapWidth      = 20
+)
+
+// Preferences are the settings that change how vimail looks and behaves,
+// as opposed to the accounts in config.json
+type Preferences struct {
+	Version int `json:"version"`
+	// PageSize is how many messages are fetched per inbox
+	PageSize int `json:"page_size"`
+	// DateFormat is a Go time layout, such as "2006-01-02 15:04"
+	DateFormat string `json:"date_format"`
+	// TimeZone is "Local" or an IANA name such as "Europe/Berlin"
+	TimeZone string `json:"time_zone"`
+	Theme    string `json:"theme"`
+	// Keymap rebinds actions; each lists the keys that trigger it and
+	// replaces that action's default keys
+	Keymap map[string][]string `json:"keymap,omitempty"`
+	// WrapWidth wraps message bodies; zero uses the window width
+	WrapWidth int `json:"wrap_width"`
+	// DownloadDir is where saved messages go; a leading ~ is the home
+	// directory
+	DownloadDir string `json:"download_dir"`
+	// SendDelay is how long a sent message can still be undone; zero
+	// sends immediately
+	SendDelay Duration `json:"send_delay"`
+
+	path     string
+	location *time.Location
+}
+
+// Duration is a time.Duration written as text, such as "10s"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("must be a duration such as \"10s\"")
+	}
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return fmt.Errorf("must be a duration such as \"10s\", not %q", text)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// DefaultPreferences returns the preferences used when there is no file
+func DefaultPreferences() *Preferences {
+	return &Preferences{
+		Version:     PreferencesVersion,
+		PageSize:    DefaultPageSize,
+		DateFormat:  DefaultDateFormat,
+		TimeZone:    DefaultTimeZone,
+		Theme:       DefaultTheme,
+		DownloadDir: filepath.Join("~", "Downloads"),
+		SendDelay:   Duration(DefaultSendDelay),
+		location:    time.Local,
+	}
+}
+
+// FormatDate formats t in the configured time zone and date format
+func (p *Preferences) FormatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	location := p.location
+	if location == nil {
+		location = time.Local
+	}
+	return t.In(location).Format(p.DateFormat)
+}
+
+// DownloadPath returns the download directory with ~ expanded
+func (p *Preferences) DownloadPath() (string, error) {
+	return expandHome(p.DownloadDir)
+}
+
+// SendDelayDuration returns how long to hold messages before sending
+func (p *Preferences) SendDelayDuration() time.Duration {
+	return time.Duration(p.SendDelay)
+}
+
+// Bindings returns the keys of every action, with the file's bindings
+// replacing the defaults
+func (p *Preferences) Bindings() map[string][]string {
+	bindings := DefaultKeymap()
+	for action, keys := range p.Keymap {
+		bindings[action] = keys
+	}
+	return bindings
+}
+
+// preferenceMigrations[i] upgrades a version i document to version i+1
+var preferenceMigrations = []func(doc map[string]json.RawMessage, legacy *Config) error{
+	migratePreferencesV0,
+}
+
+// migratePreferencesV0 starts the preferences file, taking the send
+// delay that used to be kept in config.json in seconds
+func migratePreferencesV0(doc map[string]json.RawMessage, legacy *Config) error {
+	if legacy == nil || legacy.SendDelay == 0 {
+		return nil
+	}
+	if _, ok := doc["send_delay"]; ok {
+		return nil
+	}
+	delay := time.Duration(legacy.SendDelay) * time.Second
+	if legacy.SendDelay < 0 {
+		delay = 0
+	}
+	value, err := json.Marshal(delay.String())
+	if err != nil {
+		return err
+	}
+	doc["send_delay"] = value
+	return nil
+}
+
+// GetPreferencesPath returns the path of the preferences file, next to
+// the config file
+func GetPreferencesPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, PreferencesFileName), nil
+}
+
+// LoadPreferences reads the preferences file, migrating it to the
+// current schema and saving it when it was older or missing. Settings
+// that moved out of config.json are taken from legacy, which may be
+// nil. Unknown keys and invalid values are reported with their line and
+// column as a *FileError.
+func LoadPreferences(legacy *Config) (*Preferences, error) {
+	path, err := GetPreferencesPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		data = []byte("{}")
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read preferences: %w", err)
+	}
+
+	prefs, migrated, err := parsePreferences(path, data, legacy)
+	if err != nil {
+		return nil, err
+	}
+
+	if migrated {
+		if err := prefs.Save(); err != nil {
+			return nil, err
+		}
+		// The send delay now lives in the preferences
+		if legacy != nil && legacy.SendDelay != 0 {
+			legacy.SendDelay = 0
+			if err := legacy.Save(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return prefs, nil
+}
+
+// ParsePreferences checks preferences read from path without migrating
+// or saving them, for reloading a file being edited
+func ParsePreferences(path string, data []byte) (*Preferences, error) {
+	prefs, _, err := parsePreferences(path, data, nil)
+	return prefs, err
+}
+
+func parsePreferences(path string, data []byte, legacy *Config) (*Preferences, bool, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, false, &FileError{Path: path, Problems: []Problem{syntaxProblem(data, err)}}
+	}
+	if doc == nil {
+		return nil, false, &FileError{Path: path, Problems: []Problem{{Line: 1, Column: 1, Message: "the file must hold a JSON object"}}}
+	}
+	positions, err := scanPositions(data)
+	if err != nil {
+		return nil, false, &FileError{Path: path, Problems: []Problem{syntaxProblem(data, err)}}
+	}
+
+	// A file without a version predates versioning
+	version := 0
+	if raw, ok := doc["version"]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil || version < 0 {
+			return nil, false, positions.error(path, data, "version", "version must be a whole number")
+		}
+	}
+	if version > PreferencesVersion {
+		return nil, false, positions.error(path, data, "version",
+			fmt.Sprintf("version %d is newer than this vimail understands (%d)", version, PreferencesVersion))
+	}
+
+	migrated := version < PreferencesVersion
+	for ; version < PreferencesVersion; version++ {
+		if err := preferenceMigrations[version](doc, legacy); err != nil {
+			return nil, false, fmt.Errorf("failed to migrate preferences from version %d: %w", version, err)
+		}
+	}
+	doc["version"] = json.RawMessage(fmt.Sprint(PreferencesVersion))
+
+	prefs := DefaultPreferences()
+	prefs.path = path
+	var problems []Problem
+	report := func(key string, message string) {
+		problems = append(problems, positions.problem(data, key, message))
+	}
+
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		raw := doc[key]
+		var err error
+		switch key {
+		case "version":
+			continue
+		case "page_size":
+			err = json.Unmarshal(raw, &prefs.PageSize)
+			if err == nil && (prefs.PageSize < 1 || prefs.PageSize > MaxPageSize) {
+				err = fmt.Errorf("must be between 1 and %d", MaxPageSize)
+			}
+		case "date_format":
+			err = json.Unmarshal(raw, &prefs.DateFormat)
+			if err == nil {
+				err = validateDateFormat(prefs.DateFormat)
+			}
+		case "time_zone":
+			err = json.Unmarshal(raw, &prefs.TimeZone)
+			if err == nil {
+				_, err = loadLocation(prefs.TimeZone)
+			}
+		case "theme":
+			err = json.Unmarshal(raw, &prefs.Theme)
+			if _, ok := Themes[prefs.Theme]; err == nil && !ok {
+				err = fmt.Errorf("unknown theme %q, available: %s", prefs.Theme, strings.Join(ThemeNames(), ", "))
+			}
+		case "keymap":
+			problems = append(problems, parseKeymap(raw, positions, data, prefs)...)
+			continue
+		case "wrap_width":
+			err = json.Unmarshal(raw, &prefs.WrapWidth)
+			if err == nil && prefs.WrapWidth != 0 && prefs.WrapWidth < MinWrapWidth {
+				err = fmt.Errorf("must be 0 for the window width, or at least %d", MinWrapWidth)
+			}
+		case "download_dir":
+			err = json.Unmarshal(raw, &prefs.DownloadDir)
+			if err == nil {
+				_, err = expandHome(prefs.DownloadDir)
+			}
+		case "send_delay":
+			err = json.Unmarshal(raw, &prefs.SendDelay)
+			if err == nil && prefs.SendDelay < 0 {
+				err = fmt.Errorf("must not be negative")
+			}
+		default:
+			report(key, fmt.Sprintf("unknown key %q", key))
+			continue
+		}
+		if err != nil {
+			problems = append(problems, positions.valueProblem(data, key, fmt.Sprintf("%s: %s", key, describeJSONError(err))))
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.SliceStable(problems, func(i, j int) bool {
+			return problems[i].Line < problems[j].Line ||
+				problems[i].Line == problems[j].Line && problems[i].Column < problems[j].Column
+		})
+		return nil, false, &FileError{Path: path, Problems: problems}
+	}
+
+	prefs.Version = PreferencesVersion
+	prefs.location, _ = loadLocation(prefs.TimeZone)
+	return prefs, migrated, nil
+}
+
+// Save writes the preferences back to their file
+func (p *Preferences) Save() error {
+	path := p.path
+	if path == "" {
+		var err error
+		if path, err = GetPreferencesPath(); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal preferences: %w", err)
+	}
+	if err := safefile.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write preferences: %w", err)
+	}
+	p.path = path
+	return nil
+}
+
+func validateDateFormat(layout string) error {
+	if strings.TrimSpace(layout) == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	// A layout without any date or time element prints itself
+	reference := time.Date(2009, time.November, 10, 23, 4, 5, 0, time.UTC)
+	if reference.Format(layout) == layout {
+		return fmt.Errorf("%q has no date or time elements; use Go's reference time, such as \"Jan 2 15:04\"", layout)
+	}
+	return nil
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" || name == DefaultTimeZone {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return location, nil
+}
+
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(homeDir, strings.TrimPrefix(path, "~")), nil
+}
+
+// describeJSONError shortens the type errors of encoding/json
+func describeJSONError(err error) string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return fmt.Sprintf("must be a %s, not a %s", jsonKind(typeErr.Type.Kind().String()), typeErr.Value)
+	}
+	return err.Error()
+}
+
+func jsonKind(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"):
+		return "whole number"
+	case kind == "slice":
+		return "list"
+	case kind == "map", kind == "struct":
+		return "object"
+	}
+	return kind
+}
+
+// Problem is one mistake in the preferences file
+type Problem struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+// FileError lists every problem found in the preferences or config
+// file
+type FileError struct {
+	Path     string
+	Problems []Problem
+}
+
+func (e *FileError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		if problem.Line == 0 {
+			lines[i] = fmt.Sprintf("%s: %s", e.Path, problem.Message)
+		} else {
+			lines[i] = fmt.Sprintf("%s:%d:%d: %s", e.Path, problem.Line, problem.Column, problem.Message)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// positions records where each key and value starts in a JSON document,
+// by dotted path such as "keymap.compose"
+type positions struct {
+	keys   map[string]int
+	values map[string]int
+}
+
+func (p positions) problem(data []byte, key, message string) Problem {
+	offset, ok := p.keys[key]
+	return newProblem(data, offset, ok, message)
+}
+
+func (p positions) valueProblem(data []byte, key, message string) Problem {
+	offset, ok := p.values[key]
+	return newProblem(data, offset, ok, message)
+}
+
+func (p positions) error(path string, data []byte, key, message string) error {
+	return &FileError{Path: path, Problems: []Problem{p.valueProblem(data, key, message)}}
+}
+
+func newProblem(data []byte, offset int, known bool, message string) Problem {
+	if !known {
+		return Problem{Message: message}
+	}
+	line, column := lineColumn(data, offset)
+	return Problem{Line: line, Column: column, Message: message}
+}
+
+// lineColumn converts a byte offset to a 1-based line and column
+func lineColumn(data []byte, offset int) (int, int) {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := offset - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+func syntaxProblem(data []byte, err error) Problem {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		// The offset is just past the offending character
+		line, column := lineColumn(data, max(int(syntaxErr.Offset)-1, 0))
+		return Problem{Line: line, Column: column, Message: strings.TrimPrefix(syntaxErr.Error(), "json: ")}
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		// The offset is just past the value of the wrong type
+		line, column := lineColumn(data, max(int(typeErr.Offset)-1, 0))
+		if typeErr.Field == "" {
+			return Problem{Line: line, Column: column, Message: "the file must hold a JSON object"}
+		}
+		return Problem{Line: line, Column: column, Message: typeErr.Field + ": " + describeJSONError(err)}
+	}
+	return Problem{Message: err.Error()}
+}
+
+// scanPositions walks the document's tokens, noting where every key and
+// value starts
+func scanPositions(data []byte) (positions, error) {
+	s := &positionScanner{
+		data: data,
+		dec:  json.NewDecoder(bytes.NewReader(data)),
+		pos:  positions{keys: map[string]int{}, values: map[string]int{}},
+	}
+	// Anything after the document is left for json.Unmarshal to report
+	return s.pos, s.value("")
+}
+
+type positionScanner struct {
+	data []byte
+	dec  *json.Decoder
+	pos  positions
+}
+
+// next returns the offset of the next token, skipping the separators
+// the decoder hasn't consumed yet
+func (s *positionScanner) next() int {
+	offset := int(s.dec.InputOffset())
+	for offset < len(s.data) && strings.IndexByte(" \t\r\n,:", s.data[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+func (s *positionScanner) value(path string) error {
+	if path != "" {
+		s.pos.values[path] = s.next()
+	}
+	token, err := s.dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		for s.dec.More() {
+			start := s.next()
+			key, err := s.dec.Token()
+			if err != nil {
+				return err
+			}
+			child := key.(string)
+			if path != "" {
+				child = path + "." + child
+			}
+			s.pos.keys[child] = start
+			if err := s.value(child); err != nil {
+				return err
+			}
+		}
+		_, err = s.dec.Token()
+	case json.Delim('['):
+		for i := 0; s.dec.More(); i++ {
+			if err := s.value(fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		_, err = s.dec.Token()
+	}
+	return err
+}
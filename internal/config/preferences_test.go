@@ -0,0 +1,140 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePreferencesProblems(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		// want holds "line:column: start of the message" for every problem
+		want []string
+	}{
+		{
+			name: "unknown key",
+			data: "{\n  \"version\": 1,\n  \"page_sise\": 20\n}",
+			want: []string{`3:3: unknown key "page_sise"`},
+		},
+		{
+			name: "invalid value",
+			data: "{\n  \"version\": 1,\n  \"page_size\": 0,\n  \"theme\": \"neon\"\n}",
+			want: []string{
+				"3:16: page_size: must be between 1 and 500",
+				`4:12: theme: unknown theme "neon"`,
+			},
+		},
+		{
+			name: "wrong type",
+			data: `{"version": 1, "wrap_width": "wide"}`,
+			want: []string{"1:30: wrap_width: must be a whole number, not a string"},
+		},
+		{
+			name: "unknown keymap action",
+			data: "{\n  \"version\": 1,\n  \"keymap\": {\n    \"compse\": \"c\"\n  }\n}",
+			want: []string{`4:5: unknown action "compse"`},
+		},
+		{
+			name: "invalid key in a list",
+			data: "{\"version\": 1, \"keymap\": {\"up\": [\"up\", \"ctrl+up+k\"]}}",
+			want: []string{`1:40: keymap.up: unknown key "ctrl+up+k"`},
+		},
+		{
+			name: "key bound twice",
+			data: "{\n  \"version\": 1,\n  \"keymap\": {\"reply\": \"c\"}\n}",
+			want: []string{`3:23: key "c" is bound to both compose and reply`},
+		},
+		{
+			name: "syntax error",
+			data: "{\n  \"version\": 1,\n  \"page_size\": 20,\n}",
+			want: []string{"4:1: invalid character '}'"},
+		},
+		{
+			name: "not an object",
+			data: "[1, 2]",
+			want: []string{"1:1: the file must hold a JSON object"},
+		},
+		{
+			name: "newer version",
+			data: `{"version": 99}`,
+			want: []string{"1:13: version 99 is newer"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := parsePreferences("preferences.json", []byte(test.data), nil)
+			var fileErr *FileError
+			if !errors.As(err, &fileErr) {
+				t.Fatalf("got error %v, want a *FileError", err)
+			}
+			if len(fileErr.Problems) != len(test.want) {
+				t.Fatalf("got problems:\n%v\nwant %d", err, len(test.want))
+			}
+			for i, problem := range fileErr.Problems {
+				got := fmt.Sprintf("%d:%d: %s", problem.Line, problem.Column, problem.Message)
+				if !strings.HasPrefix(got, test.want[i]) {
+					t.Errorf("got problem %q, want %q", got, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParsePreferencesKeymap(t *testing.T) {
+	// Outbox actions may share keys with actions of the mail views
+	data := `{"version": 1, "keymap": {"send_now": "c", "compose": ["n", "ctrl+n"]}}`
+	prefs, migrated, err := parsePreferences("preferences.json", []byte(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated {
+		t.Error("current version reported as migrated")
+	}
+	bindings := prefs.Bindings()
+	if got := strings.Join(bindings[ActionCompose], " "); got != "n ctrl+n" {
+		t.Errorf("compose bound to %q", got)
+	}
+	if got := strings.Join(bindings[ActionSendNow], " "); got != "c" {
+		t.Errorf("send_now bound to %q", got)
+	}
+	if got := strings.Join(bindings[ActionQuit], " "); got != "q" {
+		t.Errorf("quit lost its default key: %q", got)
+	}
+}
+
+func TestMigratePreferences(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		legacy *Config
+		delay  time.Duration
+	}{
+		{name: "no file", data: "{}", delay: DefaultSendDelay},
+		{name: "legacy send delay", data: "{}", legacy: &Config{SendDelay: 30}, delay: 30 * time.Second},
+		{name: "legacy delay turned off", data: "{}", legacy: &Config{SendDelay: -1}, delay: 0},
+		{name: "file delay wins", data: `{"send_delay": "5s"}`, legacy: &Config{SendDelay: 30}, delay: 5 * time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prefs, migrated, err := parsePreferences("preferences.json", []byte(test.data), test.legacy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !migrated {
+				t.Error("unversioned file not reported as migrated")
+			}
+			if prefs.Version != PreferencesVersion {
+				t.Errorf("got version %d, want %d", prefs.Version, PreferencesVersion)
+			}
+			if got := prefs.SendDelayDuration(); got != test.delay {
+				t.Errorf("got send delay %s, want %s", got, test.delay)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"os"
+	"time"
+)
+
+// LoadSettings reads the config file to check an edit made while vimail
+// runs. Nothing is migrated or saved and the secrets are not read, so
+// only settings that don't need them can be taken from the result.
+// Mistakes are reported as a *FileError.
+func LoadSettings() (*Config, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, &FileError{Path: configPath, Problems: []Problem{syntaxProblem(data, err)}}
+	}
+
+	var problems []Problem
+	for _, account := range config.Accounts {
+		if err := ValidateAccountName(account.Name); err != nil {
+			problems = append(problems, Problem{Message: err.Error()})
+			continue
+		}
+		for _, identity := range account.Identities {
+			if _, err := mail.ParseAddress(identity.Email); err != nil {
+				problems = append(problems, Problem{
+					Message: fmt.Sprintf("account %s: identity %q is not a valid address", account.Name, identity.Email),
+				})
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return nil, &FileError{Path: configPath, Problems: problems}
+	}
+	return &config, nil
+}
+
+// SettingsContent returns config file data without what vimail writes
+// by itself while running, the tokens and the time of the last save, so
+// those writes aren't mistaken for edits. Data that doesn't parse is
+// returned as it is.
+func SettingsContent(data []byte) []byte {
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return data
+	}
+	config.UpdatedAt = time.Time{}
+	for _, account := range config.Accounts {
+		account.OAuth.Token = nil
+	}
+	content, err := json.Marshal(&config)
+	if err != nil {
+		return data
+	}
+	return content
+}
+
+// UpdateSettings takes the settings of from that can change while
+// vimail runs: the signature, identities and Markdown default. It
+// reports whether any of them changed. The account may be saved with a
+// refreshed token in the background meanwhile, so it holds the lock
+// saves take.
+func (a *Account) UpdateSettings(from *Account) bool {
+	saveMu.Lock()
+	defer saveMu.Unlock()
+
+	changed := a.Signature != from.Signature || a.Markdown != from.Markdown ||
+		len(a.Identities) != len(from.Identities)
+	for i := 0; !changed && i < len(a.Identities); i++ {
+		changed = a.Identities[i] != from.Identities[i]
+	}
+
+	a.Signature = from.Signature
+	a.Identities = from.Identities
+	a.Markdown = from.Markdown
+	return changed
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestSettingsContentIgnoresOwnWrites(t *testing.T) {
+	config := &Config{Accounts: []*Account{{Name: "work", Signature: "Alice"}}}
+	marshal := func() []byte {
+		t.Helper()
+		data, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	before := SettingsContent(marshal())
+
+	// A token refresh and the save time don't count as an edit
+	config.Accounts[0].OAuth.Token = &oauth2.Token{AccessToken: "new", Expiry: time.Now()}
+	config.UpdatedAt = time.Now()
+	if after := SettingsContent(marshal()); !bytes.Equal(before, after) {
+		t.Errorf("token refresh changed the settings content:\n%s\n%s", before, after)
+	}
+
+	config.Accounts[0].Signature = "Alice Example"
+	if after := SettingsContent(marshal()); bytes.Equal(before, after) {
+		t.Error("signature edit left the settings content unchanged")
+	}
+
+	if got := SettingsContent([]byte("{broken")); string(got) != "{broken" {
+		t.Errorf("unparsable data came back as %q", got)
+	}
+}
+
+func TestUpdateSettingsWhileSaving(t *testing.T) {
+	t.Setenv(ConfigEnv, filepath.Join(t.TempDir(), ConfigFileName))
+	account := &Account{Name: "work", Backend: "gmail"}
+	config := &Config{Accounts: []*Account{account}}
+
+	// Run with -race: a token saved in the background marshals the
+	// account while the UI takes reloaded settings into it
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			token := &oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(time.Hour)}
+			if err := config.SaveToken(account, token); err != nil {
+				t.Error(err)
+				return
+			}
+			if err := config.Save(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		account.UpdateSettings(&Account{Signature: "Alice", Identities: []Identity{{Email: "alice@example.com"}}})
+	}
+	wg.Wait()
+}
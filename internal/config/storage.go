@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"vimail/internal/safefile"
 )
 
 // EnsureConfigDir creates the config directory if it doesn't exist
@@ -35,7 +36,7 @@ func BackupConfig() error {
 		return fmt.Errorf("failed to read config for backup: %w", err)
 	}
 
-	err = os.WriteFile(backupPath, data, 0600)
+	err = safefile.WriteFile(backupPath, data, 0600)
 	if err != nil {
 		return fmt.Errorf("failed to write backup: %w", err)
 	}
@@ -61,7 +62,7 @@ func RestoreConfig() error {
 		return fmt.Errorf("failed to read backup: %w", err)
 	}
 
-	err = os.WriteFile(configPath, data, 0600)
+	err = safefile.WriteFile(configPath, data, 0600)
 	if err != nil {
 		return fmt.Errorf("failed to restore config: %w", err)
 	}
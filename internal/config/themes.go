@@ -0,0 +1,62 @@
+package config
+
+import "sort"
+
+// Theme is a color palette for the interface, in hex colors
+type Theme struct {
+	// Text is the main foreground color
+	Text string
+	// Muted is for unselected list items and hints
+	Muted string
+	// Subtle is for borders and header backgrounds
+	Subtle string
+	// Accent highlights the selection
+	Accent string
+	// Selected is the text color on the accent
+	Selected string
+	// Error is for failures and warnings
+	Error string
+	// Background is the terminal background the theme is made for
+	Background string
+}
+
+// Themes are the palettes that can be chosen in the preferences
+var Themes = map[string]Theme{
+	"zen": {
+		Text:       "#ffffff",
+		Muted:      "#888888",
+		Subtle:     "#444444",
+		Accent:     "#5555ff",
+		Selected:   "#ffffff",
+		Error:      "#ff5555",
+		Background: "#000000",
+	},
+	"light": {
+		Text:       "#1a1a1a",
+		Muted:      "#6b6b6b",
+		Subtle:     "#d0d0d0",
+		Accent:     "#2f6fdf",
+		Selected:   "#ffffff",
+		Error:      "#c62828",
+		Background: "#ffffff",
+	},
+	"high-contrast": {
+		Text:       "#ffffff",
+		Muted:      "#d0d0d0",
+		Subtle:     "#808080",
+		Accent:     "#ffff00",
+		Selected:   "#000000",
+		Error:      "#ff0000",
+		Background: "#000000",
+	},
+}
+
+// ThemeNames returns the names of the built-in themes
+func ThemeNames() []string {
+	names := make([]string, 0, len(Themes))
+	for name := range Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
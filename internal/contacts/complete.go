@@ -0,0 +1,150 @@
+package contacts
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// recencyHalfLife is how long it takes for the recency boost of a
+// contact to halve
+const recencyHalfLife = 30 * 24 * time.Hour
+
+// Suggestion is an autocomplete candidate for a recipient field
+type Suggestion struct {
+	Label string
+	Value string
+	Group bool
+	score float64
+}
+
+// Complete returns up to limit suggestions for the partial input, best
+// match first. Contacts are ranked by how well they match, how often
+// we've written to them and how recently.
+func (s *Store) Complete(query string, limit int) []Suggestion {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var suggestions []Suggestion
+
+	for name, members := range s.groups {
+		match := matchScore(query, strings.ToLower(name))
+		if match == 0 {
+			continue
+		}
+		suggestions = append(suggestions, Suggestion{
+			Label: name + " (group, " + pluralize(len(members), "member") + ")",
+			Value: name,
+			Group: true,
+			score: match * 2,
+		})
+	}
+
+	for _, contact := range s.contacts {
+		match := math.Max(
+			matchScore(query, strings.ToLower(contact.Email)),
+			matchScore(query, strings.ToLower(contact.Name)),
+		)
+		if match == 0 {
+			continue
+		}
+		suggestions = append(suggestions, Suggestion{
+			Label: contact.Address(),
+			Value: contact.Address(),
+			score: match * usageWeight(contact, now),
+		})
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		if suggestions[i].score != suggestions[j].score {
+			return suggestions[i].score > suggestions[j].score
+		}
+		return suggestions[i].Label < suggestions[j].Label
+	})
+
+	if limit > 0 && len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// usageWeight boosts contacts we write to often and recently. Addresses
+// we've only seen on incoming mail get a small boost.
+func usageWeight(contact *Contact, now time.Time) float64 {
+	weight := 1.0
+	if contact.TimesSent > 0 {
+		age := now.Sub(contact.LastSent)
+		decay := math.Pow(0.5, age.Hours()/recencyHalfLife.Hours())
+		weight += 2 * math.Log1p(float64(contact.TimesSent)) * (0.25 + decay)
+	}
+	weight += 0.25 * math.Log1p(float64(contact.TimesSeen))
+	return weight
+}
+
+// matchScore rates how well query matches text. Prefixes of the text or
+// of one of its words score highest, then substrings, then fuzzy
+// subsequences with a penalty for gaps. Zero means no match.
+func matchScore(query, text string) float64 {
+	if text == "" {
+		return 0
+	}
+
+	if strings.HasPrefix(text, query) {
+		return 10
+	}
+
+	for _, word := range strings.FieldsFunc(text, isWordSeparator) {
+		if strings.HasPrefix(word, query) {
+			return 8
+		}
+	}
+
+	if strings.Contains(text, query) {
+		return 5
+	}
+
+	// Fuzzy subsequence match
+	gaps := 0
+	pos := 0
+	textRunes := []rune(text)
+	for _, r := range query {
+		found := false
+		for pos < len(textRunes) {
+			if textRunes[pos] == r {
+				found = true
+				pos++
+				break
+			}
+			pos++
+			gaps++
+		}
+		if !found {
+			return 0
+		}
+	}
+
+	return 3 / (1 + float64(gaps)/4)
+}
+
+func isWordSeparator(r rune) bool {
+	switch r {
+	case ' ', '.', '_', '-', '@', '+':
+		return true
+	}
+	return false
+}
+
+func pluralize(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,359 @@
+package contacts
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"vimail/internal/email"
+	"vimail/internal/safefile"
+)
+
+// FileName is the name of the address book in the data directory
+const FileName = "contacts.json"
+
+// Contact is a known correspondent
+type Contact struct {
+	Name      string    `json:"name,omitempty"`
+	Email     string    `json:"email"`
+	TimesSent int       `json:"times_sent,omitempty"`
+	LastSent  time.Time `json:"last_sent,omitempty"`
+	TimesSeen int       `json:"times_seen,omitempty"`
+	LastSeen  time.Time `json:"last_seen,omitempty"`
+}
+
+// Address returns the contact formatted for a recipient header
+func (c *Contact) Address() string {
+	if c.Name == "" {
+		return c.Email
+	}
+	addr := mail.Address{Name: c.Name, Address: c.Email}
+	return addr.String()
+}
+
+// Store is the local address book, persisted as JSON. Several vimail
+// processes may share the file, so each remembers what it changed and
+// Save merges only those changes into what is on disk.
+type Store struct {
+	mu       sync.Mutex
+	path     string
+	contacts map[string]*Contact
+	groups   map[string][]string
+
+	// Contacts and groups changed or removed since the last save
+	changed       map[string]bool
+	changedGroups map[string]bool
+}
+
+type storeFile struct {
+	Contacts []*Contact          `json:"contacts"`
+	Groups   map[string][]string `json:"groups,omitempty"`
+}
+
+// Open loads the address book at path. A missing file yields an empty store.
+func Open(path string) (*Store, error) {
+	contacts, groups, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{
+		path:          path,
+		contacts:      contacts,
+		groups:        groups,
+		changed:       make(map[string]bool),
+		changedGroups: make(map[string]bool),
+	}, nil
+}
+
+// OpenDefault loads the address book from the given data directory
+func OpenDefault(dataDir string) (*Store, error) {
+	return Open(filepath.Join(dataDir, FileName))
+}
+
+// readFile reads the contacts and groups saved at path, keyed by
+// lowercased address and group name
+func readFile(path string) (map[string]*Contact, map[string][]string, error) {
+	contacts := make(map[string]*Contact)
+	groups := make(map[string][]string)
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return contacts, groups, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read contacts: %w", err)
+	}
+
+	var file storeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse contacts: %w", err)
+	}
+
+	for _, contact := range file.Contacts {
+		if contact.Email == "" {
+			continue
+		}
+		contacts[strings.ToLower(contact.Email)] = contact
+	}
+	for name, members := range file.Groups {
+		groups[name] = members
+	}
+	return contacts, groups, nil
+}
+
+// Save writes the address book to disk. The file is locked and read
+// again first, so entries another process saved in the meantime are
+// kept: only the contacts and groups changed here replace theirs, and
+// the store picks up everything else from the file.
+func (s *Store) Save() error {
+	return safefile.Update(s.path, func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		contacts, groups, err := readFile(s.path)
+		if err != nil {
+			return err
+		}
+		for key := range s.changed {
+			if contact, ok := s.contacts[key]; ok {
+				contacts[key] = mergeContact(contacts[key], contact)
+			} else {
+				delete(contacts, key)
+			}
+		}
+		for name := range s.changedGroups {
+			if members, ok := s.groups[name]; ok {
+				groups[name] = append([]string{}, members...)
+			} else {
+				delete(groups, name)
+			}
+		}
+
+		file := storeFile{Groups: groups}
+		for _, contact := range contacts {
+			file.Contacts = append(file.Contacts, contact)
+		}
+		sort.Slice(file.Contacts, func(i, j int) bool {
+			return file.Contacts[i].Email < file.Contacts[j].Email
+		})
+
+		data, err := json.MarshalIndent(file, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal contacts: %w", err)
+		}
+		if err := safefile.WriteFile(s.path, data, 0600); err != nil {
+			return fmt.Errorf("failed to write contacts: %w", err)
+		}
+
+		s.contacts, s.groups = contacts, groups
+		clear(s.changed)
+		clear(s.changedGroups)
+		return nil
+	})
+}
+
+// mergeContact combines a contact changed here with its saved copy,
+// which another process may have updated since it was loaded. Our name
+// wins when there is one; counts and dates keep the higher value.
+func mergeContact(saved, ours *Contact) *Contact {
+	merged := *ours
+	if saved == nil {
+		return &merged
+	}
+	if merged.Name == "" {
+		merged.Name = saved.Name
+	}
+	merged.TimesSent = max(merged.TimesSent, saved.TimesSent)
+	merged.TimesSeen = max(merged.TimesSeen, saved.TimesSeen)
+	if saved.LastSent.After(merged.LastSent) {
+		merged.LastSent = saved.LastSent
+	}
+	if saved.LastSeen.After(merged.LastSeen) {
+		merged.LastSeen = saved.LastSeen
+	}
+	return &merged
+}
+
+// upsert returns the contact for an address, creating it if needed and
+// filling in a missing display name. The contact is saved on the next
+// Save.
+func (s *Store) upsert(addr *mail.Address) *Contact {
+	key := strings.ToLower(strings.TrimSpace(addr.Address))
+	s.changed[key] = true
+	contact, ok := s.contacts[key]
+	if !ok {
+		contact = &Contact{Email: strings.TrimSpace(addr.Address)}
+		s.contacts[key] = contact
+	}
+	if contact.Name == "" && addr.Name != "" {
+		contact.Name = addr.Name
+	}
+	return contact
+}
+
+// Add inserts or updates a contact without touching its usage counts
+func (s *Store) Add(name, email string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	contact := s.upsert(&mail.Address{Name: name, Address: email})
+	if name != "" {
+		contact.Name = name
+	}
+}
+
+// Remove deletes a contact by address
+func (s *Store) Remove(email string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := strings.ToLower(email)
+	if _, ok := s.contacts[key]; !ok {
+		return false
+	}
+	delete(s.contacts, key)
+	s.changed[key] = true
+	return true
+}
+
+// ObserveSeen records addresses found on a fetched message. Messages
+// older than the last one seen from a contact are not counted again, so
+// refetching the same messages doesn't inflate the counts.
+func (s *Store) ObserveSeen(addrs []*mail.Address, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, addr := range addrs {
+		if addr.Address == "" {
+			continue
+		}
+		contact := s.upsert(addr)
+		if !at.After(contact.LastSeen) {
+			continue
+		}
+		contact.TimesSeen++
+		contact.LastSeen = at
+	}
+}
+
+// ObserveMessages records the participants of fetched messages, oldest
+// first, skipping our own addresses
+func (s *Store) ObserveMessages(messages []*email.Message, own []string) {
+	sorted := append([]*email.Message{}, messages...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Date.Before(sorted[j].Date)
+	})
+
+	for _, message := range sorted {
+		var addrs []*mail.Address
+		for _, addr := range message.Participants() {
+			if !containsFold(own, addr.Address) {
+				addrs = append(addrs, addr)
+			}
+		}
+		s.ObserveSeen(addrs, message.Date)
+	}
+}
+
+func containsFold(list []string, item string) bool {
+	for _, entry := range list {
+		if strings.EqualFold(entry, item) {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordSent records that we wrote to the given addresses
+func (s *Store) RecordSent(addrs []*mail.Address, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, addr := range addrs {
+		if addr.Address == "" {
+			continue
+		}
+		contact := s.upsert(addr)
+		contact.TimesSent++
+		if at.After(contact.LastSent) {
+			contact.LastSent = at
+		}
+	}
+}
+
+// Contacts returns all contacts sorted by address
+func (s *Store) Contacts() []Contact {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Contact, 0, len(s.contacts))
+	for _, contact := range s.contacts {
+		list = append(list, *contact)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Email < list[j].Email
+	})
+	return list
+}
+
+// SetGroup defines a named group of addresses, replacing any existing
+// group with the same name
+func (s *Store) SetGroup(name string, members []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.groups[name] = append([]string{}, members...)
+	s.changedGroups[name] = true
+}
+
+// RemoveGroup deletes a named group
+func (s *Store) RemoveGroup(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.groups[name]; !ok {
+		return false
+	}
+	delete(s.groups, name)
+	s.changedGroups[name] = true
+	return true
+}
+
+// Groups returns a copy of the named groups
+func (s *Store) Groups() map[string][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	groups := make(map[string][]string, len(s.groups))
+	for name, members := range s.groups {
+		groups[name] = append([]string{}, members...)
+	}
+	return groups
+}
+
+// ExpandGroup returns the recipient list a group expands to, using the
+// stored display names where known
+func (s *Store) ExpandGroup(name string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	members, ok := s.groups[name]
+	if !ok {
+		return "", false
+	}
+
+	addrs := make([]string, 0, len(members))
+	for _, member := range members {
+		if contact, ok := s.contacts[strings.ToLower(member)]; ok {
+			addrs = append(addrs, contact.Address())
+		} else {
+			addrs = append(addrs, member)
+		}
+	}
+	return strings.Join(addrs, ", "), true
+}
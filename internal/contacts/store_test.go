@@ -0,0 +1,87 @@
+package contacts
+
+import (
+	"net/mail"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveKeepsContactsSavedElsewhere(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	app, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Add("Old Friend", "old@example.com")
+	app.SetGroup("team", []string{"old@example.com"})
+	if err := app.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// vimail contacts import runs while the app keeps its store open
+	cli, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.Add("Imported", "new@example.com")
+	cli.SetGroup("friends", []string{"new@example.com"})
+	cli.RemoveGroup("team")
+	if err := cli.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	app.RecordSent([]*mail.Address{{Address: "old@example.com"}}, time.Now())
+	if err := app.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := reopened.Contacts()
+	if len(list) != 2 || list[0].Email != "new@example.com" || list[1].Email != "old@example.com" {
+		t.Fatalf("contacts after both saves: %+v", list)
+	}
+	if list[1].TimesSent != 1 {
+		t.Errorf("sent count not saved: %+v", list[1])
+	}
+	groups := reopened.Groups()
+	if _, ok := groups["team"]; ok {
+		t.Errorf("removed group came back: %v", groups)
+	}
+	if _, ok := groups["friends"]; !ok {
+		t.Errorf("group saved elsewhere was dropped: %v", groups)
+	}
+
+	// The app's store picks up the import too
+	if len(app.Contacts()) != 2 {
+		t.Errorf("store not refreshed from the file: %+v", app.Contacts())
+	}
+}
+
+func TestSaveRemovesContacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Add("", "a@example.com")
+	store.Add("", "b@example.com")
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+	store.Remove("a@example.com")
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list := reopened.Contacts(); len(list) != 1 || list[0].Email != "b@example.com" {
+		t.Fatalf("contacts after removal: %+v", list)
+	}
+}
@@ -0,0 +1,100 @@
+package contacts
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseVCards reads contacts from vCard 2.1/3.0/4.0 data. Each EMAIL
+// property becomes its own contact sharing the card's formatted name.
+func ParseVCards(r io.Reader) ([]Contact, error) {
+	lines, err := unfoldLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Contact
+	var name string
+	var emails []string
+	inCard := false
+
+	for _, line := range lines {
+		prop, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+
+		// Strip parameters and group prefixes such as "item1.EMAIL;TYPE=work"
+		params := strings.Split(prop, ";")
+		key := strings.ToUpper(params[0])
+		if idx := strings.LastIndex(key, "."); idx >= 0 {
+			key = key[idx+1:]
+		}
+
+		switch key {
+		case "BEGIN":
+			if strings.EqualFold(value, "VCARD") {
+				inCard = true
+				name = ""
+				emails = nil
+			}
+		case "END":
+			if strings.EqualFold(value, "VCARD") && inCard {
+				for _, email := range emails {
+					result = append(result, Contact{Name: name, Email: email})
+				}
+				inCard = false
+			}
+		case "FN":
+			name = unescapeValue(value)
+		case "N":
+			// Only used when the card has no FN
+			if name == "" {
+				parts := strings.Split(value, ";")
+				if len(parts) >= 2 {
+					name = strings.TrimSpace(unescapeValue(parts[1]) + " " + unescapeValue(parts[0]))
+				}
+			}
+		case "EMAIL":
+			email := strings.TrimSpace(strings.TrimPrefix(value, "mailto:"))
+			if email != "" {
+				emails = append(emails, email)
+			}
+		}
+	}
+
+	if inCard {
+		return result, fmt.Errorf("unterminated vCard")
+	}
+
+	return result, nil
+}
+
+// unfoldLines joins continuation lines, which start with a space or tab
+func unfoldLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read vCard: %w", err)
+	}
+	return lines, nil
+}
+
+// unescapeValue reverses vCard text escaping
+func unescapeValue(value string) string {
+	replacer := strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\N`, " ", `\\`, `\`)
+	return strings.TrimSpace(replacer.Replace(value))
+}
@@ -2,7 +2,9 @@ package email
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"strings"
 
 	"golang.org/x/oauth2"
 	"google.golang.org/api/gmail/v1"
@@ -13,20 +15,13 @@ import (
 type Client struct {
 	service   *gmail.Service
 	userEmail string
+	security  *Security
 }
 
-// NewClient creates a new email client with the provided OAuth token
-func NewClient(ctx context.Context, token *oauth2.Token, clientID, clientSecret string) (*Client, error) {
-	config := &oauth2.Config{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		Endpoint: oauth2.Endpoint{
-			AuthURL:  "https://accounts.google.com/o/oauth2/auth",
-			TokenURL: "https://oauth2.googleapis.com/token",
-		},
-	}
-
-	httpClient := config.Client(ctx, token)
+// NewClient creates a new email client that authenticates with tokens
+// from source, which can be an OAuth token source or a service account
+func NewClient(ctx context.Context, source oauth2.TokenSource) (*Client, error) {
+	httpClient := oauth2.NewClient(ctx, source)
 
 	service, err := gmail.NewService(ctx, option.WithHTTPClient(httpClient))
 	if err != nil {
@@ -47,6 +42,16 @@ func NewClient(ctx context.Context, token *oauth2.Token, clientID, clientSecret
 	return client, nil
 }
 
+// SetSecurity sets the keys used for signing, encryption and verification
+func (c *Client) SetSecurity(security *Security) {
+	c.security = security
+}
+
+// Security returns the keys used for signing, encryption and verification
+func (c *Client) Security() *Security {
+	return c.security
+}
+
 // GetUserEmail returns the authenticated user's email address
 func (c *Client) GetUserEmail() string {
 	return c.userEmail
@@ -109,12 +114,24 @@ func (c *Client) GetMessage(ctx context.Context, messageID string) (*Message, er
 }
 
 // SendMessage sends an email message
-func (c *Client) SendMessage(ctx context.Context, to, subject, body string) error {
+func (c *Client) SendMessage(ctx context.Context, data *ComposeData) error {
+	from := data.From
+	if from == "" {
+		from = c.userEmail
+	}
+
+	encoded := *data
+	encoded.From = from
+	raw, err := encodeMessage(&encoded, c.security)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
 	message := &gmail.Message{
-		Raw: encodeMessage(c.userEmail, to, subject, body),
+		Raw: raw,
 	}
 
-	_, err := c.service.Users.Messages.Send("me", message).
+	_, err = c.service.Users.Messages.Send("me", message).
 		Context(ctx).
 		Do()
 	if err != nil {
@@ -124,6 +141,76 @@ func (c *Client) SendMessage(ctx context.Context, to, subject, body string) erro
 	return nil
 }
 
+// GetRawMessage retrieves the full RFC 822 source of a message
+func (c *Client) GetRawMessage(ctx context.Context, messageID string) ([]byte, error) {
+	gmailMsg, err := c.service.Users.Messages.Get("me", messageID).
+		Format("raw").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get raw message: %w", err)
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(gmailMsg.Raw, "="))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode raw message: %w", err)
+	}
+
+	return raw, nil
+}
+
+// ProcessSecurity decrypts and verifies a message if it is encrypted or
+// signed, returning the message unchanged otherwise
+func (c *Client) ProcessSecurity(ctx context.Context, msg *Message) (*Message, error) {
+	if !NeedsSecurity(msg) {
+		return msg, nil
+	}
+
+	raw, err := c.GetRawMessage(ctx, msg.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.security.Process(msg, raw), nil
+}
+
+// SendAs describes an address the account is allowed to send from
+type SendAs struct {
+	Email     string
+	Name      string
+	IsDefault bool
+}
+
+// ListSendAs retrieves the verified send-as aliases of the account,
+// with the default alias first
+func (c *Client) ListSendAs(ctx context.Context) ([]SendAs, error) {
+	resp, err := c.service.Users.Settings.SendAs.List("me").Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list send-as aliases: %w", err)
+	}
+
+	var aliases []SendAs
+	for _, alias := range resp.SendAs {
+		// Pending aliases can't be used as a From address yet
+		if !alias.IsPrimary && alias.VerificationStatus != "accepted" {
+			continue
+		}
+
+		entry := SendAs{
+			Email:     alias.SendAsEmail,
+			Name:      alias.DisplayName,
+			IsDefault: alias.IsDefault,
+		}
+		if entry.IsDefault {
+			aliases = append([]SendAs{entry}, aliases...)
+		} else {
+			aliases = append(aliases, entry)
+		}
+	}
+
+	return aliases, nil
+}
+
 // GetInboxMessages retrieves messages from the inbox
 func (c *Client) GetInboxMessages(ctx context.Context, maxResults int64) ([]*Message, error) {
 	return c.ListMessages(ctx, "INBOX", maxResults)
@@ -134,6 +221,15 @@ func (c *Client) GetSentMessages(ctx context.Context, maxResults int64) ([]*Mess
 	return c.ListMessages(ctx, "SENT", maxResults)
 }
 
+// UnreadCount returns the number of unread messages in the inbox
+func (c *Client) UnreadCount(ctx context.Context) (int64, error) {
+	label, err := c.service.Users.Labels.Get("me", "INBOX").Context(ctx).Do()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get inbox label: %w", err)
+	}
+	return label.MessagesUnread, nil
+}
+
 // TestConnection verifies the Gmail API connection
 func (c *Client) TestConnection(ctx context.Context) error {
 	_, err := c.service.Users.GetProfile("me").Context(ctx).Do()
@@ -10,9 +10,20 @@ import (
 
 // ComposeData holds the data for composing an email
 type ComposeData struct {
+	From    string
 	To      string
 	Subject string
 	Body    string
+
+	// Markdown sends the body as text/plain plus rendered text/html
+	Markdown bool
+
+	// PGPSign and PGPEncrypt wrap the body as PGP/MIME
+	PGPSign    bool
+	PGPEncrypt bool
+
+	// SMIMESign signs the body as S/MIME multipart/signed
+	SMIMESign bool
 }
 
 // Validate checks if the compose data is valid
@@ -22,7 +33,7 @@ func (c *ComposeData) Validate() error {
 	}
 
 	// Validate email address format
-	if _, err := mail.ParseAddress(c.To); err != nil {
+	if _, err := c.Recipients(); err != nil {
 		return fmt.Errorf("invalid email address: %s", c.To)
 	}
 
@@ -37,25 +48,112 @@ func (c *ComposeData) Validate() error {
 	return nil
 }
 
+// Recipients parses the comma-separated To field
+func (c *ComposeData) Recipients() ([]*mail.Address, error) {
+	return mail.ParseAddressList(c.To)
+}
+
+// buildBody returns the MIME entity for the message body
+func buildBody(data *ComposeData) (mimePart, error) {
+	plain := textPart("text/plain", data.Body)
+	if !data.Markdown {
+		return plain, nil
+	}
+
+	rendered, err := RenderMarkdown(data.Body)
+	if err != nil {
+		return mimePart{}, err
+	}
+
+	return multipartPart("alternative", nil, plain, textPart("text/html", rendered)), nil
+}
+
 // encodeMessage creates a base64-encoded email message for Gmail API
-func encodeMessage(from, to, subject, body string) string {
+func encodeMessage(data *ComposeData, security *Security) (string, error) {
+	body, err := buildBody(data)
+	if err != nil {
+		return "", err
+	}
+
+	if (data.PGPSign || data.PGPEncrypt) && data.SMIMESign {
+		return "", fmt.Errorf("a message can't use both OpenPGP and S/MIME")
+	}
+
+	if data.PGPSign || data.PGPEncrypt {
+		body, err = security.wrapPGP(data, body)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if data.SMIMESign {
+		body, err = security.wrapSMIME(data, body)
+		if err != nil {
+			return "", err
+		}
+	}
+
 	// Create email headers
 	headers := []string{
-		fmt.Sprintf("From: %s", from),
-		fmt.Sprintf("To: %s", to),
-		fmt.Sprintf("Subject: %s", subject),
+		fmt.Sprintf("From: %s", data.From),
+		fmt.Sprintf("To: %s", data.To),
+		fmt.Sprintf("Subject: %s", encodeHeaderValue(data.Subject)),
 		fmt.Sprintf("Date: %s", time.Now().Format(time.RFC1123Z)),
 		"MIME-Version: 1.0",
-		"Content-Type: text/plain; charset=UTF-8",
-		"Content-Transfer-Encoding: 8bit",
-		"",
 	}
+	headers = append(headers, body.headers...)
 
 	// Combine headers and body
-	message := strings.Join(headers, "\r\n") + body
+	message := strings.Join(headers, "\r\n") + "\r\n\r\n" + string(body.body)
 
 	// Encode as base64 URL-safe
-	return base64.URLEncoding.EncodeToString([]byte(message))
+	return base64.URLEncoding.EncodeToString([]byte(message)), nil
+}
+
+// SignatureSeparator is the standard line that introduces a signature
+const SignatureSeparator = "-- "
+
+// FormatSignature returns the signature block to append to a body,
+// or an empty string when there is no signature
+func FormatSignature(signature string) string {
+	signature = strings.TrimRight(signature, "\n")
+	if strings.TrimSpace(signature) == "" {
+		return ""
+	}
+	return SignatureSeparator + "\n" + signature
+}
+
+// QuoteForReply formats the original message as a quoted attribution
+// block for a reply
+func QuoteForReply(original *Message) string {
+	var lines []string
+	lines = append(lines, fmt.Sprintf("On %s, %s wrote:",
+		original.Date.Format("Mon, 2 Jan 2006 at 15:04"), original.From))
+
+	for _, line := range strings.Split(strings.TrimRight(original.Body, "\n"), "\n") {
+		if strings.HasPrefix(line, ">") {
+			lines = append(lines, ">"+line)
+		} else {
+			lines = append(lines, "> "+line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// FormatForwardBody formats the original message as a forwarded block
+func FormatForwardBody(original *Message) string {
+	lines := []string{
+		"---------- Forwarded message ---------",
+		"From: " + original.From,
+		"Date: " + original.Date.Format(time.RFC1123Z),
+		"Subject: " + original.Subject,
+		"To: " + original.To,
+		"",
+		original.Body,
+	}
+
+	return strings.Join(lines, "\n")
 }
 
 // FormatBodyForDisplay prepares body text for display in the compose view
@@ -0,0 +1,58 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+// IsRetryable reports whether a failed API call may succeed if it is
+// simply tried again later: network failures, timeouts, rate limiting
+// and server errors. Anything else, such as an invalid recipient or a
+// message we can't encode, needs the user to change something.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code >= http.StatusInternalServerError || apiErr.Code == http.StatusTooManyRequests
+	}
+
+	// A revoked or invalid token comes back as a token endpoint error.
+	// A revoked refresh token is worth retrying too: the message can go
+	// out as it is once the user logs in again.
+	var tokenErr *oauth2.RetrieveError
+	if errors.As(err, &tokenErr) {
+		if tokenErr.ErrorCode == "invalid_grant" {
+			return true
+		}
+		return tokenErr.Response != nil && tokenErr.Response.StatusCode >= http.StatusInternalServerError
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ENETUNREACH) ||
+		errors.Is(err, syscall.EHOSTUNREACH) {
+		return true
+	}
+
+	// url.Error is itself a net.Error, so look at what it wraps
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
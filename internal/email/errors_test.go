@@ -0,0 +1,56 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tokenError := func(status int, code string) error {
+		return &oauth2.RetrieveError{Response: &http.Response{StatusCode: status}, ErrorCode: code}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "no error", err: nil, want: false},
+		{name: "server error", err: &googleapi.Error{Code: http.StatusServiceUnavailable}, want: true},
+		{name: "rate limited", err: &googleapi.Error{Code: http.StatusTooManyRequests}, want: true},
+		{name: "wrapped server error", err: fmt.Errorf("failed to send: %w", &googleapi.Error{Code: http.StatusInternalServerError}), want: true},
+		{name: "bad request", err: &googleapi.Error{Code: http.StatusBadRequest}, want: false},
+		{name: "forbidden", err: &googleapi.Error{Code: http.StatusForbidden}, want: false},
+		{name: "revoked refresh token", err: tokenError(http.StatusBadRequest, "invalid_grant"), want: true},
+		{name: "token endpoint down", err: tokenError(http.StatusBadGateway, ""), want: true},
+		{name: "invalid client", err: tokenError(http.StatusUnauthorized, "invalid_client"), want: false},
+		{name: "token error without response", err: &oauth2.RetrieveError{}, want: false},
+		{name: "deadline", err: fmt.Errorf("send: %w", context.DeadlineExceeded), want: true},
+		{name: "cancelled", err: context.Canceled, want: false},
+		{name: "connection dropped", err: io.ErrUnexpectedEOF, want: true},
+		{name: "connection refused", err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, want: true},
+		{name: "connection reset", err: syscall.ECONNRESET, want: true},
+		{name: "host unreachable", err: syscall.EHOSTUNREACH, want: true},
+		{name: "DNS failure", err: &url.Error{Op: "Post", URL: "https://gmail.googleapis.com", Err: &net.DNSError{Err: "no such host"}}, want: true},
+		{name: "request that can't be built", err: &url.Error{Op: "Post", URL: "%", Err: errors.New("invalid URL escape")}, want: false},
+		{name: "encoding failure", err: errors.New("failed to encode message"), want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsRetryable(test.err); got != test.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", test.err, got, test.want)
+			}
+		})
+	}
+}
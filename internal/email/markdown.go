@@ -0,0 +1,38 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+// markdown renders GitHub-flavoured Markdown. Raw HTML in the source is
+// omitted and dangerous link schemes are dropped, so the output is safe
+// to send as-is.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithRendererOptions(html.WithHardWraps()),
+)
+
+// RenderMarkdown converts a Markdown body into a complete HTML document
+func RenderMarkdown(text string) (string, error) {
+	var buf bytes.Buffer
+	buf.WriteString("<!DOCTYPE html>\n<html>\n<head><meta charset=\"UTF-8\"></head>\n<body>\n")
+	if err := markdown.Convert([]byte(text), &buf); err != nil {
+		return "", fmt.Errorf("failed to render markdown: %w", err)
+	}
+	buf.WriteString("</body>\n</html>\n")
+	return buf.String(), nil
+}
+
+// ParseMarkdown parses a Markdown body the way RenderMarkdown reads it.
+// Text in the returned tree refers to the returned source.
+func ParseMarkdown(body string) (ast.Node, []byte) {
+	source := []byte(body)
+	return markdown.Parser().Parse(text.NewReader(source)), source
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"mime"
+	"net/mail"
 	"regexp"
 	"strings"
 	"time"
@@ -17,12 +18,22 @@ type Message struct {
 	ThreadID  string
 	From      string
 	To        string
+	Cc        string
 	Subject   string
 	Date      time.Time
 	Body      string
 	Snippet   string
 	Labels    []string
 	Unread    bool
+	MimeType  string
+	Security  *SecurityStatus
+
+	// Account names the account the message was fetched from, for
+	// callers that show several mailboxes together
+	Account string
+
+	// Raw address headers, kept so every participant can be recovered
+	addressHeaders map[string]string
 }
 
 // NewMessageFromGmail creates a Message from a Gmail API message
@@ -33,6 +44,7 @@ func NewMessageFromGmail(gmailMsg *gmail.Message) (*Message, error) {
 		Snippet:  gmailMsg.Snippet,
 		Labels:   gmailMsg.LabelIds,
 		Unread:   contains(gmailMsg.LabelIds, "UNREAD"),
+		MimeType: strings.ToLower(gmailMsg.Payload.MimeType),
 	}
 
 	// Parse headers
@@ -50,12 +62,18 @@ func NewMessageFromGmail(gmailMsg *gmail.Message) (*Message, error) {
 
 // parseHeaders extracts relevant information from email headers
 func (m *Message) parseHeaders(headers []*gmail.MessagePartHeader) error {
+	m.addressHeaders = make(map[string]string)
 	for _, header := range headers {
 		switch strings.ToLower(header.Name) {
 		case "from":
 			m.From = cleanEmailAddress(header.Value)
+			m.addressHeaders["from"] = header.Value
 		case "to":
 			m.To = cleanEmailAddress(header.Value)
+			m.addressHeaders["to"] = header.Value
+		case "cc":
+			m.Cc = cleanEmailAddress(header.Value)
+			m.addressHeaders["cc"] = header.Value
 		case "subject":
 			decoded, err := decodeHeader(header.Value)
 			if err != nil {
@@ -179,6 +197,43 @@ func cleanEmailAddress(addr string) string {
 	return strings.TrimSpace(addr)
 }
 
+// AddressList parses every address in the named header (from, to or cc).
+// Entries that can't be parsed are skipped.
+func (m *Message) AddressList(header string) []*mail.Address {
+	value := m.addressHeaders[strings.ToLower(header)]
+	if value == "" {
+		return nil
+	}
+
+	parser := mail.AddressParser{WordDecoder: new(mime.WordDecoder)}
+	if addrs, err := parser.ParseList(value); err == nil {
+		return addrs
+	}
+
+	// Fall back to one address at a time for partially broken headers
+	var addrs []*mail.Address
+	for _, part := range strings.Split(value, ",") {
+		if addr, err := parser.Parse(strings.TrimSpace(part)); err == nil {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// Participants returns the From, To and Cc addresses of the message
+func (m *Message) Participants() []*mail.Address {
+	var addrs []*mail.Address
+	for _, header := range []string{"from", "to", "cc"} {
+		addrs = append(addrs, m.AddressList(header)...)
+	}
+	return addrs
+}
+
+// Recipients returns the To and Cc addresses of the message
+func (m *Message) Recipients() []*mail.Address {
+	return append(m.AddressList("to"), m.AddressList("cc")...)
+}
+
 // decodeHeader decodes MIME encoded headers
 func decodeHeader(header string) (string, error) {
 	dec := new(mime.WordDecoder)
@@ -0,0 +1,261 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+)
+
+// mimePart is a MIME entity: its header lines and its encoded body. The
+// bytes are built once so a signature computed over a part matches the
+// part that is sent.
+type mimePart struct {
+	headers []string
+	body    []byte
+}
+
+// Bytes returns the part as it appears on the wire
+func (p mimePart) Bytes() []byte {
+	var buf bytes.Buffer
+	for _, header := range p.headers {
+		buf.WriteString(header)
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString("\r\n")
+	buf.Write(p.body)
+	return buf.Bytes()
+}
+
+// textPart encodes text as a quoted-printable part of the given type,
+// such as "text/plain" or "text/html"
+func textPart(mediaType, text string) mimePart {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\n", "\r\n")
+
+	var buf bytes.Buffer
+	writer := quotedprintable.NewWriter(&buf)
+	writer.Write([]byte(text))
+	writer.Close()
+
+	return mimePart{
+		headers: []string{
+			fmt.Sprintf("Content-Type: %s; charset=UTF-8", mediaType),
+			"Content-Transfer-Encoding: quoted-printable",
+		},
+		body: buf.Bytes(),
+	}
+}
+
+// base64Lines encodes binary data as base64 wrapped at 76 characters
+func base64Lines(data []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var buf bytes.Buffer
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
+
+// multipartPart combines parts into a multipart entity. Extra Content-Type
+// parameters such as the protocol of multipart/signed go in params.
+func multipartPart(subtype string, params map[string]string, parts ...mimePart) mimePart {
+	boundary := randomBoundary()
+
+	contentParams := map[string]string{"boundary": boundary}
+	for key, value := range params {
+		contentParams[key] = value
+	}
+
+	var buf bytes.Buffer
+	for _, part := range parts {
+		buf.WriteString("--" + boundary + "\r\n")
+		buf.Write(part.Bytes())
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString("--" + boundary + "--\r\n")
+
+	return mimePart{
+		headers: []string{
+			"Content-Type: " + mime.FormatMediaType("multipart/"+subtype, contentParams),
+		},
+		body: buf.Bytes(),
+	}
+}
+
+// randomBoundary returns a multipart boundary that won't occur in content
+func randomBoundary() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return "vimail-" + hex.EncodeToString(b[:])
+}
+
+// encodeHeaderValue Q-encodes a header value when it isn't plain ASCII
+func encodeHeaderValue(value string) string {
+	return mime.QEncoding.Encode("UTF-8", value)
+}
+
+// normalizeCRLF converts every line ending to CRLF, as MIME signatures
+// are computed over canonical line endings
+func normalizeCRLF(data []byte) []byte {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
+
+// splitEntity separates the header block of a raw MIME entity from its
+// body and parses the header
+func splitEntity(raw []byte) (textproto.MIMEHeader, []byte, error) {
+	raw = normalizeCRLF(raw)
+
+	var headerBytes, body []byte
+	if bytes.HasPrefix(raw, []byte("\r\n")) {
+		body = raw[2:]
+	} else if idx := bytes.Index(raw, []byte("\r\n\r\n")); idx >= 0 {
+		headerBytes = raw[:idx+2]
+		body = raw[idx+4:]
+	} else {
+		headerBytes = raw
+	}
+
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(append(headerBytes, '\r', '\n'))))
+	header, err := reader.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return nil, nil, fmt.Errorf("failed to parse MIME header: %w", err)
+	}
+	return header, body, nil
+}
+
+// splitMultipart returns the raw bytes of each part of a multipart body,
+// exactly as they appear between the boundary delimiters
+func splitMultipart(body []byte, boundary string) ([][]byte, error) {
+	delimiter := []byte("--" + boundary)
+	body = normalizeCRLF(body)
+
+	var parts [][]byte
+	start := -1
+	pos := 0
+	for pos <= len(body) {
+		idx := bytes.Index(body[pos:], delimiter)
+		if idx < 0 {
+			break
+		}
+		idx += pos
+
+		// Delimiters only count at the start of a line
+		if idx > 0 && body[idx-1] != '\n' {
+			pos = idx + len(delimiter)
+			continue
+		}
+
+		if start >= 0 {
+			end := idx
+			if end >= 2 && body[end-2] == '\r' && body[end-1] == '\n' {
+				end -= 2
+			}
+			parts = append(parts, body[start:end])
+		}
+
+		after := body[idx+len(delimiter):]
+		if bytes.HasPrefix(after, []byte("--")) {
+			return parts, nil
+		}
+
+		lineEnd := bytes.Index(after, []byte("\r\n"))
+		if lineEnd < 0 {
+			break
+		}
+		start = idx + len(delimiter) + lineEnd + 2
+		pos = start
+	}
+
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("no parts found for boundary %q", boundary)
+	}
+	return parts, nil
+}
+
+// decodeTransfer undoes the Content-Transfer-Encoding of a part body
+func decodeTransfer(header textproto.MIMEHeader, body []byte) []byte {
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "quoted-printable":
+		decoded, err := io.ReadAll(quotedprintable.NewReader(bytes.NewReader(body)))
+		if err == nil {
+			return decoded
+		}
+	case "base64":
+		cleaned := bytes.Map(func(r rune) rune {
+			if r == '\r' || r == '\n' || r == ' ' {
+				return -1
+			}
+			return r
+		}, body)
+		decoded, err := base64.StdEncoding.DecodeString(string(cleaned))
+		if err == nil {
+			return decoded
+		}
+	}
+	return body
+}
+
+// entityText extracts readable text from a raw MIME entity, preferring
+// text/plain alternatives and descending into nested multiparts
+func entityText(raw []byte) string {
+	header, body, err := splitEntity(raw)
+	if err != nil {
+		return string(raw)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		parts, err := splitMultipart(body, params["boundary"])
+		if err != nil {
+			return ""
+		}
+
+		switch mediaType {
+		case "multipart/alternative":
+			var fallback string
+			for _, part := range parts {
+				partHeader, _, _ := splitEntity(part)
+				partType, _, _ := mime.ParseMediaType(partHeader.Get("Content-Type"))
+				if partType == "text/plain" || partType == "" {
+					return entityText(part)
+				}
+				if fallback == "" {
+					fallback = entityText(part)
+				}
+			}
+			return fallback
+		case "multipart/signed":
+			return entityText(parts[0])
+		default:
+			var texts []string
+			for _, part := range parts {
+				if text := entityText(part); text != "" {
+					texts = append(texts, text)
+				}
+			}
+			return strings.Join(texts, "\n\n")
+		}
+	}
+
+	if !strings.HasPrefix(mediaType, "text/") {
+		return ""
+	}
+
+	text := strings.ReplaceAll(string(decodeTransfer(header, body)), "\r\n", "\n")
+	return processBodyContent(text, mediaType)
+}
@@ -0,0 +1,534 @@
+package email
+
+import (
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+	"time"
+	"vimail/internal/pgp"
+	"vimail/internal/smime"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// Security holds the keys used to sign, encrypt, decrypt and verify mail
+type Security struct {
+	PGP   *pgp.Keyring
+	SMIME *smime.Store
+}
+
+// SecurityStatus describes the result of decrypting or verifying a message
+type SecurityStatus struct {
+	Kind      string
+	Encrypted bool
+	Signed    bool
+	Verified  bool
+	Signer    string
+	Validity  string
+	Error     string
+	// Partial is set when the body has text outside the signed or
+	// encrypted block
+	Partial bool
+}
+
+// Summary returns a one-line description for the reader status line
+func (s *SecurityStatus) Summary() string {
+	var parts []string
+	if s.Encrypted {
+		parts = append(parts, "🔒 Decrypted")
+	}
+
+	switch {
+	case s.Signed && s.Verified:
+		parts = append(parts, "✓ Good signature from "+s.Signer)
+	case s.Signed:
+		parts = append(parts, "✗ Unverified signature: "+s.Error)
+	case s.Error != "":
+		parts = append(parts, "✗ "+s.Error)
+	}
+	if s.Validity != "" {
+		parts = append(parts, s.Validity)
+	}
+	if s.Partial {
+		parts = append(parts, "⚠ Parts of the message are not covered")
+	}
+
+	summary := strings.Join(parts, " • ")
+	if s.Kind == "" {
+		return summary
+	}
+	return s.Kind + ": " + summary
+}
+
+const (
+	pgpMessageMarker    = "-----BEGIN PGP MESSAGE-----"
+	pgpMessageEnd       = "-----END PGP MESSAGE-----"
+	pgpSignedMarker     = "-----BEGIN PGP SIGNED MESSAGE-----"
+	pgpSignatureEnd     = "-----END PGP SIGNATURE-----"
+	unverifiedTextStart = "----- Unverified text, not part of the OpenPGP block -----"
+	unverifiedTextEnd   = "----- End of unverified text -----"
+)
+
+// NeedsSecurity reports whether a message is encrypted or signed in a
+// way the reader should process
+func NeedsSecurity(msg *Message) bool {
+	switch msg.MimeType {
+	case "multipart/encrypted", "multipart/signed",
+		"application/pkcs7-mime", "application/x-pkcs7-mime":
+		return true
+	}
+	return strings.Contains(msg.Body, pgpMessageMarker) ||
+		strings.Contains(msg.Body, pgpSignedMarker)
+}
+
+// Process decrypts and verifies a message given its raw RFC 822 source.
+// It returns a copy with the readable body and a security status.
+func (s *Security) Process(msg *Message, raw []byte) *Message {
+	processed := *msg
+	header, body, err := splitEntity(raw)
+	if err != nil {
+		processed.Security = &SecurityStatus{Error: err.Error()}
+		return &processed
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	protocol := strings.ToLower(params["protocol"])
+
+	switch {
+	case mediaType == "multipart/encrypted" && protocol == "application/pgp-encrypted":
+		s.processPGPMIMEEncrypted(&processed, body, params["boundary"])
+	case mediaType == "multipart/signed" && protocol == "application/pgp-signature":
+		s.processPGPMIMESigned(&processed, body, params["boundary"])
+	case mediaType == "multipart/signed" && isSMIMESignature(protocol):
+		s.processSMIMESigned(&processed, body, params["boundary"])
+	case isSMIMEMime(mediaType):
+		s.processSMIMEMime(&processed, decodeTransfer(header, body))
+	case strings.Contains(msg.Body, pgpMessageMarker) || strings.Contains(msg.Body, pgpSignedMarker):
+		s.processInlinePGP(&processed)
+	}
+
+	return &processed
+}
+
+func isSMIMESignature(mediaType string) bool {
+	return mediaType == "application/pkcs7-signature" || mediaType == "application/x-pkcs7-signature"
+}
+
+func isSMIMEMime(mediaType string) bool {
+	return mediaType == "application/pkcs7-mime" || mediaType == "application/x-pkcs7-mime"
+}
+
+// HasSMIME reports whether a certificate and key are loaded for signing
+func (s *Security) HasSMIME() bool {
+	return s != nil && s.SMIME.CanSign()
+}
+
+func (s *Security) smimeStore() (*smime.Store, error) {
+	if s == nil || s.SMIME == nil {
+		return nil, fmt.Errorf("S/MIME is not configured")
+	}
+	return s.SMIME, nil
+}
+
+// processSMIMESigned handles RFC 8551 multipart/signed messages with a
+// detached application/pkcs7-signature part
+func (s *Security) processSMIMESigned(msg *Message, body []byte, boundary string) {
+	status := &SecurityStatus{Kind: "S/MIME", Signed: true}
+	msg.Security = status
+
+	parts, err := splitMultipart(body, boundary)
+	if err != nil || len(parts) < 2 {
+		status.Error = "malformed S/MIME signature"
+		return
+	}
+	msg.Body = entityText(parts[0])
+
+	store, err := s.smimeStore()
+	if err != nil {
+		status.Error = err.Error()
+		return
+	}
+
+	sigHeader, signature, err := splitEntity(parts[1])
+	if err != nil {
+		status.Error = err.Error()
+		return
+	}
+
+	applySMIMEResult(status, msg.From, store.VerifyDetached(parts[0], decodeTransfer(sigHeader, signature)))
+}
+
+// processSMIMEMime handles application/pkcs7-mime bodies, which are
+// either opaque signed-data or encrypted enveloped-data
+func (s *Security) processSMIMEMime(msg *Message, data []byte) {
+	status := &SecurityStatus{Kind: "S/MIME"}
+	msg.Security = status
+
+	store, err := s.smimeStore()
+	if err != nil {
+		status.Error = err.Error()
+		return
+	}
+
+	// The smime-type parameter is optional, so try verifying first and
+	// fall back to decrypting
+	if result, err := store.VerifyOpaque(data); err == nil && result.Content != nil {
+		status.Signed = true
+		applySMIMEResult(status, msg.From, result)
+		msg.Body = entityText(result.Content)
+		return
+	}
+
+	result, err := store.Decrypt(data)
+	if err != nil {
+		status.Error = err.Error()
+		return
+	}
+	status.Encrypted = true
+
+	// The plaintext is a MIME entity, which is usually signed as well
+	inner := result.Content
+	innerHeader, innerBody, err := splitEntity(inner)
+	if err == nil {
+		innerType, innerParams, _ := mime.ParseMediaType(innerHeader.Get("Content-Type"))
+		switch {
+		case innerType == "multipart/signed" && isSMIMESignature(strings.ToLower(innerParams["protocol"])):
+			s.processSMIMESigned(msg, innerBody, innerParams["boundary"])
+			msg.Security.Encrypted = true
+			return
+		case isSMIMEMime(innerType):
+			s.processSMIMEMime(msg, decodeTransfer(innerHeader, innerBody))
+			msg.Security.Encrypted = true
+			return
+		}
+	}
+
+	msg.Body = entityText(inner)
+}
+
+// applySMIMEResult copies a verification result into the status. A
+// valid signature from a certificate issued to someone other than the
+// sender is not treated as verified.
+func applySMIMEResult(status *SecurityStatus, from string, result *smime.Result) {
+	status.Verified = result.Verified
+	status.Signer = result.Signer
+	if result.SignatureError != nil {
+		status.Error = result.SignatureError.Error()
+	}
+
+	if !result.Expires.IsZero() {
+		if result.Expires.Before(time.Now()) {
+			status.Validity = "certificate expired " + result.Expires.Format("2 Jan 2006")
+		} else {
+			status.Validity = "certificate valid until " + result.Expires.Format("2 Jan 2006")
+		}
+	}
+
+	if status.Verified && !signedBySender(from, result.SignerEmails) {
+		status.Verified = false
+		status.Error = fmt.Sprintf("certificate of %s does not belong to the sender", result.Signer)
+	}
+}
+
+// signedBySender reports whether one of the signer's addresses is the
+// From address
+func signedBySender(from string, signerEmails []string) bool {
+	sender := cleanEmailAddress(from)
+	for _, email := range signerEmails {
+		if strings.EqualFold(email, sender) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPGP reports whether an OpenPGP keyring with keys is loaded
+func (s *Security) HasPGP() bool {
+	return s != nil && !s.PGP.Empty()
+}
+
+func (s *Security) pgpKeyring() (*pgp.Keyring, error) {
+	if !s.HasPGP() {
+		return nil, fmt.Errorf("no OpenPGP keyring configured")
+	}
+	return s.PGP, nil
+}
+
+// processPGPMIMEEncrypted handles RFC 3156 multipart/encrypted messages
+func (s *Security) processPGPMIMEEncrypted(msg *Message, body []byte, boundary string) {
+	status := &SecurityStatus{Kind: "OpenPGP", Encrypted: true}
+	msg.Security = status
+
+	keyring, err := s.pgpKeyring()
+	if err != nil {
+		status.Error = err.Error()
+		return
+	}
+
+	parts, err := splitMultipart(body, boundary)
+	if err != nil || len(parts) < 2 {
+		status.Error = "malformed PGP/MIME message"
+		return
+	}
+
+	_, ciphertext, err := splitEntity(parts[1])
+	if err != nil {
+		status.Error = err.Error()
+		return
+	}
+
+	result, err := keyring.Decrypt(ciphertext)
+	if err != nil {
+		status.Error = err.Error()
+		return
+	}
+	applyPGPResult(status, msg.From, result)
+
+	// The plaintext is itself a MIME entity, which may be signed again
+	inner := result.Plaintext
+	innerHeader, innerBody, err := splitEntity(inner)
+	if err == nil {
+		innerType, innerParams, _ := mime.ParseMediaType(innerHeader.Get("Content-Type"))
+		if innerType == "multipart/signed" && strings.EqualFold(innerParams["protocol"], "application/pgp-signature") {
+			s.processPGPMIMESigned(msg, innerBody, innerParams["boundary"])
+			msg.Security.Encrypted = true
+			return
+		}
+	}
+
+	msg.Body = entityText(inner)
+}
+
+// processPGPMIMESigned handles RFC 3156 multipart/signed messages
+func (s *Security) processPGPMIMESigned(msg *Message, body []byte, boundary string) {
+	status := &SecurityStatus{Kind: "OpenPGP", Signed: true}
+	msg.Security = status
+
+	parts, err := splitMultipart(body, boundary)
+	if err != nil || len(parts) < 2 {
+		status.Error = "malformed PGP/MIME signature"
+		return
+	}
+	msg.Body = entityText(parts[0])
+
+	keyring, err := s.pgpKeyring()
+	if err != nil {
+		status.Error = err.Error()
+		return
+	}
+
+	_, signature, err := splitEntity(parts[1])
+	if err != nil {
+		status.Error = err.Error()
+		return
+	}
+
+	applyPGPResult(status, msg.From, keyring.VerifyDetached(parts[0], signature))
+}
+
+// processInlinePGP handles armored blocks embedded in a text body. Text
+// around the block is kept, marked as unverified, as anyone could have
+// added it.
+func (s *Security) processInlinePGP(msg *Message) {
+	status := &SecurityStatus{Kind: "OpenPGP"}
+	msg.Security = status
+
+	keyring, err := s.pgpKeyring()
+	if err != nil {
+		status.Error = err.Error()
+		return
+	}
+
+	var result *pgp.Result
+	var before, after string
+	if strings.Contains(msg.Body, pgpMessageMarker) {
+		status.Encrypted = true
+		var block string
+		before, block, after = splitArmored(msg.Body, pgpMessageMarker, pgpMessageEnd)
+		result, err = keyring.Decrypt([]byte(block))
+	} else {
+		var block string
+		before, block, after = splitArmored(msg.Body, pgpSignedMarker, pgpSignatureEnd)
+		result, err = keyring.VerifyCleartext([]byte(block))
+	}
+	if err != nil {
+		status.Error = err.Error()
+		return
+	}
+
+	applyPGPResult(status, msg.From, result)
+	msg.Body = strings.ReplaceAll(string(result.Plaintext), "\r\n", "\n")
+	if strings.TrimSpace(before) != "" || strings.TrimSpace(after) != "" {
+		status.Partial = true
+		sections := []string{unverifiedText(before), strings.Trim(msg.Body, "\n"), unverifiedText(after)}
+		msg.Body = strings.Trim(strings.Join(sections, "\n\n"), "\n") + "\n"
+	}
+}
+
+// splitArmored cuts a body around the armored block from the begin
+// marker to the end of the line with the end marker
+func splitArmored(body, begin, end string) (before, block, after string) {
+	start := strings.Index(body, begin)
+	before, block = body[:start], body[start:]
+	if idx := strings.Index(block, end); idx >= 0 {
+		stop := idx + len(end)
+		if newline := strings.IndexByte(block[stop:], '\n'); newline >= 0 {
+			stop += newline + 1
+		} else {
+			stop = len(block)
+		}
+		block, after = block[:stop], block[stop:]
+	}
+	return before, block, after
+}
+
+// unverifiedText sets apart text outside an inline OpenPGP block
+func unverifiedText(text string) string {
+	text = strings.Trim(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if strings.TrimSpace(text) == "" {
+		return ""
+	}
+	return unverifiedTextStart + "\n" + text + "\n" + unverifiedTextEnd
+}
+
+// applyPGPResult copies a verification result into the status. As with
+// S/MIME, a good signature by a key without the sender's address is not
+// treated as verified.
+func applyPGPResult(status *SecurityStatus, from string, result *pgp.Result) {
+	status.Signed = status.Signed || result.Signed
+	status.Verified = result.Verified
+	status.Signer = result.Signer
+	if result.SignatureError != nil {
+		status.Error = result.SignatureError.Error()
+	}
+
+	if status.Verified && !signedBySender(from, result.SignerEmails) {
+		status.Verified = false
+		status.Error = fmt.Sprintf("key of %s does not belong to the sender", result.Signer)
+	}
+}
+
+// wrapPGP signs and/or encrypts a body entity as PGP/MIME
+func (s *Security) wrapPGP(data *ComposeData, body mimePart) (mimePart, error) {
+	keyring, err := s.pgpKeyring()
+	if err != nil {
+		return mimePart{}, err
+	}
+
+	fromAddr, err := mail.ParseAddress(data.From)
+	if err != nil {
+		return mimePart{}, fmt.Errorf("invalid From address: %w", err)
+	}
+
+	var signer *openpgp.Entity
+	if data.PGPSign {
+		signer, err = keyring.SigningEntity(fromAddr.Address)
+		if err != nil {
+			return mimePart{}, err
+		}
+	}
+
+	if !data.PGPEncrypt {
+		signature, micalg, err := pgp.SignDetached(body.Bytes(), signer)
+		if err != nil {
+			return mimePart{}, err
+		}
+
+		return multipartPart("signed",
+			map[string]string{"protocol": "application/pgp-signature", "micalg": micalg},
+			body,
+			mimePart{
+				headers: []string{
+					`Content-Type: application/pgp-signature; name="signature.asc"`,
+					"Content-Description: OpenPGP digital signature",
+					`Content-Disposition: attachment; filename="signature.asc"`,
+				},
+				body: normalizeCRLF(signature),
+			},
+		), nil
+	}
+
+	recipients, err := data.Recipients()
+	if err != nil {
+		return mimePart{}, err
+	}
+
+	// Encrypt to ourselves too so the sent copy stays readable
+	emails := []string{fromAddr.Address}
+	for _, recipient := range recipients {
+		emails = append(emails, recipient.Address)
+	}
+	keys, err := keyring.RecipientEntities(emails)
+	if err != nil {
+		return mimePart{}, err
+	}
+
+	ciphertext, err := pgp.Encrypt(body.Bytes(), keys, signer)
+	if err != nil {
+		return mimePart{}, err
+	}
+
+	return multipartPart("encrypted",
+		map[string]string{"protocol": "application/pgp-encrypted"},
+		mimePart{
+			headers: []string{
+				"Content-Type: application/pgp-encrypted",
+				"Content-Description: PGP/MIME version identification",
+			},
+			body: []byte("Version: 1\r\n"),
+		},
+		mimePart{
+			headers: []string{
+				`Content-Type: application/octet-stream; name="encrypted.asc"`,
+				"Content-Description: OpenPGP encrypted message",
+				`Content-Disposition: inline; filename="encrypted.asc"`,
+			},
+			body: normalizeCRLF(ciphertext),
+		},
+	), nil
+}
+
+// wrapSMIME signs a body entity as S/MIME multipart/signed
+func (s *Security) wrapSMIME(data *ComposeData, body mimePart) (mimePart, error) {
+	store, err := s.smimeStore()
+	if err != nil {
+		return mimePart{}, err
+	}
+
+	fromAddr, err := mail.ParseAddress(data.From)
+	if err != nil {
+		return mimePart{}, fmt.Errorf("invalid From address: %w", err)
+	}
+	if cert := store.Certificate(); cert != nil {
+		matches := false
+		for _, email := range smime.Emails(cert) {
+			if strings.EqualFold(email, fromAddr.Address) {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			return mimePart{}, fmt.Errorf("S/MIME certificate is not issued for %s", fromAddr.Address)
+		}
+	}
+
+	signature, micalg, err := store.SignDetached(body.Bytes())
+	if err != nil {
+		return mimePart{}, err
+	}
+
+	return multipartPart("signed",
+		map[string]string{"protocol": "application/pkcs7-signature", "micalg": micalg},
+		body,
+		mimePart{
+			headers: []string{
+				`Content-Type: application/pkcs7-signature; name="smime.p7s"`,
+				"Content-Transfer-Encoding: base64",
+				"Content-Description: S/MIME cryptographic signature",
+				`Content-Disposition: attachment; filename="smime.p7s"`,
+			},
+			body: base64Lines(signature),
+		},
+	), nil
+}
@@ -0,0 +1,223 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"vimail/internal/pgp"
+	"vimail/internal/smime"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+var testPGPConfig = &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+
+// pgpSecurity returns a Security with a new secret key for Alice, and
+// the key itself
+func pgpSecurity(t *testing.T) (*Security, *openpgp.Entity) {
+	t.Helper()
+	entity, err := openpgp.NewEntity("Alice", "", "alice@example.com", testPGPConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.SerializePrivate(w, testPGPConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "secring.asc")
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	keyring, err := pgp.LoadKeyring("", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Security{PGP: keyring}, entity
+}
+
+// encodeRaw builds a message as it is sent and returns its raw source
+func encodeRaw(t *testing.T, security *Security, data *ComposeData) []byte {
+	t.Helper()
+	encoded, err := encodeMessage(data, security)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := base64.URLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestPGPMIMERoundTrip(t *testing.T) {
+	security, _ := pgpSecurity(t)
+
+	tests := []struct {
+		name    string
+		sign    bool
+		encrypt bool
+	}{
+		{name: "signed", sign: true},
+		{name: "encrypted", encrypt: true},
+		{name: "signed and encrypted", sign: true, encrypt: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := &ComposeData{
+				From:       "Alice <alice@example.com>",
+				To:         "alice@example.com",
+				Subject:    "Plans",
+				Body:       "Meet at noon.\nBring the map.\n",
+				PGPSign:    test.sign,
+				PGPEncrypt: test.encrypt,
+			}
+			raw := encodeRaw(t, security, data)
+
+			processed := security.Process(&Message{From: data.From}, raw)
+			status := processed.Security
+			if status == nil {
+				t.Fatal("no security status")
+			}
+			if status.Encrypted != test.encrypt || status.Signed != test.sign || status.Verified != test.sign {
+				t.Errorf("got status %+v", status)
+			}
+			if status.Error != "" {
+				t.Errorf("got error %q", status.Error)
+			}
+			if got := strings.TrimSpace(processed.Body); got != strings.TrimSpace(data.Body) {
+				t.Errorf("got body %q, want %q", got, data.Body)
+			}
+		})
+	}
+}
+
+func TestPGPMIMETamperedSignature(t *testing.T) {
+	security, _ := pgpSecurity(t)
+	data := &ComposeData{
+		From:    "alice@example.com",
+		To:      "bob@example.com",
+		Subject: "Payment",
+		Body:    "Please pay 100 EUR.\n",
+		PGPSign: true,
+	}
+	raw := encodeRaw(t, security, data)
+	tampered := bytes.Replace(raw, []byte("100 EUR"), []byte("900 EUR"), 1)
+	if bytes.Equal(raw, tampered) {
+		t.Fatal("body not found in the signed message")
+	}
+
+	status := security.Process(&Message{From: data.From}, tampered).Security
+	if !status.Signed || status.Verified || status.Error == "" {
+		t.Fatalf("tampered message got status %+v", status)
+	}
+}
+
+func TestPGPSignerMustBeSender(t *testing.T) {
+	security, _ := pgpSecurity(t)
+	data := &ComposeData{
+		From:    "alice@example.com",
+		To:      "bob@example.com",
+		Subject: "Hello",
+		Body:    "Hi Bob\n",
+		PGPSign: true,
+	}
+	raw := encodeRaw(t, security, data)
+
+	// Alice's good signature on a message that claims to be from Mallory
+	status := security.Process(&Message{From: "Mallory <mallory@example.com>"}, raw).Security
+	if status.Verified || !strings.Contains(status.Error, "does not belong to the sender") {
+		t.Fatalf("got status %+v, want the signer rejected", status)
+	}
+}
+
+func TestInlinePGPMarksUnsignedText(t *testing.T) {
+	security, entity := pgpSecurity(t)
+
+	var signed bytes.Buffer
+	w, err := clearsign.Encode(&signed, entity.PrivateKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("The signed part.\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	body := "Added later: pay Mallory.\n\n" + signed.String() + "\nAlso added.\n"
+	msg := &Message{From: "alice@example.com", Body: body}
+	processed := security.Process(msg, []byte("Content-Type: text/plain\r\n\r\n"+body))
+
+	status := processed.Security
+	if !status.Verified || !status.Partial {
+		t.Errorf("got status %+v, want a good but partial signature", status)
+	}
+	for _, want := range []string{
+		unverifiedTextStart + "\nAdded later: pay Mallory.\n" + unverifiedTextEnd,
+		"The signed part.",
+		unverifiedTextStart + "\nAlso added.\n" + unverifiedTextEnd,
+	} {
+		if !strings.Contains(processed.Body, want) {
+			t.Errorf("body lacks %q:\n%s", want, processed.Body)
+		}
+	}
+	if strings.Contains(processed.Body, "BEGIN PGP") {
+		t.Errorf("body still holds the armor:\n%s", processed.Body)
+	}
+}
+
+func TestSMIMESignerMustBeSender(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     string
+		result   smime.Result
+		verified bool
+		error    string
+	}{
+		{
+			name:     "sender's certificate",
+			from:     "Alice <ALICE@example.com>",
+			result:   smime.Result{Verified: true, Signer: "Alice", SignerEmails: []string{"alice@example.com"}},
+			verified: true,
+		},
+		{
+			name:   "someone else's certificate",
+			from:   "Mallory <mallory@example.com>",
+			result: smime.Result{Verified: true, Signer: "Alice", SignerEmails: []string{"alice@example.com"}},
+			error:  "certificate of Alice does not belong to the sender",
+		},
+		{
+			name:   "certificate without addresses",
+			from:   "alice@example.com",
+			result: smime.Result{Verified: true, Signer: "Alice"},
+			error:  "does not belong to the sender",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := &SecurityStatus{Kind: "S/MIME", Signed: true}
+			applySMIMEResult(status, test.from, &test.result)
+			if status.Verified != test.verified || !strings.Contains(status.Error, test.error) {
+				t.Errorf("got verified %v, error %q; want %v, %q", status.Verified, status.Error, test.verified, test.error)
+			}
+		})
+	}
+}
@@ -0,0 +1,390 @@
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+	"vimail/internal/email"
+	"vimail/internal/safefile"
+)
+
+// FileName is the name of the outbox in the data directory
+const FileName = "outbox.json"
+
+// Message is an outgoing message waiting in the outbox
+type Message struct {
+	ID string `json:"id"`
+	// Account is the name of the account the message is sent from
+	Account   string            `json:"account,omitempty"`
+	Data      email.ComposeData `json:"data"`
+	SendAt    time.Time         `json:"send_at"`
+	CreatedAt time.Time         `json:"created_at"`
+	LastError string            `json:"last_error,omitempty"`
+
+	// Attempts counts failed sends that are being retried, and
+	// NextAttempt is when the next retry is due
+	Attempts    int       `json:"attempts,omitempty"`
+	NextAttempt time.Time `json:"next_attempt,omitempty"`
+	// Failed marks a permanent error; the message waits for the user to
+	// edit it and is not retried
+	Failed bool `json:"failed,omitempty"`
+
+	// Lease is set while a flush is sending the message. It stays in the
+	// outbox until the send returns, so it isn't lost if vimail dies.
+	Lease *Lease `json:"lease,omitempty"`
+}
+
+// Lease marks a message as being sent by one flush. Another flush
+// leaves it alone until it expires, which only happens when the sender
+// died before recording the outcome.
+type Lease struct {
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+}
+
+// ErrLeased is returned when a message can't be changed because a flush
+// is sending it
+var ErrLeased = errors.New("message is being sent")
+
+// leaseDuration is how long a send may take before another flush
+// assumes its sender died and sends the message again
+const leaseDuration = 10 * time.Minute
+
+// Due reports whether the message should be sent now
+func (m *Message) Due(now time.Time) bool {
+	return !m.Failed && !m.SendAt.After(now) && !m.NextAttempt.After(now) && !m.Leased(now)
+}
+
+// Leased reports whether a flush is sending the message
+func (m *Message) Leased(now time.Time) bool {
+	return m.Lease != nil && m.Lease.Expires.After(now)
+}
+
+// From reports whether the message is sent from the named account
+func (m *Message) From(account string) bool {
+	return m.Account == account
+}
+
+// Retrying reports whether the message is queued after a failed send
+func (m *Message) Retrying() bool {
+	return m.Attempts > 0 && !m.Failed
+}
+
+// recordFailure notes a failed send, scheduling a retry with backoff
+// when the error is temporary
+func (m *Message) recordFailure(err error, now time.Time) {
+	m.LastError = err.Error()
+	if !email.IsRetryable(err) {
+		m.Failed = true
+		return
+	}
+	m.Attempts++
+	m.NextAttempt = now.Add(Backoff(m.Attempts))
+}
+
+// Sender delivers a message; *email.Client satisfies it
+type Sender interface {
+	SendMessage(ctx context.Context, data *email.ComposeData) error
+}
+
+// Store is the persistent outbox of scheduled messages and of sends
+// that failed and wait to be retried. Every operation reads and rewrites
+// the file under a lock, so a running vimail and `vimail outbox flush`
+// from cron see each other's changes.
+type Store struct {
+	mu   sync.Mutex
+	path string
+
+	// owner identifies this store's leases
+	owner string
+}
+
+type storeFile struct {
+	Messages []*Message `json:"messages"`
+}
+
+// Open returns the outbox stored at path. The file is created on the
+// first write.
+func Open(path string) *Store {
+	return &Store{path: path, owner: fmt.Sprintf("%d-%s", os.Getpid(), newID())}
+}
+
+// OpenDefault returns the outbox in the given data directory
+func OpenDefault(dataDir string) *Store {
+	return Open(filepath.Join(dataDir, FileName))
+}
+
+func (s *Store) read() ([]*Message, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outbox: %w", err)
+	}
+
+	var file storeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse outbox: %w", err)
+	}
+	return file.Messages, nil
+}
+
+func (s *Store) write(messages []*Message) error {
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].SendAt.Before(messages[j].SendAt)
+	})
+
+	data, err := json.MarshalIndent(storeFile{Messages: messages}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal outbox: %w", err)
+	}
+
+	if err := safefile.WriteFile(s.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write outbox: %w", err)
+	}
+	return nil
+}
+
+// update runs fn on the current contents and writes back the result,
+// holding the outbox lock so another vimail can't change it in between
+func (s *Store) update(fn func([]*Message) ([]*Message, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return safefile.Update(s.path, func() error {
+		messages, err := s.read()
+		if err != nil {
+			return err
+		}
+		messages, err = fn(messages)
+		if err != nil {
+			return err
+		}
+		return s.write(messages)
+	})
+}
+
+// List returns every message in the outbox, earliest first
+func (s *Store) List() ([]*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].SendAt.Before(messages[j].SendAt)
+	})
+	return messages, nil
+}
+
+// AssignAccount gives messages queued before vimail supported several
+// accounts, which name none, to the given account. Until then no flush
+// sends them.
+func (s *Store) AssignAccount(account string) error {
+	messages, err := s.List()
+	if err != nil || !slices.ContainsFunc(messages, unassigned) {
+		return err
+	}
+	return s.update(func(messages []*Message) ([]*Message, error) {
+		for _, msg := range messages {
+			if unassigned(msg) {
+				msg.Account = account
+			}
+		}
+		return messages, nil
+	})
+}
+
+func unassigned(msg *Message) bool {
+	return msg.Account == ""
+}
+
+// Add puts a message in the outbox to be sent from account at sendAt. A
+// non-empty id replaces the message with that ID, which is how edits are
+// saved.
+func (s *Store) Add(account, id string, data email.ComposeData, sendAt time.Time) (*Message, error) {
+	msg := &Message{
+		ID:        id,
+		Account:   account,
+		Data:      data,
+		SendAt:    sendAt,
+		CreatedAt: time.Now(),
+	}
+	if msg.ID == "" {
+		msg.ID = newID()
+	}
+
+	err := s.update(func(messages []*Message) ([]*Message, error) {
+		if leased(messages, msg.ID) {
+			return nil, ErrLeased
+		}
+		messages, _ = remove(messages, msg.ID)
+		return append(messages, msg), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Queue puts a message whose send just failed in the outbox. Temporary
+// errors are retried with backoff; permanent ones are kept for editing.
+func (s *Store) Queue(account string, data email.ComposeData, sendErr error, now time.Time) (*Message, error) {
+	msg := &Message{
+		ID:        newID(),
+		Account:   account,
+		Data:      data,
+		SendAt:    now,
+		CreatedAt: now,
+	}
+	msg.recordFailure(sendErr, now)
+
+	err := s.update(func(messages []*Message) ([]*Message, error) {
+		return append(messages, msg), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Remove deletes a message from the outbox, reporting whether it was
+// there. A message a flush is sending can't be removed: it goes out
+// anyway, so ErrLeased is returned.
+func (s *Store) Remove(id string) (bool, error) {
+	found := false
+	err := s.update(func(messages []*Message) ([]*Message, error) {
+		if leased(messages, id) {
+			return nil, ErrLeased
+		}
+		messages, found = remove(messages, id)
+		return messages, nil
+	})
+	return found, err
+}
+
+// Reschedule changes when a message is sent, clearing any retry state
+func (s *Store) Reschedule(id string, sendAt time.Time) error {
+	return s.update(func(messages []*Message) ([]*Message, error) {
+		for _, msg := range messages {
+			if msg.ID == id {
+				if msg.Leased(time.Now()) {
+					return nil, ErrLeased
+				}
+				msg.SendAt = sendAt
+				msg.NextAttempt = time.Time{}
+				msg.Failed = false
+				return messages, nil
+			}
+		}
+		return nil, fmt.Errorf("message %s is not in the outbox", id)
+	})
+}
+
+// leased reports whether a flush is sending the message with the given ID
+func leased(messages []*Message, id string) bool {
+	now := time.Now()
+	return slices.ContainsFunc(messages, func(msg *Message) bool {
+		return msg.ID == id && msg.Leased(now)
+	})
+}
+
+func remove(messages []*Message, id string) ([]*Message, bool) {
+	for i, msg := range messages {
+		if msg.ID == id {
+			return append(messages[:i], messages[i+1:]...), true
+		}
+	}
+	return messages, false
+}
+
+func newID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Result is the outcome of sending one outbox message
+type Result struct {
+	Message *Message
+	Error   error
+}
+
+// Permanent reports whether the send failed in a way retrying won't fix
+func (r Result) Permanent() bool {
+	return r.Error != nil && r.Message.Failed
+}
+
+// Flush sends every message from account that is due. Each message is
+// leased before it is sent, so two flushes running at once don't both
+// send it, and stays in the outbox until its send returns. It is then
+// removed, or kept with its error in its own update; temporary errors
+// are retried later with backoff. If that update fails the lease runs
+// out and a later flush sends the message again.
+func (s *Store) Flush(ctx context.Context, account string, sender Sender, now time.Time) ([]Result, error) {
+	var due []*Message
+	err := s.update(func(messages []*Message) ([]*Message, error) {
+		for _, msg := range messages {
+			if msg.From(account) && msg.Due(now) {
+				msg.Lease = &Lease{Owner: s.owner, Expires: now.Add(leaseDuration)}
+				copied := *msg
+				due = append(due, &copied)
+			}
+		}
+		return messages, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	var errs []error
+	for _, msg := range due {
+		data := msg.Data
+		sendErr := sender.SendMessage(ctx, &data)
+		if sendErr != nil {
+			msg.recordFailure(sendErr, now)
+		}
+		msg.Lease = nil
+		results = append(results, Result{Message: msg, Error: sendErr})
+
+		if err := s.settle(msg, sendErr == nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// settle records the outcome of a leased send: a sent message is
+// removed and a failed one gets its error and retry time. Messages
+// changed by someone else meanwhile, such as cancelled ones, are left
+// alone.
+func (s *Store) settle(sent *Message, ok bool) error {
+	return s.update(func(messages []*Message) ([]*Message, error) {
+		for i, msg := range messages {
+			if msg.ID != sent.ID || msg.Lease == nil || msg.Lease.Owner != s.owner {
+				continue
+			}
+			if ok {
+				return append(messages[:i], messages[i+1:]...), nil
+			}
+			messages[i] = sent
+			return messages, nil
+		}
+		return messages, nil
+	})
+}
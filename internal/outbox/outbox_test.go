@@ -0,0 +1,240 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"vimail/internal/email"
+	"vimail/internal/safefile"
+)
+
+// senderFunc adapts a function to the Sender interface
+type senderFunc func(data *email.ComposeData) error
+
+func (f senderFunc) SendMessage(ctx context.Context, data *email.ComposeData) error {
+	return f(data)
+}
+
+func TestFlushRemovesSentMessages(t *testing.T) {
+	store := Open(filepath.Join(t.TempDir(), FileName))
+	now := time.Now()
+	if _, err := store.Add("work", "", email.ComposeData{Subject: "due"}, now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add("work", "", email.ComposeData{Subject: "later"}, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	var sent []string
+	results, err := store.Flush(context.Background(), "work", senderFunc(func(data *email.ComposeData) error {
+		sent = append(sent, data.Subject)
+		return nil
+	}), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || len(sent) != 1 || sent[0] != "due" {
+		t.Fatalf("sent %v, want only the due message", sent)
+	}
+
+	messages, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].Data.Subject != "later" {
+		t.Fatalf("outbox holds %d messages, want only the later one", len(messages))
+	}
+}
+
+func TestFlushKeepsMessageWhileSending(t *testing.T) {
+	store := Open(filepath.Join(t.TempDir(), FileName))
+	now := time.Now()
+	msg, err := store.Add("work", "", email.ComposeData{Subject: "hello"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.Flush(context.Background(), "work", senderFunc(func(data *email.ComposeData) error {
+		messages, err := store.List()
+		if err != nil {
+			return err
+		}
+		if len(messages) != 1 || messages[0].Lease == nil {
+			t.Errorf("message not leased in the outbox while sending")
+		}
+		// A second flush must not send it too
+		other := Open(store.path)
+		results, err := other.Flush(context.Background(), "work", senderFunc(func(*email.ComposeData) error {
+			t.Errorf("leased message sent twice")
+			return nil
+		}), now)
+		if err != nil || len(results) != 0 {
+			t.Errorf("second flush: %d results, %v", len(results), err)
+		}
+		return nil
+	}), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if messages, _ := store.List(); len(messages) != 0 {
+		t.Fatalf("message %s still in the outbox after sending", msg.ID)
+	}
+}
+
+func TestFlushKeepsMessageWhenPutBackFails(t *testing.T) {
+	store := Open(filepath.Join(t.TempDir(), FileName))
+	now := time.Now()
+	msg, err := store.Add("work", "", email.ComposeData{Subject: "hello"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A directory where the lock file should be makes every update fail
+	lockPath := safefile.LockPath(store.path)
+	_, err = store.Flush(context.Background(), "work", senderFunc(func(*email.ComposeData) error {
+		if err := os.Remove(lockPath); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Mkdir(lockPath, 0700); err != nil {
+			t.Fatal(err)
+		}
+		return errors.New("connection reset")
+	}), now)
+	if err == nil {
+		t.Fatal("Flush succeeded although the outcome couldn't be recorded")
+	}
+	if err := os.Remove(lockPath); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].ID != msg.ID {
+		t.Fatalf("message lost from the outbox: %d messages left", len(messages))
+	}
+
+	// Once the lease runs out the message is sent again
+	sent := 0
+	later := now.Add(leaseDuration + time.Second)
+	if _, err := store.Flush(context.Background(), "work", senderFunc(func(*email.ComposeData) error {
+		sent++
+		return nil
+	}), later); err != nil {
+		t.Fatal(err)
+	}
+	if sent != 1 {
+		t.Fatalf("message sent %d times after the lease expired, want 1", sent)
+	}
+}
+
+func TestFlushRecordsFailure(t *testing.T) {
+	store := Open(filepath.Join(t.TempDir(), FileName))
+	now := time.Now()
+	if _, err := store.Add("work", "", email.ComposeData{Subject: "hello"}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := store.Flush(context.Background(), "work", senderFunc(func(*email.ComposeData) error {
+		return errors.New("invalid recipient")
+	}), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Error == nil {
+		t.Fatalf("want one failed result, got %v", results)
+	}
+
+	messages, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].LastError == "" || messages[0].Lease != nil {
+		t.Fatalf("failure not recorded: %+v", messages)
+	}
+}
+
+func TestAssignAccountToLegacyMessages(t *testing.T) {
+	store := Open(filepath.Join(t.TempDir(), FileName))
+	now := time.Now()
+	legacy, err := store.Add("", "", email.ComposeData{Subject: "legacy"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Add("home", "", email.ComposeData{Subject: "home"}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unassigned messages aren't sent by any account
+	results, err := store.Flush(context.Background(), "work", senderFunc(func(*email.ComposeData) error {
+		t.Errorf("message sent from the wrong account")
+		return nil
+	}), now)
+	if err != nil || len(results) != 0 {
+		t.Fatalf("flush: %d results, %v", len(results), err)
+	}
+
+	if err := store.AssignAccount("work"); err != nil {
+		t.Fatal(err)
+	}
+	messages, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range messages {
+		want := "home"
+		if msg.ID == legacy.ID {
+			want = "work"
+		}
+		if msg.Account != want {
+			t.Errorf("message %q has account %q, want %q", msg.Data.Subject, msg.Account, want)
+		}
+	}
+}
+
+func TestLeasedMessageCantBeChanged(t *testing.T) {
+	store := Open(filepath.Join(t.TempDir(), FileName))
+	now := time.Now()
+	msg, err := store.Add("work", "", email.ComposeData{Subject: "hello"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := 0
+	_, err = store.Flush(context.Background(), "work", senderFunc(func(data *email.ComposeData) error {
+		sent++
+		// Cancelling or editing the message while it goes out must fail,
+		// or the edit would be sent as well
+		if _, err := store.Remove(msg.ID); !errors.Is(err, ErrLeased) {
+			t.Errorf("Remove of a leased message: %v, want ErrLeased", err)
+		}
+		if _, err := store.Add("work", msg.ID, email.ComposeData{Subject: "edited"}, now); !errors.Is(err, ErrLeased) {
+			t.Errorf("Add over a leased message: %v, want ErrLeased", err)
+		}
+		if err := store.Reschedule(msg.ID, now); !errors.Is(err, ErrLeased) {
+			t.Errorf("Reschedule of a leased message: %v, want ErrLeased", err)
+		}
+		return nil
+	}), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Flush(context.Background(), "work", senderFunc(func(*email.ComposeData) error {
+		sent++
+		return nil
+	}), now.Add(leaseDuration+time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if sent != 1 {
+		t.Fatalf("message sent %d times, want 1", sent)
+	}
+	if messages, _ := store.List(); len(messages) != 0 {
+		t.Fatalf("outbox holds %d messages after sending, want none", len(messages))
+	}
+}
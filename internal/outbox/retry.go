@@ -0,0 +1,32 @@
+package outbox
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Retry backoff bounds
+const (
+	retryBaseDelay = 30 * time.Second
+	retryMaxDelay  = time.Hour
+)
+
+// Backoff returns the delay before retry number attempt: exponential
+// growth from retryBaseDelay, capped at retryMaxDelay, with jitter so
+// several queued messages don't all retry at the same moment
+func Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := retryMaxDelay
+	if attempt < 20 {
+		delay = retryBaseDelay << (attempt - 1)
+		if delay > retryMaxDelay || delay <= 0 {
+			delay = retryMaxDelay
+		}
+	}
+
+	// Pick uniformly between half and the full delay
+	half := int64(delay / 2)
+	return time.Duration(half + rand.Int64N(half+1))
+}
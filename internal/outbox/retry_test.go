@@ -0,0 +1,46 @@
+package outbox
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		attempt int
+		// full is the delay before jitter; Backoff picks from its
+		// upper half
+		full time.Duration
+	}{
+		{name: "no attempt yet", attempt: 0, full: retryBaseDelay},
+		{name: "negative attempt", attempt: -3, full: retryBaseDelay},
+		{name: "first retry", attempt: 1, full: retryBaseDelay},
+		{name: "doubles", attempt: 2, full: 2 * retryBaseDelay},
+		{name: "keeps doubling", attempt: 4, full: 8 * retryBaseDelay},
+		{name: "capped", attempt: 8, full: retryMaxDelay},
+		{name: "no overflow", attempt: 64, full: retryMaxDelay},
+		{name: "large attempt", attempt: 1 << 30, full: retryMaxDelay},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				got := Backoff(test.attempt)
+				if got < test.full/2 || got > test.full {
+					t.Fatalf("got %s, want between %s and %s", got, test.full/2, test.full)
+				}
+			}
+		})
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	seen := map[time.Duration]bool{}
+	for i := 0; i < 20; i++ {
+		seen[Backoff(3)] = true
+	}
+	if len(seen) < 2 {
+		t.Error("every retry got the same delay")
+	}
+}
@@ -0,0 +1,124 @@
+package outbox
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ScheduleFormats lists the send time formats ParseSendTime accepts,
+// for help text
+const ScheduleFormats = "HH:MM, tomorrow HH:MM, monday HH:MM, YYYY-MM-DD HH:MM or +2h30m"
+
+// ParseSendTime reads a send time typed by the user, relative to now and
+// in now's time zone. A bare time of day that has already passed today
+// means tomorrow.
+func ParseSendTime(text string, now time.Time) (time.Time, error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	if text == "" {
+		return time.Time{}, fmt.Errorf("no send time given")
+	}
+
+	if strings.HasPrefix(text, "+") {
+		delay, err := parseDelay(text[1:])
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(delay), nil
+	}
+
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, text, now.Location()); err == nil {
+			if layout == "2006-01-02" {
+				t = t.Add(8 * time.Hour)
+			}
+			return checkFuture(t, now)
+		}
+	}
+
+	day, clock, hasDay := strings.Cut(text, " ")
+	if !hasDay {
+		day, clock = "", text
+	}
+
+	hour, minute, err := parseClock(clock)
+	if err != nil {
+		return time.Time{}, err
+	}
+	at := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+
+	switch day {
+	case "", "today":
+		if day == "" && !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+	case "tomorrow":
+		at = at.AddDate(0, 0, 1)
+	default:
+		weekday, ok := parseWeekday(day)
+		if !ok {
+			return time.Time{}, fmt.Errorf("unknown day %q, use %s", day, ScheduleFormats)
+		}
+		days := (int(weekday) - int(now.Weekday()) + 7) % 7
+		if days == 0 && !at.After(now) {
+			days = 7
+		}
+		at = at.AddDate(0, 0, days)
+	}
+
+	return checkFuture(at, now)
+}
+
+func checkFuture(t, now time.Time) (time.Time, error) {
+	if !t.After(now) {
+		return time.Time{}, fmt.Errorf("%s is in the past", t.Format("Mon 2 Jan 15:04"))
+	}
+	return t, nil
+}
+
+// parseDelay accepts Go durations plus a "d" suffix for days
+func parseDelay(text string) (time.Duration, error) {
+	var days int
+	if before, after, ok := strings.Cut(text, "d"); ok {
+		if _, err := fmt.Sscanf(before, "%d", &days); err != nil {
+			return 0, fmt.Errorf("invalid delay %q", text)
+		}
+		text = after
+	}
+
+	var delay time.Duration
+	if text != "" {
+		var err error
+		delay, err = time.ParseDuration(text)
+		if err != nil {
+			return 0, fmt.Errorf("invalid delay %q", text)
+		}
+	}
+
+	delay += time.Duration(days) * 24 * time.Hour
+	if delay <= 0 {
+		return 0, fmt.Errorf("delay must be positive")
+	}
+	return delay, nil
+}
+
+func parseClock(text string) (hour, minute int, err error) {
+	t, err := time.Parse("15:04", text)
+	if err != nil {
+		t, err = time.Parse("15", text)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time %q, use %s", text, ScheduleFormats)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+func parseWeekday(text string) (time.Weekday, bool) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+		if text == name || (len(text) >= 3 && strings.HasPrefix(name, text)) {
+			return day, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,188 @@
+package pgp
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// PassphraseEnv is the environment variable that can hold the passphrase
+// for the secret keyring
+const PassphraseEnv = "VIMAIL_PGP_PASSPHRASE"
+
+// Keyring holds the public keys of correspondents and our own secret keys
+type Keyring struct {
+	public openpgp.EntityList
+	secret openpgp.EntityList
+}
+
+// LoadKeyring reads armored or binary keyrings from disk. Either path
+// may be empty or missing, which leaves that half of the keyring empty.
+func LoadKeyring(publicPath, secretPath string) (*Keyring, error) {
+	public, err := readKeyringFile(publicPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public keyring: %w", err)
+	}
+
+	secret, err := readKeyringFile(secretPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret keyring: %w", err)
+	}
+
+	return &Keyring{public: public, secret: secret}, nil
+}
+
+func readKeyringFile(path string) (openpgp.EntityList, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Contains(data, []byte("-----BEGIN PGP")) {
+		var list openpgp.EntityList
+		// Armored files may hold several blocks concatenated
+		for len(bytes.TrimSpace(data)) > 0 {
+			block, err := armor.Decode(bytes.NewReader(data))
+			if err != nil {
+				break
+			}
+			entities, err := openpgp.ReadKeyRing(block.Body)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, entities...)
+
+			idx := bytes.Index(data, []byte("-----END PGP"))
+			if idx < 0 {
+				break
+			}
+			data = data[idx+len("-----END PGP"):]
+			next := bytes.Index(data, []byte("-----BEGIN PGP"))
+			if next < 0 {
+				break
+			}
+			data = data[next:]
+		}
+		return list, nil
+	}
+
+	return openpgp.ReadKeyRing(bytes.NewReader(data))
+}
+
+// Empty reports whether the keyring holds no keys at all
+func (k *Keyring) Empty() bool {
+	return k == nil || (len(k.public) == 0 && len(k.secret) == 0)
+}
+
+// Locked reports whether any secret key still needs its passphrase
+func (k *Keyring) Locked() bool {
+	for _, entity := range k.secret {
+		if entity.PrivateKey != nil && entity.PrivateKey.Encrypted {
+			return true
+		}
+		for _, subkey := range entity.Subkeys {
+			if subkey.PrivateKey != nil && subkey.PrivateKey.Encrypted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Unlock decrypts the secret keys with a passphrase
+func (k *Keyring) Unlock(passphrase []byte) error {
+	for _, entity := range k.secret {
+		if err := entity.DecryptPrivateKeys(passphrase); err != nil {
+			return fmt.Errorf("failed to unlock key %s: %w", keyName(entity), err)
+		}
+	}
+	return nil
+}
+
+// all returns every entity, secret keys first so our own keys are found
+// when verifying our own signatures
+func (k *Keyring) all() openpgp.EntityList {
+	list := append(openpgp.EntityList{}, k.secret...)
+	return append(list, k.public...)
+}
+
+// findByEmail returns the first usable entity with an identity for the
+// address
+func findByEmail(list openpgp.EntityList, email string) *openpgp.Entity {
+	now := time.Now()
+	for _, entity := range list {
+		if entity.Revoked(now) {
+			continue
+		}
+		for _, identity := range entity.Identities {
+			if identity.UserId != nil && strings.EqualFold(identity.UserId.Email, email) {
+				return entity
+			}
+		}
+	}
+	return nil
+}
+
+// SigningEntity returns our secret key for a From address
+func (k *Keyring) SigningEntity(email string) (*openpgp.Entity, error) {
+	entity := findByEmail(k.secret, email)
+	if entity == nil {
+		return nil, fmt.Errorf("no secret key for %s", email)
+	}
+	// Signing uses the newest signing subkey if there is one, which may
+	// be locked or missing while the primary key isn't
+	key, ok := entity.SigningKey(time.Now())
+	if !ok || key.PrivateKey == nil || key.PrivateKey.Dummy() {
+		return nil, fmt.Errorf("secret key for %s can't sign", email)
+	}
+	if key.PrivateKey.Encrypted {
+		return nil, fmt.Errorf("secret key for %s is locked; set %s", email, PassphraseEnv)
+	}
+	return entity, nil
+}
+
+// RecipientEntities looks up a public key for every address. The error
+// names all addresses without a usable key.
+func (k *Keyring) RecipientEntities(emails []string) ([]*openpgp.Entity, error) {
+	var entities []*openpgp.Entity
+	var missing []string
+	now := time.Now()
+
+	for _, email := range emails {
+		entity := findByEmail(k.all(), email)
+		if entity == nil {
+			missing = append(missing, email)
+			continue
+		}
+		if _, ok := entity.EncryptionKey(now); !ok {
+			missing = append(missing, email)
+			continue
+		}
+		entities = append(entities, entity)
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("no public key for %s", strings.Join(missing, ", "))
+	}
+	return entities, nil
+}
+
+// keyName describes an entity by its primary identity or key ID
+func keyName(entity *openpgp.Entity) string {
+	if identity := entity.PrimaryIdentity(); identity != nil {
+		return identity.Name
+	}
+	return fmt.Sprintf("%X", entity.PrimaryKey.KeyId)
+}
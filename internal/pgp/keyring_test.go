@@ -0,0 +1,53 @@
+package pgp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+var testConfig = &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+
+func TestSigningEntityWithLockedSubkey(t *testing.T) {
+	entity, err := openpgp.NewEntity("Alice", "", "alice@example.com", testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := &Keyring{secret: openpgp.EntityList{entity}}
+	if _, err := keyring.SigningEntity("alice@example.com"); err != nil {
+		t.Fatalf("unlocked key: %v", err)
+	}
+
+	// Signatures are made with the signing subkey, so the primary key
+	// being unlocked isn't enough
+	if err := entity.AddSigningSubkey(testConfig); err != nil {
+		t.Fatal(err)
+	}
+	subkey := entity.Subkeys[len(entity.Subkeys)-1]
+	if err := subkey.PrivateKey.Encrypt([]byte("passphrase")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keyring.SigningEntity("alice@example.com"); err == nil || !strings.Contains(err.Error(), "locked") {
+		t.Fatalf("got %v, want the locked subkey reported", err)
+	}
+
+	if err := keyring.Unlock([]byte("passphrase")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keyring.SigningEntity("alice@example.com"); err != nil {
+		t.Fatalf("after unlocking: %v", err)
+	}
+}
+
+func TestSigningEntityUnknownAddress(t *testing.T) {
+	entity, err := openpgp.NewEntity("Alice", "", "alice@example.com", testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := &Keyring{secret: openpgp.EntityList{entity}}
+	if _, err := keyring.SigningEntity("bob@example.com"); err == nil {
+		t.Fatal("got a signing key for an address without one")
+	}
+}
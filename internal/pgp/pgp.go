@@ -0,0 +1,199 @@
+package pgp
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// Result describes what happened when a message was decrypted or verified
+type Result struct {
+	Plaintext []byte
+	Encrypted bool
+	Signed    bool
+	Verified  bool
+	Signer    string
+	// SignerEmails are the addresses of the signing key's identities
+	SignerEmails []string
+	// SignatureError explains why a signature could not be verified
+	SignatureError error
+}
+
+// Decrypt decrypts an armored or binary OpenPGP message and checks any
+// signature inside it
+func (k *Keyring) Decrypt(ciphertext []byte) (*Result, error) {
+	reader := io.Reader(bytes.NewReader(ciphertext))
+	if bytes.Contains(ciphertext, []byte("-----BEGIN PGP MESSAGE-----")) {
+		block, err := armor.Decode(bytes.NewReader(ciphertext))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode armored message: %w", err)
+		}
+		reader = block.Body
+	}
+
+	details, err := openpgp.ReadMessage(reader, k.all(), nil, nil)
+	if err != nil {
+		if errors.Is(err, pgperrors.ErrKeyIncorrect) {
+			return nil, fmt.Errorf("no secret key can decrypt this message")
+		}
+		return nil, fmt.Errorf("failed to decrypt message: %w", err)
+	}
+
+	// The signature is only checked once the body has been read fully
+	plaintext, err := io.ReadAll(details.UnverifiedBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read decrypted message: %w", err)
+	}
+
+	result := &Result{
+		Plaintext: plaintext,
+		Encrypted: details.IsEncrypted,
+		Signed:    details.IsSigned,
+	}
+	if details.IsSigned {
+		result.fillSignature(details.SignedBy, details.SignedByKeyId, details.SignatureError)
+	}
+	return result, nil
+}
+
+// VerifyDetached checks an armored detached signature over data
+func (k *Keyring) VerifyDetached(data, signature []byte) *Result {
+	result := &Result{Plaintext: data, Signed: true}
+
+	signer, err := openpgp.CheckArmoredDetachedSignature(k.all(), bytes.NewReader(data), bytes.NewReader(signature), nil)
+	if err != nil {
+		result.SignatureError = describeSignatureError(err)
+		return result
+	}
+
+	result.setSigner(signer)
+	return result
+}
+
+// VerifyCleartext checks an inline clearsigned message
+func (k *Keyring) VerifyCleartext(message []byte) (*Result, error) {
+	block, _ := clearsign.Decode(message)
+	if block == nil {
+		return nil, fmt.Errorf("no clearsigned block found")
+	}
+
+	result := &Result{Plaintext: block.Plaintext, Signed: true}
+	signer, err := block.VerifySignature(k.all(), nil)
+	if err != nil {
+		result.SignatureError = describeSignatureError(err)
+		return result, nil
+	}
+
+	result.setSigner(signer)
+	return result, nil
+}
+
+func (r *Result) fillSignature(signedBy *openpgp.Key, keyID uint64, sigErr error) {
+	if signedBy == nil {
+		r.SignatureError = fmt.Errorf("signed by unknown key %X", keyID)
+		return
+	}
+	if sigErr != nil {
+		r.SignatureError = describeSignatureError(sigErr)
+		return
+	}
+	r.setSigner(signedBy.Entity)
+}
+
+// setSigner records a good signature by entity
+func (r *Result) setSigner(entity *openpgp.Entity) {
+	r.Verified = true
+	r.Signer = keyName(entity)
+	for _, identity := range entity.Identities {
+		if identity.UserId != nil && identity.UserId.Email != "" {
+			r.SignerEmails = append(r.SignerEmails, identity.UserId.Email)
+		}
+	}
+}
+
+func describeSignatureError(err error) error {
+	if errors.Is(err, pgperrors.ErrUnknownIssuer) {
+		return fmt.Errorf("signed by a key that is not in the keyring")
+	}
+	return fmt.Errorf("bad signature: %w", err)
+}
+
+// SignDetached returns an armored detached signature over data, along
+// with the micalg value naming its hash for a multipart/signed header
+func SignDetached(data []byte, signer *openpgp.Entity) (signature []byte, micalg string, err error) {
+	var buf bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&buf, signer, bytes.NewReader(data), nil); err != nil {
+		return nil, "", fmt.Errorf("failed to sign message: %w", err)
+	}
+
+	micalg, err = signatureMicalg(buf.Bytes())
+	if err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), micalg, nil
+}
+
+// signatureMicalg reads back the hash algorithm of an armored signature
+func signatureMicalg(signature []byte) (string, error) {
+	block, err := armor.Decode(bytes.NewReader(signature))
+	if err != nil {
+		return "", fmt.Errorf("failed to read signature: %w", err)
+	}
+
+	p, err := packet.Read(block.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read signature: %w", err)
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok {
+		return "", fmt.Errorf("failed to read signature: unexpected packet")
+	}
+
+	switch sig.Hash {
+	case crypto.SHA1:
+		return "pgp-sha1", nil
+	case crypto.SHA224:
+		return "pgp-sha224", nil
+	case crypto.SHA384:
+		return "pgp-sha384", nil
+	case crypto.SHA512:
+		return "pgp-sha512", nil
+	default:
+		return "pgp-sha256", nil
+	}
+}
+
+// Encrypt returns an armored message encrypted to the recipients and,
+// when signer is not nil, signed by it
+func Encrypt(plaintext []byte, recipients []*openpgp.Entity, signer *openpgp.Entity) ([]byte, error) {
+	var buf bytes.Buffer
+	armored, err := armor.Encode(&buf, "PGP MESSAGE", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	writer, err := openpgp.Encrypt(armored, recipients, signer, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	if _, err := writer.Write(plaintext); err != nil {
+		return nil, fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	if err := armored.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,14 @@
+//go:build !unix && !windows
+
+package safefile
+
+import "os"
+
+// Without file locks, concurrent vimail processes aren't kept apart
+func lockFile(file *os.File) error {
+	return nil
+}
+
+func unlockFile(file *os.File) error {
+	return nil
+}
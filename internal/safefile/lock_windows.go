@@ -0,0 +1,20 @@
+//go:build windows
+
+package safefile
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// The whole file is locked, as far as the lock file could ever grow
+const lockRange = ^uint32(0)
+
+func lockFile(file *os.File) error {
+	return windows.LockFileEx(windows.Handle(file.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK, 0, lockRange, lockRange, new(windows.Overlapped))
+}
+
+func unlockFile(file *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, lockRange, lockRange, new(windows.Overlapped))
+}
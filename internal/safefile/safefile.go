@@ -0,0 +1,105 @@
+// Package safefile writes files so a crash never leaves them half
+// written, and locks them against other vimail processes while they are
+// read, changed and written back.
+package safefile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile replaces the file at path with data. The data goes to a
+// temporary file in the same directory, which is synced and renamed
+// over path, so readers see either the old or the new contents. The
+// directory is created if needed.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	// Removing fails harmlessly once the rename has happened
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// Sync the directory so the rename itself survives a crash. Not
+	// every platform can sync a directory, so failures are ignored.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// Lock is an advisory lock held on a file, shared by every process that
+// locks the same path
+type Lock struct {
+	file *os.File
+}
+
+// LockPath returns the lock file that guards path
+func LockPath(path string) string {
+	return path + ".lock"
+}
+
+// Acquire waits for the exclusive lock on path. The lock is taken on a
+// separate file next to it, since path itself is replaced on every
+// write. It is released by Unlock, or when the process exits.
+func Acquire(path string) (*Lock, error) {
+	lockPath := LockPath(path)
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	return &Lock{file: file}, nil
+}
+
+// Unlock releases the lock
+func (l *Lock) Unlock() error {
+	err := unlockFile(l.file)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Update runs fn while holding the lock on path, for a read-modify-write
+// of the file
+func Update(path string, fn func() error) error {
+	lock, err := Acquire(path)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+	return fn()
+}
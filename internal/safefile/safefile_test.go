@@ -0,0 +1,77 @@
+package safefile
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestWriteFileReplaces(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nested", "data.json")
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "second" {
+		t.Errorf("got %q, want the last write", data)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d files, want no temporary files left", len(entries))
+	}
+}
+
+func TestUpdateSerializes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counter")
+	if err := WriteFile(path, []byte("0"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each update reads the count and writes it back increased. Without
+	// the lock, updates would overwrite each other and the count would
+	// fall short. Every Acquire opens the lock file anew, as another
+	// process would.
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := Update(path, func() error {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				count, err := strconv.Atoi(string(data))
+				if err != nil {
+					return err
+				}
+				return WriteFile(path, []byte(strconv.Itoa(count+1)), 0600)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != strconv.Itoa(writers) {
+		t.Fatalf("counter is %s after %d updates", data, writers)
+	}
+}
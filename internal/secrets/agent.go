@@ -0,0 +1,255 @@
+package secrets
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAgentTTL is how long the agent keeps a key after it was stored
+const DefaultAgentTTL = 8 * time.Hour
+
+// agentTimeout bounds a single request, so a stuck agent never blocks
+// startup
+const agentTimeout = 2 * time.Second
+
+// AgentSocketPath returns where the agent listens: in the runtime
+// directory when there is one, otherwise in a private directory under
+// the system temp directory
+func AgentSocketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "vimail", "agent.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("vimail-%d", os.Getuid()), "agent.sock")
+}
+
+type cachedKey struct {
+	key     []byte
+	expires time.Time
+}
+
+// Agent holds derived keys in memory so vimail doesn't ask for the
+// passphrase on every start. It only ever sees the key, never the
+// passphrase, and forgets keys after a TTL.
+type Agent struct {
+	ttl  time.Duration
+	mu   sync.Mutex
+	keys map[string]cachedKey
+}
+
+// NewAgent creates an agent that keeps keys for ttl
+func NewAgent(ttl time.Duration) *Agent {
+	if ttl <= 0 {
+		ttl = DefaultAgentTTL
+	}
+	return &Agent{ttl: ttl, keys: map[string]cachedKey{}}
+}
+
+// Serve answers requests on the socket at path until ctx is done. The
+// socket lives in a directory only the user can enter.
+func (a *Agent) Serve(ctx context.Context, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create agent directory: %w", err)
+	}
+	if err := os.Chmod(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to protect agent directory: %w", err)
+	}
+	if err := checkAgentDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	// A socket left behind by an agent that died is removed, a live one
+	// is not taken over
+	if conn, err := net.DialTimeout("unix", path, agentTimeout); err == nil {
+		conn.Close()
+		return fmt.Errorf("an agent is already running at %s", path)
+	}
+	os.Remove(path)
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	defer os.Remove(path)
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			continue
+		}
+		go a.handle(conn)
+	}
+}
+
+// handle answers one request:
+//
+//	GET id        -> OK hexkey | NONE
+//	PUT id hexkey -> OK
+//	FORGET        -> OK
+func (a *Agent) handle(conn net.Conn) {
+	defer conn.Close()
+	if err := checkPeer(conn); err != nil {
+		return
+	}
+	conn.SetDeadline(time.Now().Add(agentTimeout))
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case fields[0] == "GET" && len(fields) == 2:
+		cached, ok := a.keys[fields[1]]
+		if !ok || time.Now().After(cached.expires) {
+			delete(a.keys, fields[1])
+			fmt.Fprintln(conn, "NONE")
+			return
+		}
+		fmt.Fprintln(conn, "OK", hex.EncodeToString(cached.key))
+
+	case fields[0] == "PUT" && len(fields) == 3:
+		key, err := hex.DecodeString(fields[2])
+		if err != nil {
+			fmt.Fprintln(conn, "ERR invalid key")
+			return
+		}
+		a.keys[fields[1]] = cachedKey{key: key, expires: time.Now().Add(a.ttl)}
+		fmt.Fprintln(conn, "OK")
+
+	case fields[0] == "FORGET":
+		a.keys = map[string]cachedKey{}
+		fmt.Fprintln(conn, "OK")
+
+	default:
+		fmt.Fprintln(conn, "ERR unknown request")
+	}
+}
+
+// checkAgentDir makes sure the agent directory is the user's own: a
+// real directory, not a symlink, that nobody else can enter
+func checkAgentDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	if err := checkOwner(dir, info); err != nil {
+		return err
+	}
+	return checkPrivate(dir, info)
+}
+
+// checkAgentSocket makes sure the socket at path can be trusted with
+// the key before anything is sent to it
+func checkAgentSocket(path string) error {
+	if err := checkAgentDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s is not a socket", path)
+	}
+	return checkOwner(path, info)
+}
+
+// CheckAgent reports why the agent socket can't be trusted, or nil when
+// it is the user's own
+func CheckAgent() error {
+	return checkAgentSocket(AgentSocketPath())
+}
+
+// agentRequest sends one request to the agent and returns its answer.
+// Nothing is sent to a socket that fails checkAgentSocket, or whose
+// peer runs as another user.
+func agentRequest(request string) (string, error) {
+	path := AgentSocketPath()
+	if err := checkAgentSocket(path); err != nil {
+		return "", err
+	}
+	conn, err := net.DialTimeout("unix", path, agentTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if err := checkPeer(conn); err != nil {
+		return "", err
+	}
+	conn.SetDeadline(time.Now().Add(agentTimeout))
+
+	if _, err := fmt.Fprintln(conn, request); err != nil {
+		return "", err
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	reply = strings.TrimSpace(reply)
+	if strings.HasPrefix(reply, "ERR") {
+		return "", fmt.Errorf("agent: %s", strings.TrimPrefix(reply, "ERR "))
+	}
+	return reply, nil
+}
+
+// AgentKey asks a running agent for the key of the store with the
+// given ID. It reports false when there is no agent or it has no key.
+func AgentKey(id string) ([]byte, bool) {
+	reply, err := agentRequest("GET " + id)
+	if err != nil {
+		return nil, false
+	}
+	encoded, ok := strings.CutPrefix(reply, "OK ")
+	if !ok {
+		return nil, false
+	}
+	key, err := hex.DecodeString(encoded)
+	if err != nil {
+		return nil, false
+	}
+	return key, true
+}
+
+// AgentStore hands a key to a running agent. Without an agent it does
+// nothing and reports false. Callers only use it when the agent is
+// enabled, see CheckAgent.
+func AgentStore(id string, key []byte) bool {
+	reply, err := agentRequest("PUT " + id + " " + hex.EncodeToString(key))
+	return err == nil && reply == "OK"
+}
+
+// AgentForget makes a running agent drop every key it holds
+func AgentForget() error {
+	_, err := agentRequest("FORGET")
+	return err
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package secrets
+
+import "net"
+
+// Only Linux reports the peer of a unix socket through SO_PEERCRED; the
+// private directory keeps other users away elsewhere
+func checkPeer(conn net.Conn) error {
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package secrets
+
+import "os"
+
+// Without Unix ownership and modes the directory can't be checked
+func checkOwner(path string, info os.FileInfo) error {
+	return nil
+}
+
+func checkPrivate(path string, info os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkOwner refuses a file that belongs to another user
+func checkOwner(path string, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("%s is not owned by you", path)
+	}
+	return nil
+}
+
+// checkPrivate refuses a directory other users can enter
+func checkPrivate(path string, info os.FileInfo) error {
+	if perm := info.Mode().Perm(); perm != 0700 {
+		return fmt.Errorf("%s has mode %04o, want 0700", path, perm)
+	}
+	return nil
+}
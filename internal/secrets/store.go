@@ -0,0 +1,310 @@
+// Package secrets keeps OAuth client secrets and tokens encrypted on
+// disk, under a key derived from a passphrase.
+package secrets
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"vimail/internal/safefile"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/oauth2"
+)
+
+// FileName is the name of the secrets store in the config directory
+const FileName = "secrets.json"
+
+// PassphraseEnv is the environment variable that can hold the passphrase,
+// for running vimail from scripts and cron
+const PassphraseEnv = "VIMAIL_PASSPHRASE"
+
+// ErrWrongPassphrase is returned when the store can't be decrypted
+var ErrWrongPassphrase = errors.New("wrong passphrase")
+
+// formatVersion is written to the file and bound into the ciphertext
+const formatVersion = 1
+
+// Argon2id parameters for new stores, following the RFC 9106 second
+// recommended option
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	keyLength    = chacha20poly1305.KeySize
+	saltLength   = 16
+)
+
+// Entry is what the store keeps for one account
+type Entry struct {
+	ClientSecret string        `json:"client_secret,omitempty"`
+	Token        *oauth2.Token `json:"token,omitempty"`
+}
+
+// kdfParams records how the key was derived, so the cost can be raised
+// for new stores without breaking old ones
+type kdfParams struct {
+	Name    string `json:"name"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+func (p kdfParams) derive(passphrase []byte) ([]byte, error) {
+	if p.Name != "argon2id" {
+		return nil, fmt.Errorf("unsupported key derivation %q", p.Name)
+	}
+	return argon2.IDKey(passphrase, p.Salt, p.Time, p.Memory, p.Threads, keyLength), nil
+}
+
+type storeFile struct {
+	Version    int       `json:"version"`
+	KDF        kdfParams `json:"kdf"`
+	Nonce      []byte    `json:"nonce"`
+	Ciphertext []byte    `json:"ciphertext"`
+}
+
+// Store is the encrypted secrets file. It must be unlocked with the
+// passphrase, or with a key cached by the agent, before use.
+type Store struct {
+	path    string
+	file    *storeFile
+	key     []byte
+	entries map[string]Entry
+}
+
+// Open reads the store at path without decrypting it. A missing file
+// gives a store that Exists reports false for and Init creates.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets: %w", err)
+	}
+
+	var file storeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets: %w", err)
+	}
+	if file.Version != formatVersion {
+		return nil, fmt.Errorf("unsupported secrets format version %d", file.Version)
+	}
+	s.file = &file
+	return s, nil
+}
+
+// OpenDefault opens the store in the given config directory
+func OpenDefault(configDir string) (*Store, error) {
+	return Open(filepath.Join(configDir, FileName))
+}
+
+// Exists reports whether the store has been created
+func (s *Store) Exists() bool {
+	return s.file != nil
+}
+
+// Unlocked reports whether the secrets can be read and written
+func (s *Store) Unlocked() bool {
+	return s.key != nil
+}
+
+// ID identifies the store's current key, for caching it in the agent.
+// It changes with the passphrase.
+func (s *Store) ID() string {
+	if s.file == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.file.KDF.Salt)
+}
+
+// Key returns the derived key of an unlocked store
+func (s *Store) Key() []byte {
+	return s.key
+}
+
+// Init creates an empty store protected by passphrase. Nothing is
+// written until Save.
+func (s *Store) Init(passphrase []byte) error {
+	if err := s.setPassphrase(passphrase); err != nil {
+		return err
+	}
+	s.entries = map[string]Entry{}
+	return nil
+}
+
+// Unlock decrypts the store with the passphrase
+func (s *Store) Unlock(passphrase []byte) error {
+	if s.file == nil {
+		return fmt.Errorf("secrets store %s does not exist", s.path)
+	}
+	key, err := s.file.KDF.derive(passphrase)
+	if err != nil {
+		return err
+	}
+	return s.UnlockWithKey(key)
+}
+
+// UnlockWithKey decrypts the store with an already derived key
+func (s *Store) UnlockWithKey(key []byte) error {
+	if s.file == nil {
+		return fmt.Errorf("secrets store %s does not exist", s.path)
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return err
+	}
+	plaintext, err := aead.Open(nil, s.file.Nonce, s.file.Ciphertext, s.additionalData())
+	if err != nil {
+		return ErrWrongPassphrase
+	}
+
+	entries := map[string]Entry{}
+	if err := json.Unmarshal(plaintext, &entries); err != nil {
+		return fmt.Errorf("failed to parse decrypted secrets: %w", err)
+	}
+
+	s.key = key
+	s.entries = entries
+	return nil
+}
+
+// ChangePassphrase re-encrypts the store under a new passphrase
+func (s *Store) ChangePassphrase(passphrase []byte) error {
+	if !s.Unlocked() {
+		return fmt.Errorf("secrets store is locked")
+	}
+	if err := s.setPassphrase(passphrase); err != nil {
+		return err
+	}
+	return s.Save()
+}
+
+func (s *Store) setPassphrase(passphrase []byte) error {
+	if len(passphrase) == 0 {
+		return fmt.Errorf("passphrase must not be empty")
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	params := kdfParams{
+		Name:    "argon2id",
+		Salt:    salt,
+		Time:    argonTime,
+		Memory:  argonMemory,
+		Threads: argonThreads,
+	}
+	key, err := params.derive(passphrase)
+	if err != nil {
+		return err
+	}
+
+	s.file = &storeFile{Version: formatVersion, KDF: params}
+	s.key = key
+	return nil
+}
+
+// additionalData binds the format and key derivation parameters to the
+// ciphertext, so they can't be swapped for weaker ones
+func (s *Store) additionalData() []byte {
+	params, _ := json.Marshal(s.file.KDF)
+	return append([]byte(fmt.Sprintf("vimail secrets v%d\n", s.file.Version)), params...)
+}
+
+// Get returns the secrets stored for an account
+func (s *Store) Get(account string) (Entry, bool) {
+	entry, ok := s.entries[account]
+	return entry, ok
+}
+
+// Put stores the secrets of an account
+func (s *Store) Put(account string, entry Entry) {
+	s.entries[account] = entry
+}
+
+// Remove forgets the secrets of an account
+func (s *Store) Remove(account string) {
+	delete(s.entries, account)
+}
+
+// Accounts returns the names of the accounts with stored secrets
+func (s *Store) Accounts() []string {
+	names := make([]string, 0, len(s.entries))
+	for name := range s.entries {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Save encrypts the secrets with a fresh nonce and writes them out
+func (s *Store) Save() error {
+	if !s.Unlocked() {
+		return fmt.Errorf("secrets store is locked")
+	}
+
+	plaintext, err := json.Marshal(s.entries)
+	if err != nil {
+		return fmt.Errorf("failed to marshal secrets: %w", err)
+	}
+
+	aead, err := chacha20poly1305.NewX(s.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	file := *s.file
+	file.Nonce = nonce
+	file.Ciphertext = aead.Seal(nil, nonce, plaintext, s.additionalData())
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal secrets: %w", err)
+	}
+	if err := safefile.WriteFile(s.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write secrets: %w", err)
+	}
+
+	s.file = &file
+	return nil
+}
+
+// Reload reads the store again with the key it was unlocked with,
+// picking up secrets another vimail saved since. A store that was never
+// written is left as it is.
+func (s *Store) Reload() error {
+	if !s.Unlocked() {
+		return fmt.Errorf("secrets store is locked")
+	}
+
+	current, err := Open(s.path)
+	if err != nil {
+		return err
+	}
+	if !current.Exists() {
+		return nil
+	}
+	if err := current.UnlockWithKey(s.key); err != nil {
+		// The passphrase was changed by another vimail
+		return fmt.Errorf("failed to reload secrets: %w", err)
+	}
+
+	s.file = current.file
+	s.entries = current.entries
+	return nil
+}
@@ -0,0 +1,140 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// newStore creates a store holding one account's secrets and saves it
+func newStore(t *testing.T, passphrase string) *Store {
+	t.Helper()
+	store, err := Open(filepath.Join(t.TempDir(), FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Init([]byte(passphrase)); err != nil {
+		t.Fatal(err)
+	}
+	store.Put("work", Entry{ClientSecret: "secret", Token: &oauth2.Token{RefreshToken: "refresh"}})
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestSaveAndUnlock(t *testing.T) {
+	store := newStore(t, "correct horse")
+
+	data, err := os.ReadFile(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"secret", "refresh"} {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("secrets file holds %q in plaintext", secret)
+		}
+	}
+
+	reopened, err := Open(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reopened.Exists() || reopened.Unlocked() {
+		t.Fatal("reopened store should exist and be locked")
+	}
+	if err := reopened.Unlock([]byte("correct horse")); err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := reopened.Get("work")
+	if !ok || entry.ClientSecret != "secret" || entry.Token.RefreshToken != "refresh" {
+		t.Fatalf("got entry %+v", entry)
+	}
+	if reopened.ID() != store.ID() {
+		t.Errorf("store ID changed from %s to %s without a new passphrase", store.ID(), reopened.ID())
+	}
+}
+
+func TestWrongPassphrase(t *testing.T) {
+	store := newStore(t, "correct horse")
+
+	reopened, err := Open(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Unlock([]byte("battery staple")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("got %v, want ErrWrongPassphrase", err)
+	}
+	if reopened.Unlocked() {
+		t.Fatal("store unlocked with the wrong passphrase")
+	}
+}
+
+func TestTamperedKDFParams(t *testing.T) {
+	store := newStore(t, "correct horse")
+
+	// Weakening the key derivation must be noticed even by someone who
+	// holds the key, or an attacker could downgrade the file
+	data, err := os.ReadFile(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file storeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	file.KDF.Time = 1
+	if data, err = json.Marshal(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(store.path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tampered, err := Open(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tampered.UnlockWithKey(store.Key()); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("got %v, want ErrWrongPassphrase for tampered parameters", err)
+	}
+}
+
+func TestReloadSeesOtherWriter(t *testing.T) {
+	store := newStore(t, "correct horse")
+
+	other, err := Open(store.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.UnlockWithKey(store.Key()); err != nil {
+		t.Fatal(err)
+	}
+	other.Put("home", Entry{ClientSecret: "home-secret"})
+	if err := other.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := store.Get("home"); ok {
+		t.Fatal("store saw the other writer's secrets before reloading")
+	}
+	if err := store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if entry, ok := store.Get("home"); !ok || entry.ClientSecret != "home-secret" {
+		t.Fatalf("after reload got %+v, %v", entry, ok)
+	}
+
+	// Once the passphrase changes the old key no longer opens the store
+	if err := other.ChangePassphrase([]byte("battery staple")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("reload after a passphrase change: %v, want ErrWrongPassphrase", err)
+	}
+}
@@ -0,0 +1,130 @@
+package smime
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/smallstep/pkcs7"
+)
+
+// Result describes what happened when a message was decrypted or verified
+type Result struct {
+	Content   []byte
+	Encrypted bool
+	Signed    bool
+	Verified  bool
+	Signer    string
+	// SignerEmails are the addresses the signing certificate covers
+	SignerEmails []string
+	// Expires is when the signing certificate stops being valid
+	Expires time.Time
+	// SignatureError explains why a signature could not be verified
+	SignatureError error
+}
+
+// VerifyDetached checks a DER application/pkcs7-signature against the
+// exact bytes of the signed MIME entity
+func (s *Store) VerifyDetached(content, signature []byte) *Result {
+	result := &Result{Content: content, Signed: true}
+
+	p7, err := pkcs7.Parse(signature)
+	if err != nil {
+		result.SignatureError = fmt.Errorf("malformed signature: %w", err)
+		return result
+	}
+	p7.Content = content
+
+	s.verify(p7, result)
+	return result
+}
+
+// VerifyOpaque checks an application/pkcs7-mime signed-data blob and
+// returns the MIME entity embedded in it
+func (s *Store) VerifyOpaque(data []byte) (*Result, error) {
+	p7, err := pkcs7.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("malformed S/MIME message: %w", err)
+	}
+
+	result := &Result{Content: p7.Content, Signed: true}
+	s.verify(p7, result)
+	return result, nil
+}
+
+// Decrypt decrypts an application/pkcs7-mime enveloped-data blob with
+// our certificate and key
+func (s *Store) Decrypt(data []byte) (*Result, error) {
+	if !s.CanSign() {
+		return nil, fmt.Errorf("no S/MIME certificate and key to decrypt with")
+	}
+
+	p7, err := pkcs7.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("malformed S/MIME message: %w", err)
+	}
+
+	content, err := p7.Decrypt(s.cert, s.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt message: %w", err)
+	}
+
+	return &Result{Content: content, Encrypted: true}, nil
+}
+
+// verify checks the signature first, then the certificate chain, so a
+// tampered message and an untrusted signer are reported differently
+func (s *Store) verify(p7 *pkcs7.PKCS7, result *Result) {
+	if cert := p7.GetOnlySigner(); cert != nil {
+		result.Signer = Describe(cert)
+		result.SignerEmails = Emails(cert)
+		result.Expires = cert.NotAfter
+	}
+
+	if err := p7.Verify(); err != nil {
+		result.SignatureError = fmt.Errorf("bad signature: %s", trimError(err))
+		return
+	}
+
+	if err := p7.VerifyWithChain(s.roots); err != nil {
+		result.SignatureError = fmt.Errorf("certificate not trusted: %s", trimError(err))
+		return
+	}
+
+	result.Verified = true
+}
+
+// trimError drops the package prefix from pkcs7 error messages
+func trimError(err error) string {
+	msg := err.Error()
+	for strings.HasPrefix(msg, "pkcs7: ") {
+		msg = strings.TrimPrefix(msg, "pkcs7: ")
+	}
+	return msg
+}
+
+// SignDetached creates a DER detached signature over content with our
+// certificate, including the chain so recipients can verify it. It
+// returns the signature and the micalg parameter for multipart/signed.
+func (s *Store) SignDetached(content []byte) ([]byte, string, error) {
+	if !s.CanSign() {
+		return nil, "", fmt.Errorf("no S/MIME certificate and key configured")
+	}
+
+	signed, err := pkcs7.NewSignedData(content)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to sign message: %w", err)
+	}
+	signed.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+
+	if err := signed.AddSignerChain(s.cert, s.key, s.chain, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, "", fmt.Errorf("failed to sign message: %w", err)
+	}
+	signed.Detach()
+
+	signature, err := signed.Finish()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to sign message: %w", err)
+	}
+	return signature, "sha-256", nil
+}
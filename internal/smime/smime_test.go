@@ -0,0 +1,166 @@
+package smime
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA is a certificate authority that issues S/MIME certificates
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue creates a certificate and key for email and loads them into a
+// store that trusts the CA
+func (ca *testCA) issue(t *testing.T, email string) *Store {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(2),
+		Subject:        pkix.Name{CommonName: "Alice"},
+		EmailAddresses: []string{email},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(12 * time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"ca.pem":    ca.pem,
+		"smime.crt": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		"smime.key": pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store, err := LoadStore(filepath.Join(dir, "ca.pem"), filepath.Join(dir, "smime.crt"), filepath.Join(dir, "smime.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// trusting returns a store that only verifies, trusting ca
+func trusting(t *testing.T, ca *testCA) *Store {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, ca.pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := LoadStore(path, filepath.Join(t.TempDir(), "missing.crt"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestSignAndVerify(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	signer := ca.issue(t, "alice@example.com")
+	content := []byte("Content-Type: text/plain\r\n\r\nHello\r\n")
+
+	signature, micalg, err := signer.SignDetached(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if micalg != "sha-256" {
+		t.Errorf("got micalg %q", micalg)
+	}
+
+	result := trusting(t, ca).VerifyDetached(content, signature)
+	if !result.Verified || result.SignatureError != nil {
+		t.Fatalf("signature not verified: %v", result.SignatureError)
+	}
+	if !slices.Contains(result.SignerEmails, "alice@example.com") {
+		t.Errorf("signer addresses %v lack the certificate's", result.SignerEmails)
+	}
+	if result.Signer != "Alice <alice@example.com>" {
+		t.Errorf("got signer %q", result.Signer)
+	}
+}
+
+func TestVerifyTamperedContent(t *testing.T) {
+	ca := newTestCA(t, "Test CA")
+	signer := ca.issue(t, "alice@example.com")
+	signature, _, err := signer.SignDetached([]byte("Pay 100 EUR\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := trusting(t, ca).VerifyDetached([]byte("Pay 900 EUR\r\n"), signature)
+	if result.Verified || result.SignatureError == nil || !strings.Contains(result.SignatureError.Error(), "bad signature") {
+		t.Fatalf("tampered content: verified %v, error %v", result.Verified, result.SignatureError)
+	}
+}
+
+func TestVerifyUntrustedCA(t *testing.T) {
+	signer := newTestCA(t, "Unknown CA").issue(t, "alice@example.com")
+	content := []byte("Hello\r\n")
+	signature, _, err := signer.SignDetached(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := trusting(t, newTestCA(t, "Trusted CA")).VerifyDetached(content, signature)
+	if result.Verified || result.SignatureError == nil || !strings.Contains(result.SignatureError.Error(), "not trusted") {
+		t.Fatalf("untrusted signer: verified %v, error %v", result.Verified, result.SignatureError)
+	}
+	// The signer is still named, so the reader can say who it claims to be
+	if result.Signer == "" {
+		t.Error("signer of an untrusted certificate not reported")
+	}
+}
@@ -0,0 +1,131 @@
+package smime
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Store holds the trust anchors used to verify signatures and, when
+// configured, our own certificate and key for signing and decrypting
+type Store struct {
+	roots *x509.CertPool
+	cert  *x509.Certificate
+	chain []*x509.Certificate
+	key   crypto.PrivateKey
+}
+
+// LoadStore reads a PEM CA bundle and a PEM certificate and key pair.
+// An empty CA bundle path uses the system roots. A missing certificate
+// or key file leaves the store able to verify but not to sign.
+func LoadStore(caBundlePath, certPath, keyPath string) (*Store, error) {
+	store := &Store{}
+
+	if caBundlePath == "" {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load system roots: %w", err)
+		}
+		store.roots = roots
+	} else {
+		bundle, err := os.ReadFile(caBundlePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		store.roots = x509.NewCertPool()
+		if !store.roots.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", caBundlePath)
+		}
+	}
+
+	certPEM, err := os.ReadFile(certPath)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+
+	keyPEM, err := os.ReadFile(keyPath)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+
+	// tls.X509KeyPair understands PKCS#1, PKCS#8 and EC keys and checks
+	// that the key matches the certificate
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		if block, _ := pem.Decode(keyPEM); block != nil &&
+			(block.Type == "ENCRYPTED PRIVATE KEY" || strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED")) {
+			return nil, fmt.Errorf("encrypted S/MIME keys are not supported, store the key unencrypted")
+		}
+		return nil, fmt.Errorf("failed to load certificate and key: %w", err)
+	}
+
+	for i, der := range pair.Certificate {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		if i == 0 {
+			store.cert = cert
+		} else {
+			store.chain = append(store.chain, cert)
+		}
+	}
+	store.key = pair.PrivateKey
+
+	return store, nil
+}
+
+// CanSign reports whether a certificate and key are loaded
+func (s *Store) CanSign() bool {
+	return s != nil && s.cert != nil && s.key != nil
+}
+
+// Certificate returns our own certificate, or nil when none is loaded
+func (s *Store) Certificate() *x509.Certificate {
+	if s == nil {
+		return nil
+	}
+	return s.cert
+}
+
+// Describe returns a readable name for a certificate subject
+func Describe(cert *x509.Certificate) string {
+	name := cert.Subject.CommonName
+	emails := Emails(cert)
+	switch {
+	case name != "" && len(emails) > 0:
+		return fmt.Sprintf("%s <%s>", name, emails[0])
+	case len(emails) > 0:
+		return emails[0]
+	case name != "":
+		return name
+	}
+	return cert.Subject.String()
+}
+
+// oidEmailAddress is the legacy emailAddress attribute of a subject DN
+var oidEmailAddress = []int{1, 2, 840, 113549, 1, 9, 1}
+
+// Emails returns the email addresses a certificate is issued for, from
+// the subject alternative names or the legacy subject attribute
+func Emails(cert *x509.Certificate) []string {
+	emails := append([]string{}, cert.EmailAddresses...)
+	for _, attr := range cert.Subject.Names {
+		if attr.Type.Equal(oidEmailAddress) {
+			if email, ok := attr.Value.(string); ok {
+				emails = append(emails, email)
+			}
+		}
+	}
+	return emails
+}
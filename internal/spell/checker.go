@@ -0,0 +1,245 @@
+package spell
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// PersonalFileName is the personal word list kept in the data directory
+const PersonalFileName = "personal_words.txt"
+
+// DefaultDictionaryDirs are searched for Hunspell dictionaries after any
+// directories given in the configuration
+var DefaultDictionaryDirs = []string{
+	"/usr/share/hunspell",
+	"/usr/share/myspell",
+	"/usr/share/myspell/dicts",
+	"/usr/local/share/hunspell",
+	"/Library/Spelling",
+}
+
+// Range is a misspelled word as a byte range within a line
+type Range struct {
+	Start int
+	End   int
+	Word  string
+}
+
+// Checker combines a dictionary with the user's personal word list and
+// caches results, since the composer re-checks text on every render
+type Checker struct {
+	dict         *Dictionary
+	personalPath string
+
+	mu       sync.Mutex
+	personal map[string]bool
+	cache    map[string]bool
+}
+
+// FindDictionary locates the .dic and .aff files for a language such as
+// "en_US" in the given directories
+func FindDictionary(language string, dirs []string) (dicPath, affPath string, err error) {
+	for _, dir := range dirs {
+		dic := filepath.Join(dir, language+".dic")
+		aff := filepath.Join(dir, language+".aff")
+		if fileExists(dic) && fileExists(aff) {
+			return dic, aff, nil
+		}
+	}
+	return "", "", fmt.Errorf("no %s dictionary found in %s", language, strings.Join(dirs, ", "))
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// NewChecker loads the dictionary for a language and the personal word
+// list at personalPath
+func NewChecker(language string, dirs []string, personalPath string) (*Checker, error) {
+	dicPath, affPath, err := FindDictionary(language, dirs)
+	if err != nil {
+		return nil, err
+	}
+
+	dict, err := LoadDictionary(dicPath, affPath)
+	if err != nil {
+		return nil, err
+	}
+
+	checker := &Checker{
+		dict:         dict,
+		personalPath: personalPath,
+		personal:     make(map[string]bool),
+		cache:        make(map[string]bool),
+	}
+	if err := checker.loadPersonal(); err != nil {
+		return nil, err
+	}
+
+	return checker, nil
+}
+
+func (c *Checker) loadPersonal() error {
+	file, err := os.Open(c.personalPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read personal word list: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if word := strings.TrimSpace(scanner.Text()); word != "" {
+			c.personal[word] = true
+		}
+	}
+	return scanner.Err()
+}
+
+// Check reports whether a word is correct, consulting the personal list
+// before the dictionary
+func (c *Checker) Check(word string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.personal[word] || c.personal[strings.ToLower(word)] {
+		return true
+	}
+	if ok, cached := c.cache[word]; cached {
+		return ok
+	}
+
+	ok := c.dict.Check(word)
+	c.cache[word] = ok
+	return ok
+}
+
+// Suggest returns corrections for a word
+func (c *Checker) Suggest(word string, limit int) []string {
+	return c.dict.Suggest(word, limit)
+}
+
+// AddToPersonal accepts a word from now on and appends it to the
+// personal word list on disk
+func (c *Checker) AddToPersonal(word string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.personal[word] {
+		return nil
+	}
+	c.personal[word] = true
+
+	if err := os.MkdirAll(filepath.Dir(c.personalPath), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(c.personalPath), err)
+	}
+	file, err := os.OpenFile(c.personalPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open personal word list: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := fmt.Fprintln(file, word); err != nil {
+		return fmt.Errorf("failed to update personal word list: %w", err)
+	}
+	return nil
+}
+
+// Misspellings returns the misspelled words in a line of text. Quoted
+// lines, URLs, email addresses and words containing digits are skipped.
+func (c *Checker) Misspellings(line string) []Range {
+	if strings.HasPrefix(strings.TrimSpace(line), ">") {
+		return nil
+	}
+
+	var ranges []Range
+	offset := 0
+	for _, token := range strings.SplitAfter(line, " ") {
+		start := offset
+		offset += len(token)
+
+		trimmed := strings.TrimSpace(token)
+		if trimmed == "" || isURLOrAddress(trimmed) {
+			continue
+		}
+
+		for _, word := range splitWords(token) {
+			if c.Check(word.Word) {
+				continue
+			}
+			ranges = append(ranges, Range{
+				Start: start + word.Start,
+				End:   start + word.End,
+				Word:  word.Word,
+			})
+		}
+	}
+	return ranges
+}
+
+// WordAt returns the word covering or touching a byte offset
+func WordAt(line string, offset int) (Range, bool) {
+	for _, word := range splitWords(line) {
+		if offset >= word.Start && offset <= word.End {
+			return word, true
+		}
+	}
+	return Range{}, false
+}
+
+func isURLOrAddress(token string) bool {
+	lower := strings.ToLower(token)
+	return strings.Contains(lower, "://") ||
+		strings.HasPrefix(lower, "www.") ||
+		strings.HasPrefix(lower, "mailto:") ||
+		strings.Contains(lower, "@")
+}
+
+// splitWords finds runs of letters, allowing apostrophes inside words.
+// Words containing digits are left out.
+func splitWords(text string) []Range {
+	var words []Range
+	start := -1
+	hasDigit := false
+
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		word := strings.TrimRight(text[start:end], "'’")
+		if word != "" && !hasDigit {
+			words = append(words, Range{Start: start, End: start + len(word), Word: word})
+		}
+		start = -1
+		hasDigit = false
+	}
+
+	for i, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.Is(unicode.Mn, r):
+			if start < 0 {
+				start = i
+			}
+		case unicode.IsDigit(r):
+			if start < 0 {
+				start = i
+			}
+			hasDigit = true
+		case (r == '\'' || r == '’') && start >= 0:
+			// Keep apostrophes inside words such as "don't"
+		default:
+			flush(i)
+		}
+	}
+	flush(len(text))
+
+	return words
+}
@@ -0,0 +1,503 @@
+package spell
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Dictionary is a Hunspell-format word list with its affix rules. Only
+// the parts of the format that matter for checking and suggesting
+// single words are supported; compounding is not.
+type Dictionary struct {
+	words     map[string][]string
+	prefixes  []*affixRule
+	suffixes  []*affixRule
+	flagMode  string
+	try       string
+	reps      [][2]string
+	forbidden string
+	needAffix string
+	noSuggest string
+	onlyInCpd string
+}
+
+// affixRule is a single PFX or SFX entry
+type affixRule struct {
+	flag      string
+	prefix    bool
+	cross     bool
+	strip     string
+	affix     string
+	contFlags []string
+	condition []condElem
+}
+
+// condElem is one position of an affix condition such as "[^aeiou]"
+type condElem struct {
+	any    bool
+	negate bool
+	chars  string
+}
+
+// LoadDictionary reads a .dic/.aff pair from disk
+func LoadDictionary(dicPath, affPath string) (*Dictionary, error) {
+	d := &Dictionary{
+		words:    make(map[string][]string),
+		flagMode: "char",
+	}
+
+	affData, err := os.ReadFile(affPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read affix file: %w", err)
+	}
+
+	dec := decoderFor(affData)
+	affText, err := decodeText(affData, dec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode affix file: %w", err)
+	}
+	if err := d.parseAffixes(affText); err != nil {
+		return nil, err
+	}
+
+	dicData, err := os.ReadFile(dicPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dictionary file: %w", err)
+	}
+	dicText, err := decodeText(dicData, dec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode dictionary file: %w", err)
+	}
+	d.parseWords(dicText)
+
+	return d, nil
+}
+
+// decoderFor returns the decoder named by the SET line of an affix
+// file, or nil for UTF-8
+func decoderFor(affData []byte) *encoding.Decoder {
+	scanner := bufio.NewScanner(bytes.NewReader(affData))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "SET" {
+			continue
+		}
+
+		var enc encoding.Encoding
+		switch strings.ToUpper(strings.ReplaceAll(fields[1], "_", "-")) {
+		case "ISO8859-1", "ISO-8859-1":
+			enc = charmap.ISO8859_1
+		case "ISO8859-2", "ISO-8859-2":
+			enc = charmap.ISO8859_2
+		case "ISO8859-5", "ISO-8859-5":
+			enc = charmap.ISO8859_5
+		case "ISO8859-7", "ISO-8859-7":
+			enc = charmap.ISO8859_7
+		case "ISO8859-9", "ISO-8859-9":
+			enc = charmap.ISO8859_9
+		case "ISO8859-13", "ISO-8859-13":
+			enc = charmap.ISO8859_13
+		case "ISO8859-15", "ISO-8859-15":
+			enc = charmap.ISO8859_15
+		case "KOI8-R":
+			enc = charmap.KOI8R
+		case "KOI8-U":
+			enc = charmap.KOI8U
+		case "MICROSOFT-CP1251", "CP1251", "WINDOWS-1251":
+			enc = charmap.Windows1251
+		default:
+			return nil
+		}
+		return enc.NewDecoder()
+	}
+	return nil
+}
+
+func decodeText(data []byte, dec *encoding.Decoder) (string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if dec == nil {
+		return string(data), nil
+	}
+	decoded, err := dec.Bytes(data)
+	if err != nil {
+		return "", err
+	}
+	return string(decoded), nil
+}
+
+// parseAffixes reads the directives of an .aff file that the checker uses
+func (d *Dictionary) parseAffixes(text string) error {
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		switch fields[0] {
+		case "FLAG":
+			d.flagMode = strings.ToLower(fields[1])
+		case "TRY":
+			d.try = fields[1]
+		case "FORBIDDENWORD":
+			d.forbidden = fields[1]
+		case "NEEDAFFIX":
+			d.needAffix = fields[1]
+		case "NOSUGGEST":
+			d.noSuggest = fields[1]
+		case "ONLYINCOMPOUND":
+			d.onlyInCpd = fields[1]
+		case "REP":
+			if len(fields) == 3 {
+				from := strings.ReplaceAll(fields[1], "_", " ")
+				to := strings.ReplaceAll(fields[2], "_", " ")
+				d.reps = append(d.reps, [2]string{from, to})
+			}
+		case "PFX", "SFX":
+			// Header line: PFX flag cross_product count
+			if len(fields) < 4 {
+				continue
+			}
+			count, err := strconv.Atoi(fields[3])
+			if err != nil {
+				return fmt.Errorf("invalid affix header on line %d: %s", i+1, lines[i])
+			}
+			cross := fields[2] == "Y"
+
+			for n := 0; n < count && i+1 < len(lines); n++ {
+				i++
+				rule, err := d.parseAffixRule(fields[0], fields[1], cross, lines[i])
+				if err != nil {
+					return fmt.Errorf("invalid affix rule on line %d: %w", i+1, err)
+				}
+				if rule.prefix {
+					d.prefixes = append(d.prefixes, rule)
+				} else {
+					d.suffixes = append(d.suffixes, rule)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// parseAffixRule parses "SFX flag strip affix[/flags] condition"
+func (d *Dictionary) parseAffixRule(kind, flag string, cross bool, line string) (*affixRule, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || fields[0] != kind || fields[1] != flag {
+		return nil, fmt.Errorf("malformed entry %q", line)
+	}
+
+	rule := &affixRule{
+		flag:   flag,
+		prefix: kind == "PFX",
+		cross:  cross,
+	}
+
+	if fields[2] != "0" {
+		rule.strip = fields[2]
+	}
+
+	affix := fields[3]
+	if idx := strings.Index(affix, "/"); idx >= 0 {
+		rule.contFlags = d.splitFlags(affix[idx+1:])
+		affix = affix[:idx]
+	}
+	if affix != "0" {
+		rule.affix = affix
+	}
+
+	condition := "."
+	if len(fields) > 4 {
+		condition = fields[4]
+	}
+	rule.condition = parseCondition(condition)
+
+	return rule, nil
+}
+
+// parseCondition turns a condition such as "[^aeiou]y" into elements
+func parseCondition(condition string) []condElem {
+	if condition == "." {
+		return nil
+	}
+
+	var elems []condElem
+	runes := []rune(condition)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '.':
+			elems = append(elems, condElem{any: true})
+		case '[':
+			end := i + 1
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			set := runes[i+1 : end]
+			elem := condElem{}
+			if len(set) > 0 && set[0] == '^' {
+				elem.negate = true
+				set = set[1:]
+			}
+			elem.chars = string(set)
+			elems = append(elems, elem)
+			i = end
+		default:
+			elems = append(elems, condElem{chars: string(runes[i])})
+		}
+	}
+	return elems
+}
+
+// matches checks a condition against the start (prefixes) or end
+// (suffixes) of a stem
+func (r *affixRule) matches(stem string) bool {
+	if len(r.condition) == 0 {
+		return true
+	}
+
+	runes := []rune(stem)
+	if len(runes) < len(r.condition) {
+		return false
+	}
+
+	offset := 0
+	if !r.prefix {
+		offset = len(runes) - len(r.condition)
+	}
+	for i, elem := range r.condition {
+		ch := runes[offset+i]
+		if elem.any {
+			continue
+		}
+		if strings.ContainsRune(elem.chars, ch) == elem.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// splitFlags splits a flag string according to the FLAG mode
+func (d *Dictionary) splitFlags(flags string) []string {
+	if flags == "" {
+		return nil
+	}
+
+	switch d.flagMode {
+	case "long":
+		var result []string
+		for i := 0; i+1 < len(flags); i += 2 {
+			result = append(result, flags[i:i+2])
+		}
+		return result
+	case "num":
+		return strings.Split(flags, ",")
+	default:
+		result := make([]string, 0, utf8.RuneCountInString(flags))
+		for _, r := range flags {
+			result = append(result, string(r))
+		}
+		return result
+	}
+}
+
+// parseWords reads the entries of a .dic file. The first line holds an
+// approximate word count and is skipped.
+func (d *Dictionary) parseWords(text string) {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if i == 0 {
+			continue
+		}
+		line = strings.TrimRight(line, "\r")
+		if line == "" || strings.HasPrefix(line, "\t") {
+			continue
+		}
+
+		// Drop morphological fields after whitespace
+		if idx := strings.IndexAny(line, " \t"); idx >= 0 {
+			line = line[:idx]
+		}
+
+		word, flags := line, ""
+		if idx := slashIndex(line); idx >= 0 {
+			word, flags = line[:idx], line[idx+1:]
+		}
+		word = strings.ReplaceAll(word, `\/`, "/")
+		if word == "" {
+			continue
+		}
+
+		d.words[word] = append(d.words[word], d.splitFlags(flags)...)
+	}
+}
+
+// slashIndex finds the flag separator, ignoring escaped slashes
+func slashIndex(line string) int {
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if line[i] == '/' {
+			return i
+		}
+	}
+	return -1
+}
+
+// hasFlag reports whether a dictionary word carries a flag
+func (d *Dictionary) hasFlag(word, flag string) bool {
+	flags, ok := d.words[word]
+	if !ok || flag == "" {
+		return false
+	}
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupStem reports whether a bare dictionary word is acceptable on its
+// own, without any affix
+func (d *Dictionary) lookupStem(word string) bool {
+	if _, ok := d.words[word]; !ok {
+		return false
+	}
+	return !d.hasFlag(word, d.forbidden) &&
+		!d.hasFlag(word, d.needAffix) &&
+		!d.hasFlag(word, d.onlyInCpd)
+}
+
+// checkExact checks one spelling without case folding
+func (d *Dictionary) checkExact(word string) bool {
+	if d.hasFlag(word, d.forbidden) {
+		return false
+	}
+	if d.lookupStem(word) {
+		return true
+	}
+	return d.checkSuffixed(word) || d.checkPrefixed(word)
+}
+
+// checkSuffixed strips one suffix, optionally combined with a prefix or
+// a second suffix through continuation flags
+func (d *Dictionary) checkSuffixed(word string) bool {
+	for _, rule := range d.suffixes {
+		stem, ok := stripSuffix(word, rule)
+		if !ok {
+			continue
+		}
+
+		if d.hasFlag(stem, rule.flag) && !d.hasFlag(stem, d.forbidden) {
+			return true
+		}
+
+		// Prefix and suffix on the same stem
+		if rule.cross {
+			for _, prefix := range d.prefixes {
+				if !prefix.cross {
+					continue
+				}
+				inner, ok := stripPrefix(stem, prefix)
+				if ok && d.hasFlag(inner, rule.flag) && d.hasFlag(inner, prefix.flag) {
+					return true
+				}
+			}
+		}
+
+		// Twofold suffixes, where the inner suffix allows the outer one
+		for _, innerRule := range d.suffixes {
+			if !containsFlag(innerRule.contFlags, rule.flag) {
+				continue
+			}
+			inner, ok := stripSuffix(stem, innerRule)
+			if ok && d.hasFlag(inner, innerRule.flag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkPrefixed strips one prefix
+func (d *Dictionary) checkPrefixed(word string) bool {
+	for _, rule := range d.prefixes {
+		stem, ok := stripPrefix(word, rule)
+		if ok && d.hasFlag(stem, rule.flag) && !d.hasFlag(stem, d.forbidden) {
+			return true
+		}
+	}
+	return false
+}
+
+func stripSuffix(word string, rule *affixRule) (string, bool) {
+	if !strings.HasSuffix(word, rule.affix) || len(word) <= len(rule.affix) {
+		return "", false
+	}
+	stem := word[:len(word)-len(rule.affix)] + rule.strip
+	if !rule.matches(stem) {
+		return "", false
+	}
+	return stem, true
+}
+
+func stripPrefix(word string, rule *affixRule) (string, bool) {
+	if !strings.HasPrefix(word, rule.affix) || len(word) <= len(rule.affix) {
+		return "", false
+	}
+	stem := rule.strip + word[len(rule.affix):]
+	if !rule.matches(stem) {
+		return "", false
+	}
+	return stem, true
+}
+
+func containsFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// Check reports whether a word is spelled correctly. Capitalized and
+// all-caps words are also accepted in their lowercase form.
+func (d *Dictionary) Check(word string) bool {
+	if d.checkExact(word) {
+		return true
+	}
+
+	lower := strings.ToLower(word)
+	switch {
+	case word == lower:
+		return false
+	case isCapitalized(word):
+		return d.checkExact(lower)
+	case word == strings.ToUpper(word):
+		return d.checkExact(lower) || d.checkExact(capitalize(lower))
+	}
+	return false
+}
+
+func isCapitalized(word string) bool {
+	r, size := utf8.DecodeRuneInString(word)
+	rest := word[size:]
+	return strings.ToUpper(string(r)) == string(r) && rest == strings.ToLower(rest)
+}
+
+func capitalize(word string) string {
+	r, size := utf8.DecodeRuneInString(word)
+	return strings.ToUpper(string(r)) + word[size:]
+}
@@ -0,0 +1,183 @@
+package spell
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Suggest returns up to limit corrections for a misspelled word. It
+// tries the REP table and single edits first, then falls back to words
+// in the dictionary within a small edit distance.
+func (d *Dictionary) Suggest(word string, limit int) []string {
+	if word == "" || limit <= 0 {
+		return nil
+	}
+
+	var result []string
+	seen := map[string]bool{word: true}
+	add := func(candidate string) bool {
+		if seen[candidate] {
+			return false
+		}
+		seen[candidate] = true
+		if d.suggestible(candidate) {
+			result = append(result, candidate)
+		}
+		return len(result) >= limit
+	}
+
+	lower := strings.ToLower(word)
+	for _, rep := range d.reps {
+		if strings.Contains(lower, rep[0]) {
+			if add(matchCase(word, strings.Replace(lower, rep[0], rep[1], 1))) {
+				return result
+			}
+		}
+	}
+
+	for _, candidate := range d.singleEdits(lower) {
+		if add(matchCase(word, candidate)) {
+			return result
+		}
+	}
+
+	if len(result) == 0 {
+		for _, candidate := range d.nearWords(lower, limit) {
+			if add(matchCase(word, candidate)) {
+				return result
+			}
+		}
+	}
+
+	return result
+}
+
+// suggestible reports whether a candidate may be offered. A split
+// candidate is checked word by word, as Check only takes single words.
+func (d *Dictionary) suggestible(candidate string) bool {
+	for _, word := range strings.Split(candidate, " ") {
+		if !d.Check(word) || d.hasFlag(word, d.noSuggest) {
+			return false
+		}
+	}
+	return true
+}
+
+// singleEdits generates swaps, deletions, replacements, insertions and
+// splits of a word, in roughly the order Hunspell prefers them
+func (d *Dictionary) singleEdits(word string) []string {
+	letters := d.try
+	if letters == "" {
+		letters = "esianrtolcdugmphbyfvkwzxjq'"
+	}
+
+	runes := []rune(word)
+	var edits []string
+
+	// Adjacent swaps catch the most common typing mistake
+	for i := 0; i+1 < len(runes); i++ {
+		swapped := append([]rune{}, runes...)
+		swapped[i], swapped[i+1] = swapped[i+1], swapped[i]
+		edits = append(edits, string(swapped))
+	}
+
+	for i := range runes {
+		edits = append(edits, string(runes[:i])+string(runes[i+1:]))
+	}
+
+	for _, l := range letters {
+		for i := range runes {
+			if runes[i] == l {
+				continue
+			}
+			replaced := append([]rune{}, runes...)
+			replaced[i] = l
+			edits = append(edits, string(replaced))
+		}
+	}
+
+	for _, l := range letters {
+		for i := 0; i <= len(runes); i++ {
+			edits = append(edits, string(runes[:i])+string(l)+string(runes[i:]))
+		}
+	}
+
+	// Two words run together
+	for i := 1; i < len(runes); i++ {
+		left, right := string(runes[:i]), string(runes[i:])
+		if d.Check(left) && d.Check(right) {
+			edits = append(edits, left+" "+right)
+		}
+	}
+
+	return edits
+}
+
+// nearWords scans the word list for entries within edit distance two,
+// closest first
+func (d *Dictionary) nearWords(word string, limit int) []string {
+	type scored struct {
+		word     string
+		distance int
+	}
+
+	length := utf8.RuneCountInString(word)
+	var found []scored
+	for candidate := range d.words {
+		diff := utf8.RuneCountInString(candidate) - length
+		if diff < -2 || diff > 2 {
+			continue
+		}
+		if distance := editDistance(word, strings.ToLower(candidate)); distance <= 2 {
+			found = append(found, scored{candidate, distance})
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].distance != found[j].distance {
+			return found[i].distance < found[j].distance
+		}
+		return found[i].word < found[j].word
+	})
+
+	var words []string
+	for i := 0; i < len(found) && i < limit*2; i++ {
+		words = append(words, found[i].word)
+	}
+	return words
+}
+
+// editDistance is the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// matchCase gives a suggestion the capitalization of the original word
+func matchCase(original, suggestion string) string {
+	switch {
+	case original == strings.ToUpper(original) && utf8.RuneCountInString(original) > 1:
+		return strings.ToUpper(suggestion)
+	case isCapitalized(original) && original != strings.ToLower(original):
+		return capitalize(suggestion)
+	}
+	return suggestion
+}
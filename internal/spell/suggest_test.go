@@ -0,0 +1,56 @@
+package spell
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// testDictionary loads a dictionary written from the given .dic and .aff
+// contents
+func testDictionary(t *testing.T, dic, aff string) *Dictionary {
+	t.Helper()
+	dir := t.TempDir()
+	dicPath, affPath := filepath.Join(dir, "test.dic"), filepath.Join(dir, "test.aff")
+	if err := os.WriteFile(dicPath, []byte(dic), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(affPath, []byte(aff), 0600); err != nil {
+		t.Fatal(err)
+	}
+	d, err := LoadDictionary(dicPath, affPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestSuggestSplitsRunTogetherWords(t *testing.T) {
+	d := testDictionary(t, "3\nhello\nworld\nword\n", "SET UTF-8\n")
+
+	if got := d.Suggest("helloworld", 5); !slices.Contains(got, "hello world") {
+		t.Errorf("Suggest(helloworld) = %q, want it to include %q", got, "hello world")
+	}
+	if got := d.Suggest("Helloworld", 5); !slices.Contains(got, "Hello world") {
+		t.Errorf("Suggest(Helloworld) = %q, want it to include %q", got, "Hello world")
+	}
+}
+
+func TestSuggestSkipsNoSuggestWordsInSplits(t *testing.T) {
+	d := testDictionary(t, "2\nhello\nworld/!\n", "SET UTF-8\nNOSUGGEST !\n")
+
+	if got := d.Suggest("helloworld", 5); slices.Contains(got, "hello world") {
+		t.Errorf("Suggest(helloworld) = %q, offered a NOSUGGEST word", got)
+	}
+}
+
+func TestSuggestCorrectsSingleEdits(t *testing.T) {
+	d := testDictionary(t, "2\nhello\nworld\n", "SET UTF-8\n")
+
+	for _, word := range []string{"hlelo", "helo", "hallo", "helllo"} {
+		if got := d.Suggest(word, 3); !slices.Contains(got, "hello") {
+			t.Errorf("Suggest(%s) = %q, want it to include hello", word, got)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// internal/ui/accounts.go - Account switcher and unified inbox
+package ui
+
+import (
+	"context"
+	"fmt"
+	"vimail/internal/auth"
+	"vimail/internal/config"
+	"vimail/internal/email"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Mailbox pairs a configured account with its connected client and the
+// token source the client authenticates with
+type Mailbox struct {
+	Account *config.Account
+	Client  *email.Client
+	Tokens  *auth.TokenSource
+}
+
+// mailbox is a connected account and what the app knows about it
+type mailbox struct {
+	Mailbox
+	identities []config.Identity
+	unread     int64
+
+	// aliases are the send-as addresses found on the server, kept to
+	// merge the identities again when the config changes
+	aliases []config.Identity
+}
+
+func (mb *mailbox) name() string {
+	return mb.Account.Name
+}
+
+// UnreadCountsMsg carries the unread inbox counts of every account
+type UnreadCountsMsg struct {
+	Counts map[string]int64
+}
+
+// loadUnreadCounts fetches each account's unread count. Accounts that
+// fail to answer keep their previous count.
+func (m Model) loadUnreadCounts() tea.Cmd {
+	mailboxes, ctx := m.mailboxes, m.ctx
+	return func() tea.Msg {
+		counts := make(map[string]int64, len(mailboxes))
+		for _, mb := range mailboxes {
+			if count, err := mb.Client.UnreadCount(ctx); err == nil {
+				counts[mb.name()] = count
+			}
+		}
+		return UnreadCountsMsg{Counts: counts}
+	}
+}
+
+// current returns the account new messages are composed from
+func (m Model) current() *mailbox {
+	return m.mailboxes[m.active]
+}
+
+// mailboxFor returns the connected account with the given name, or nil
+// when there is none
+func (m Model) mailboxFor(name string) *mailbox {
+	for _, mb := range m.mailboxes {
+		if mb.name() == name {
+			return mb
+		}
+	}
+	return nil
+}
+
+// notConnected is the status for work that needs an account that isn't
+// connected
+func notConnected(account string) string {
+	if account == "" {
+		return "✗ The message has no account"
+	}
+	return "✗ Account " + account + " is not connected"
+}
+
+// inboxSources returns the accounts the inbox shows: the current one,
+// or all of them in the unified inbox
+func (m Model) inboxSources() []Mailbox {
+	if !m.unified {
+		return []Mailbox{m.current().Mailbox}
+	}
+	sources := make([]Mailbox, 0, len(m.mailboxes))
+	for _, mb := range m.mailboxes {
+		sources = append(sources, mb.Mailbox)
+	}
+	return sources
+}
+
+// switchAccount shows the inbox of account index, or the unified inbox
+// when index is past the last account
+func (m Model) switchAccount(index int) (Model, tea.Cmd) {
+	m.unified = index >= len(m.mailboxes)
+	if !m.unified {
+		m.active = index
+	}
+	m.viewMode = InboxView
+	m.inbox.SetSources(m.inboxSources(), m.unified)
+	return m, tea.Batch(m.inbox.Refresh(), m.loadUnreadCounts())
+}
+
+// switcherIndex is the position of the inbox being shown in the
+// switcher, where the unified inbox comes after the accounts
+func (m Model) switcherIndex() int {
+	if m.unified {
+		return len(m.mailboxes)
+	}
+	return m.active
+}
+
+// openSwitcher shows the account list
+func (m Model) openSwitcher() (Model, tea.Cmd) {
+	m.previousView = m.viewMode
+	m.viewMode = AccountsView
+	m.switcherSelected = m.switcherIndex()
+	return m, m.loadUnreadCounts()
+}
+
+// handleSwitcherKey moves through the account list and opens the chosen
+// inbox
+func (m Model) handleSwitcherKey(msg tea.KeyMsg) (Model, tea.Cmd) {
+	entries := len(m.mailboxes) + 1
+	switch m.keys.action(msg) {
+	case config.ActionBack:
+		m.viewMode = m.previousView
+	case config.ActionUp:
+		if m.switcherSelected > 0 {
+			m.switcherSelected--
+		}
+	case config.ActionDown:
+		if m.switcherSelected < entries-1 {
+			m.switcherSelected++
+		}
+	case config.ActionOpen:
+		return m.switchAccount(m.switcherSelected)
+	default:
+		// Number keys jump straight to an account
+		if key := msg.String(); len(key) == 1 && key[0] >= '1' && key[0] <= '9' {
+			if index := int(key[0] - '1'); index < entries {
+				return m.switchAccount(index)
+			}
+		}
+	}
+	return m, nil
+}
+
+// cycleAccount moves to the next or previous inbox, the unified inbox
+// included
+func (m Model) cycleAccount(delta int) (Model, tea.Cmd) {
+	entries := len(m.mailboxes) + 1
+	return m.switchAccount((m.switcherIndex() + delta + entries) % entries)
+}
+
+// totalUnread sums the unread counts of every account
+func (m Model) totalUnread() int64 {
+	var total int64
+	for _, mb := range m.mailboxes {
+		total += mb.unread
+	}
+	return total
+}
+
+// switcherView lists the accounts with their unread counts
+func (m Model) switcherView() string {
+	var lines []string
+	for i, mb := range m.mailboxes {
+		label := fmt.Sprintf("%d  %-16s %s", i+1, mb.name(), mb.Account.UserEmail)
+		lines = append(lines, FormatEmailLine(label, unreadLabel(mb.unread), i == m.switcherSelected))
+	}
+	unified := fmt.Sprintf("%d  %-16s", len(m.mailboxes)+1, "All accounts")
+	lines = append(lines, FormatEmailLine(unified, unreadLabel(m.totalUnread()), m.switcherSelected == len(m.mailboxes)))
+
+	help := lipgloss.NewStyle().
+		Foreground(Gray).
+		Render("enter: open • 1-9: jump • esc: back")
+
+	content := lipgloss.JoinVertical(lipgloss.Left, lines...)
+	return lipgloss.JoinVertical(lipgloss.Left, SimpleBorderStyle.Render(content), help)
+}
+
+func unreadLabel(count int64) string {
+	if count == 0 {
+		return "no unread"
+	}
+	return fmt.Sprintf("%d unread", count)
+}
+
+// inboxTitle names the inbox in the header, with its unread count
+func (m Model) inboxTitle() string {
+	if len(m.mailboxes) < 2 {
+		return "Inbox"
+	}
+	if m.unified {
+		return fmt.Sprintf("All accounts (%d)", m.totalUnread())
+	}
+	return fmt.Sprintf("Inbox: %s (%d)", m.current().name(), m.current().unread)
+}
+
+// loadAllIdentities fetches the send-as aliases of every account
+func (m Model) loadAllIdentities() tea.Cmd {
+	cmds := make([]tea.Cmd, 0, len(m.mailboxes))
+	for _, mb := range m.mailboxes {
+		cmds = append(cmds, loadIdentities(m.ctx, mb))
+	}
+	return tea.Batch(cmds...)
+}
+
+// loadIdentities fetches an account's send-as aliases so the composer
+// can offer them as From addresses
+func loadIdentities(ctx context.Context, mb *mailbox) tea.Cmd {
+	name, client := mb.name(), mb.Client
+	return func() tea.Msg {
+		aliases, err := client.ListSendAs(ctx)
+		if err != nil {
+			return IdentitiesLoadedMsg{Account: name, Error: err}
+		}
+
+		identities := make([]config.Identity, 0, len(aliases))
+		for _, alias := range aliases {
+			identities = append(identities, config.Identity{Email: alias.Email, Name: alias.Name})
+		}
+		return IdentitiesLoadedMsg{Account: name, Identities: identities}
+	}
+}
+
+// flushAllOutboxes sends the due scheduled messages of every account
+func (m Model) flushAllOutboxes() tea.Cmd {
+	cmds := make([]tea.Cmd, 0, len(m.mailboxes))
+	for _, mb := range m.mailboxes {
+		cmds = append(cmds, flushOutbox(m.ctx, m.outbox.store, mb.name(), mb.Client))
+	}
+	return tea.Batch(cmds...)
+}
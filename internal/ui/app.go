@@ -3,8 +3,14 @@ package ui
 
 import (
 	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
 	"vimail/internal/config"
+	"vimail/internal/contacts"
 	"vimail/internal/email"
+	"vimail/internal/outbox"
+	"vimail/internal/spell"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -44,11 +50,14 @@ const (
 	InboxView ViewMode = iota
 	ReaderView
 	ComposerView
+	OutboxView
+	AccountsView
 )
 
 type Model struct {
-	emailClient  *email.Client
 	config       *config.Config
+	prefs        *config.Preferences
+	keys         keyMap
 	ctx          context.Context
 	viewMode     ViewMode
 	width        int
@@ -57,28 +66,199 @@ type Model struct {
 	inbox        *InboxModelImpl
 	reader       *ReaderModelImpl
 	composer     *ComposerModelImpl
+	outbox       *OutboxModelImpl
+	contacts     *contacts.Store
+	spell        *spell.Checker
 	previousView ViewMode
+
+	// Connected accounts; active is the one new messages are sent from
+	// and unified shows every inbox merged
+	mailboxes        []*mailbox
+	active           int
+	unified          bool
+	switcherSelected int
+
+	// Send delay state, kept here so it survives switching views
+	pending     []*pendingSend
+	reopen      []*ComposerModelImpl
+	ticking     bool
+	inFlight    int
+	confirmQuit bool
+	quitting    bool
+	status      string
+
+	// settingsStamps tell when the config or preferences were edited
+	settingsStamps map[string]fileStamp
+}
+
+// NewModel creates the app for the connected accounts, starting in the
+// inbox of the configured default account
+func NewModel(ctx context.Context, cfg *config.Config, prefs *config.Preferences, mailboxes []Mailbox, addressBook *contacts.Store, scheduled *outbox.Store) Model {
+	ApplyTheme(config.Themes[prefs.Theme])
+	keys := newKeyMap(prefs)
+	m := Model{
+		config:   cfg,
+		prefs:    prefs,
+		keys:     keys,
+		ctx:      ctx,
+		viewMode: InboxView,
+		reader:   NewReaderModelImpl(prefs, keys),
+		outbox:   NewOutboxModelImpl(scheduled, prefs, keys),
+		contacts: addressBook,
+
+		settingsStamps: settingsStamps(),
+	}
+
+	defaultName := cfg.DefaultAccountName()
+	for i, mb := range mailboxes {
+		m.mailboxes = append(m.mailboxes, &mailbox{
+			Mailbox:    mb,
+			identities: mb.Account.MergeIdentities(nil),
+		})
+		if mb.Account.Name == defaultName {
+			m.active = i
+		}
+	}
+
+	m.inbox = NewInboxModelImpl(ctx, m.inboxSources(), prefs, keys)
+	m.composer = NewComposerModelImpl(m.composerEnv(m.current()))
+	return m
+}
+
+// composerEnv returns the shared state handed to new composers sending
+// from the given account
+func (m Model) composerEnv(mb *mailbox) ComposerEnv {
+	return ComposerEnv{
+		Account:     mb.name(),
+		EmailClient: mb.Client,
+		Identities:  mb.identities,
+		Preferences: m.prefs,
+		Contacts:    m.contacts,
+		Spell:       m.spell,
+		Markdown:    mb.Account.Markdown,
+		PGP:         mb.Client.Security().HasPGP(),
+		SMIME:       mb.Client.Security().HasSMIME(),
+	}
 }
 
-func NewModel(ctx context.Context, emailClient *email.Client, cfg *config.Config) Model {
-	return Model{
-		emailClient: emailClient,
-		config:      cfg,
-		ctx:         ctx,
-		viewMode:    InboxView,
-		inbox:       NewInboxModelImpl(ctx, emailClient),
-		reader:      NewReaderModelImpl(),
-		composer:    NewComposerModelImpl(emailClient.GetUserEmail(), emailClient),
+// processSecurity decrypts and verifies a PGP or S/MIME message in the
+// background
+func (m Model) processSecurity(msg *email.Message) tea.Cmd {
+	if !email.NeedsSecurity(msg) || msg.Security != nil {
+		return nil
 	}
+	mb := m.mailboxFor(msg.Account)
+	if mb == nil {
+		return nil
+	}
+	client, ctx := mb.Client, m.ctx
+	return func() tea.Msg {
+		processed, err := client.ProcessSecurity(ctx, msg)
+		if err != nil {
+			// Still settle the status line so it doesn't stay pending
+			failed := *msg
+			failed.Security = &email.SecurityStatus{Error: err.Error()}
+			processed = &failed
+		}
+		return SecurityProcessedMsg{Message: processed, Error: err}
+	}
+}
+
+// observeMessages adds the participants of fetched messages to the
+// address book and saves it in the background
+func (m Model) observeMessages(messages []*email.Message) tea.Cmd {
+	if m.contacts == nil || len(messages) == 0 {
+		return nil
+	}
+
+	var own []string
+	for _, mb := range m.mailboxes {
+		for _, identity := range mb.identities {
+			own = append(own, identity.Email)
+		}
+	}
+	m.contacts.ObserveMessages(messages, own)
+
+	store := m.contacts
+	return func() tea.Msg {
+		if err := store.Save(); err != nil {
+			return NewErrorMsg(fmt.Errorf("failed to save contacts: %w", err))
+		}
+		return nil
+	}
+}
+
+// IdentitiesLoadedMsg carries an account's send-as aliases fetched from
+// the server
+type IdentitiesLoadedMsg struct {
+	Account    string
+	Identities []config.Identity
+	Error      error
+}
+
+// SpellCheckerLoadedMsg carries the dictionary loaded in the background
+type SpellCheckerLoadedMsg struct {
+	Checker *spell.Checker
+	Error   error
 }
 
 func (m Model) Init() tea.Cmd {
 	return tea.Batch(
 		m.inbox.Init(),
+		m.loadUnreadCounts(),
+		m.loadAllIdentities(),
+		m.loadSpellChecker(),
+		m.outbox.Init(),
+		m.flushAllOutboxes(),
+		outboxTick(),
+		configWatchTick(),
 		tea.EnterAltScreen,
 	)
 }
 
+// loadSpellChecker loads the Hunspell dictionary from disk. Dictionaries
+// in the config directory take precedence over system ones.
+func (m Model) loadSpellChecker() tea.Cmd {
+	settings := m.config.Spell
+	if settings.Disabled {
+		return nil
+	}
+
+	return func() tea.Msg {
+		configDir, err := config.GetConfigDir()
+		if err != nil {
+			return SpellCheckerLoadedMsg{Error: err}
+		}
+		dataDir, err := config.GetDataDir()
+		if err != nil {
+			return SpellCheckerLoadedMsg{Error: err}
+		}
+
+		dirs := append([]string{filepath.Join(configDir, "dictionaries")}, settings.DictionaryDirs...)
+		dirs = append(dirs, spell.DefaultDictionaryDirs...)
+
+		checker, err := spell.NewChecker(settings.SpellLanguage(), dirs, filepath.Join(dataDir, spell.PersonalFileName))
+		return SpellCheckerLoadedMsg{Checker: checker, Error: err}
+	}
+}
+
+// openComposer switches to the composer, remembering where to return to
+func (m Model) openComposer(composer *ComposerModelImpl) (Model, tea.Cmd) {
+	m.previousView = m.viewMode
+	m.viewMode = ComposerView
+	m.composer = composer
+	m.composer.SetSize(m.width, m.height-3)
+	return m, m.composer.Init()
+}
+
+// currentMessage returns the message being read or selected in the inbox
+func (m Model) currentMessage() *email.Message {
+	if m.viewMode == ReaderView {
+		return m.reader.GetMessage()
+	}
+	return m.inbox.GetSelectedMessage()
+}
+
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
 
@@ -90,34 +270,200 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.inbox.SetSize(msg.Width, msg.Height-3)
 		m.reader.SetSize(msg.Width, msg.Height-3)
 		m.composer.SetSize(msg.Width, msg.Height-3)
+		m.outbox.SetSize(msg.Width, msg.Height-3)
+
+	case LoadMessagesMsg:
+		if msg.Error == nil {
+			cmds = append(cmds, m.observeMessages(msg.Messages))
+		}
+		if msg.generation == m.inbox.generation {
+			cmds = append(cmds, m.loadUnreadCounts())
+		}
+
+	case UnreadCountsMsg:
+		for _, mb := range m.mailboxes {
+			if count, ok := msg.Counts[mb.name()]; ok {
+				mb.unread = count
+			}
+		}
+		return m, nil
+
+	case SpellCheckerLoadedMsg:
+		// Without a dictionary the composer simply doesn't check spelling
+		if msg.Error == nil {
+			m.spell = msg.Checker
+			m.composer.env.Spell = msg.Checker
+		}
+		return m, nil
+
+	case SecurityProcessedMsg:
+		// Keep the decrypted copy so reopening the message is instant
+		if msg.Error == nil && msg.Message != nil {
+			m.inbox.ReplaceMessage(msg.Message)
+		}
+		updatedReader, _ := m.reader.Update(msg)
+		if updatedModel, ok := updatedReader.(*ReaderModelImpl); ok {
+			m.reader = updatedModel
+		}
+		return m, nil
+
+	case pendingTickMsg:
+		var cmd tea.Cmd
+		m, cmd = m.flushPending(false)
+		if len(m.pending) == 0 {
+			m.ticking = false
+			return m, cmd
+		}
+		return m, tea.Batch(cmd, pendingTick())
+
+	case SendMessageMsg:
+		return m.handleSendResult(msg)
+
+	case ReauthenticatedMsg:
+		return m.handleReauthenticated(msg)
+
+	case outboxTickMsg:
+		return m, tea.Batch(m.flushAllOutboxes(), outboxTick())
+
+	case configWatchMsg:
+		var cmd tea.Cmd
+		m, cmd = m.checkSettings()
+		return m, tea.Batch(cmd, configWatchTick())
+
+	case ReloadMsg:
+		m.settingsStamps = settingsStamps()
+		return m, loadSettings(true)
+
+	case SettingsLoadedMsg:
+		return m.applySettings(msg)
+
+	case OutboxFlushedMsg:
+		return m.handleOutboxFlushed(msg)
+
+	case OutboxLoadedMsg:
+		m.outbox.Update(msg)
+		return m, nil
+
+	case MessageSavedMsg:
+		if msg.Error != nil {
+			m.status = "✗ Failed to save message: " + msg.Error.Error()
+		} else {
+			m.status = "Saved to " + msg.Path
+		}
+		return m, nil
+
+	case ErrorMsg:
+		// Failures of background work, such as saving the contacts
+		m.status = "✗ " + msg.Error.Error()
+		return m, nil
+
+	case IdentitiesLoadedMsg:
+		// Without send-as aliases the configured identities still work
+		if mb := m.mailboxFor(msg.Account); msg.Error == nil && mb != nil {
+			mb.aliases = msg.Identities
+			mb.identities = mb.Account.MergeIdentities(msg.Identities)
+		}
+		return m, nil
 
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "ctrl+c", "q":
-			return m, tea.Quit
+		if m.confirmQuit {
+			return m.handleQuitKey(msg)
+		}
+
+		// The composer gets every key except ctrl+c so text can be typed
+		if msg.String() == "ctrl+c" {
+			return m.requestQuit()
+		}
+		if m.viewMode == ComposerView {
+			break
+		}
+		m.status = ""
 
-		case "esc":
+		switch m.keys.action(msg) {
+		case config.ActionQuit:
+			return m.requestQuit()
+
+		case config.ActionUndoSend:
+			if len(m.pending) > 0 {
+				return m.undoSend()
+			}
+
+		case config.ActionLogin:
+			if mb := m.needsReauth(); mb != nil {
+				return m.reauthenticate(mb)
+			}
+
+		case config.ActionOutbox:
+			if m.viewMode != OutboxView {
+				m.previousView = m.viewMode
+				m.viewMode = OutboxView
+				return m, m.outbox.Load()
+			}
+		}
+
+		if m.viewMode == OutboxView {
+			return m.handleOutboxKey(msg)
+		}
+		if m.viewMode == AccountsView {
+			return m.handleSwitcherKey(msg)
+		}
+
+		switch action := m.keys.action(msg); action {
+		case config.ActionBack:
 			if m.viewMode == ReaderView {
 				m.viewMode = InboxView
-			} else if m.viewMode == ComposerView {
-				m.viewMode = m.previousView
 			}
 
-		case "c":
-			if m.viewMode == InboxView {
-				m.previousView = InboxView
-				m.viewMode = ComposerView
-				m.composer = NewComposerModelImpl(m.emailClient.GetUserEmail(), m.emailClient)
-				return m, m.composer.Init()
+		case config.ActionAccounts:
+			if len(m.mailboxes) > 1 {
+				return m.openSwitcher()
+			}
+
+		case config.ActionNextAccount, config.ActionPrevAccount:
+			if len(m.mailboxes) > 1 && m.viewMode == InboxView {
+				delta := 1
+				if action == config.ActionPrevAccount {
+					delta = -1
+				}
+				return m.cycleAccount(delta)
 			}
 
-		case "enter":
+		case config.ActionCompose:
+			return m.openComposer(NewComposerModelImpl(m.composerEnv(m.current())))
+
+		// Replies and forwards go out from the account the message came from
+		case config.ActionReply:
+			if original := m.currentMessage(); original != nil {
+				mb := m.mailboxFor(original.Account)
+				if mb == nil {
+					m.status = notConnected(original.Account)
+					return m, nil
+				}
+				return m.openComposer(NewReplyComposerModelImpl(m.composerEnv(mb), original))
+			}
+
+		case config.ActionForward:
+			if original := m.currentMessage(); original != nil {
+				mb := m.mailboxFor(original.Account)
+				if mb == nil {
+					m.status = notConnected(original.Account)
+					return m, nil
+				}
+				return m.openComposer(NewForwardComposerModelImpl(m.composerEnv(mb), original))
+			}
+
+		case config.ActionSave:
+			if original := m.currentMessage(); original != nil {
+				return m, m.saveMessage(original)
+			}
+
+		case config.ActionOpen:
 			if m.viewMode == InboxView {
 				if selectedMsg := m.inbox.GetSelectedMessage(); selectedMsg != nil {
 					m.previousView = InboxView
 					m.viewMode = ReaderView
 					m.reader.SetMessage(selectedMsg)
-					return m, nil
+					return m, m.processSecurity(selectedMsg)
 				}
 			}
 		}
@@ -149,9 +495,13 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		// Handle composer completion
 		if m.composer.IsSent() || m.composer.IsCancelled() {
 			m.viewMode = m.previousView
+			var cmd tea.Cmd
 			if m.composer.IsSent() {
-				cmds = append(cmds, m.inbox.Refresh())
+				m, cmd = m.queueSend(m.composer)
+				cmds = append(cmds, cmd)
 			}
+			m, cmd = m.reopenNext()
+			cmds = append(cmds, cmd)
 		}
 	}
 
@@ -167,11 +517,15 @@ func (m Model) View() string {
 	var header string
 	switch m.viewMode {
 	case InboxView:
-		header = "Inbox"
+		header = m.inboxTitle()
 	case ReaderView:
 		header = "Reading"
 	case ComposerView:
 		header = "Compose"
+	case OutboxView:
+		header = "Outbox"
+	case AccountsView:
+		header = "Accounts"
 	}
 
 	headerBar := HeaderStyle.Width(m.width).Render(header)
@@ -185,14 +539,28 @@ func (m Model) View() string {
 		content = m.reader.View()
 	case ComposerView:
 		content = m.composer.View()
+	case OutboxView:
+		content = m.outbox.View()
+	case AccountsView:
+		content = m.switcherView()
 	}
 
-	// Simple help
+	// Simple help, replaced by the send countdown or status when there is one
+	helpText := m.helpText()
+	if status := m.pendingStatus(); status != "" {
+		helpText = status
+	}
+	if reauth := m.reauthStatus(); reauth != "" {
+		helpText = reauth + " • " + helpText
+	}
+	if queued := m.outbox.QueuedCount(); queued > 0 {
+		helpText = fmt.Sprintf("⟳ %d queued • %s", queued, helpText)
+	}
 	help := lipgloss.NewStyle().
 		Foreground(Gray).
 		Align(lipgloss.Center).
 		Width(m.width).
-		Render("q: quit | ↑↓: navigate | enter: read | c: compose | esc: back")
+		Render(helpText)
 
 	return lipgloss.JoinVertical(
 		lipgloss.Top,
@@ -202,6 +570,26 @@ func (m Model) View() string {
 	)
 }
 
+// helpText lists the main actions with the keys they are bound to
+func (m Model) helpText() string {
+	k := m.keys
+	help := []string{
+		k.help(config.ActionQuit) + ": quit",
+		k.help(config.ActionUp) + " " + k.help(config.ActionDown) + ": navigate",
+		k.help(config.ActionOpen) + ": read",
+		k.help(config.ActionCompose) + ": compose",
+		k.help(config.ActionReply) + ": reply",
+		k.help(config.ActionForward) + ": forward",
+		k.help(config.ActionSave) + ": save",
+		k.help(config.ActionOutbox) + ": outbox",
+		k.help(config.ActionBack) + ": back",
+	}
+	if len(m.mailboxes) > 1 {
+		help = append(help, k.help(config.ActionAccounts)+"/"+k.help(config.ActionNextAccount)+": accounts")
+	}
+	return strings.Join(help, " | ")
+}
+
 type ErrorMsg struct {
 	Error error
 }
@@ -2,9 +2,15 @@
 package ui
 
 import (
-	"context"
+	"fmt"
+	"net/mail"
 	"strings"
+	"time"
+	"vimail/internal/config"
+	"vimail/internal/contacts"
 	"vimail/internal/email"
+	"vimail/internal/outbox"
+	"vimail/internal/spell"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -13,49 +19,134 @@ import (
 type ComposerField int
 
 const (
-	ToField ComposerField = iota
+	FromField ComposerField = iota
+	ToField
 	SubjectField
 	BodyField
 )
 
+// ComposerEnv holds the shared state a composer needs from the app
+type ComposerEnv struct {
+	// Account is the name of the account the message is sent from
+	Account     string
+	EmailClient *email.Client
+	Identities  []config.Identity
+	Contacts    *contacts.Store
+	Spell       *spell.Checker
+
+	// Preferences format the dates shown while composing
+	Preferences *config.Preferences
+
+	// Markdown is the account default for composing in Markdown
+	Markdown bool
+
+	// PGP reports whether a keyring is loaded for signing and encryption
+	PGP bool
+
+	// SMIME reports whether a certificate and key are loaded for signing
+	SMIME bool
+}
+
+// maxSuggestions is how many recipient completions or spelling
+// corrections are shown at once
+const maxSuggestions = 5
+
+// spellPopup is the correction list for the word under the cursor
+type spellPopup struct {
+	field       ComposerField
+	row         int
+	start       int
+	end         int
+	word        string
+	suggestions []string
+}
+
 type ComposerModelImpl struct {
-	fromEmail    string
-	to           string
-	subject      string
-	body         []string
+	env          ComposerEnv
+	fromIndex    int
+	signature    string
+	quoted       string
+	to           *TextBuffer
+	subject      *TextBuffer
+	body         *TextBuffer
 	currentField ComposerField
-	cursorPos    int
-	bodyLine     int
+	bodyScroll   int
 	width        int
 	height       int
-	sending      bool
 	Sent         bool
 	Cancelled    bool
-	err          error
-	emailClient  *email.Client
+	suggestions  []contacts.Suggestion
+	suggestion   int
+	spelling     *spellPopup
+	status       string
+	markdown     bool
+	preview      bool
+	previewY     int
+	pgpSign      bool
+	pgpEncrypt   bool
+	smimeSign    bool
+
+	// Scheduled sending; outboxID is set when editing a scheduled message
+	schedule *TextBuffer
+	sendAt   time.Time
+	outboxID string
 }
 
-func NewComposerModelImpl(fromEmail string, emailClient *email.Client) *ComposerModelImpl {
-	return &ComposerModelImpl{
-		fromEmail:    fromEmail,
+func NewComposerModelImpl(env ComposerEnv) *ComposerModelImpl {
+	composer := &ComposerModelImpl{
+		env:          env,
+		to:           NewTextBuffer(false),
+		subject:      NewTextBuffer(false),
+		body:         NewTextBuffer(true),
 		currentField: ToField,
-		body:         []string{""},
-		bodyLine:     0,
-		cursorPos:    0,
-		emailClient:  emailClient,
+		markdown:     env.Markdown,
 	}
+	composer.resetBody("")
+	return composer
 }
 
-func NewReplyComposerModelImpl(fromEmail string, originalMsg *email.Message, emailClient *email.Client) *ComposerModelImpl {
-	composer := NewComposerModelImpl(fromEmail, emailClient)
-	composer.to = originalMsg.From
-	composer.subject = "Re: " + originalMsg.Subject
+func NewReplyComposerModelImpl(env ComposerEnv, originalMsg *email.Message) *ComposerModelImpl {
+	composer := NewComposerModelImpl(env)
+	composer.selectIdentityFor(originalMsg.Recipients())
+	composer.to.SetText(originalMsg.From)
+	composer.subject.SetText(email.PrepareReplySubject(originalMsg.Subject))
+	composer.resetBody(email.QuoteForReply(originalMsg))
+	composer.currentField = BodyField
 	return composer
 }
 
-type SendMessageMsg struct {
-	Success bool
-	Error   error
+func NewForwardComposerModelImpl(env ComposerEnv, originalMsg *email.Message) *ComposerModelImpl {
+	composer := NewComposerModelImpl(env)
+	composer.selectIdentityFor(originalMsg.Recipients())
+	composer.subject.SetText(email.PrepareForwardSubject(originalMsg.Subject))
+	composer.resetBody(email.FormatForwardBody(originalMsg))
+	return composer
+}
+
+// NewScheduledComposerModelImpl reopens a scheduled message for editing
+func NewScheduledComposerModelImpl(env ComposerEnv, id string, data email.ComposeData, sendAt time.Time) *ComposerModelImpl {
+	composer := NewComposerModelImpl(env)
+	if from, err := mail.ParseAddressList(data.From); err == nil {
+		composer.selectIdentityFor(from)
+	}
+	composer.to.SetText(data.To)
+	composer.subject.SetText(data.Subject)
+	composer.body.SetText(data.Body)
+	composer.body.Top()
+	composer.markdown = data.Markdown
+	composer.pgpSign = data.PGPSign && env.PGP
+	composer.pgpEncrypt = data.PGPEncrypt && env.PGP
+	composer.smimeSign = data.SMIMESign && env.SMIME
+	composer.outboxID = id
+	composer.sendAt = sendAt
+	composer.currentField = BodyField
+	composer.status = "Scheduled for " + env.Preferences.FormatDate(sendAt) + " • Ctrl+S: send now • Alt+T: reschedule"
+	return composer
+}
+
+// Account returns the name of the account the message is sent from
+func (m *ComposerModelImpl) Account() string {
+	return m.env.Account
 }
 
 func (m *ComposerModelImpl) Init() tea.Cmd {
@@ -63,116 +154,499 @@ func (m *ComposerModelImpl) Init() tea.Cmd {
 }
 
 func (m *ComposerModelImpl) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	if m.sending {
-		switch msg := msg.(type) {
-		case SendMessageMsg:
-			m.sending = false
-			if msg.Success {
-				m.Sent = true
-			} else {
-				m.err = msg.Error
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		m.status = ""
+		if m.preview {
+			if m.scrollPreview(msg.String()) {
+				return m, nil
+			}
+			// Any other key leaves the preview; toggling keys fall through
+			m.preview = false
+			if msg.String() != "alt+m" {
+				return m, nil
+			}
+		}
+
+		if m.spelling != nil {
+			m.handleSpellingKey(msg)
+			return m, nil
+		}
+
+		if m.schedule != nil {
+			m.handleScheduleKey(msg)
+			return m, nil
+		}
+
+		if m.currentField == ToField && len(m.suggestions) > 0 {
+			if handled := m.handleSuggestionKey(msg); handled {
+				return m, nil
 			}
 		}
-		return m, nil
-	}
 
-	switch msg := msg.(type) {
-	case tea.KeyMsg:
 		switch msg.String() {
 		case "ctrl+c", "esc":
 			m.Cancelled = true
 			return m, nil
 
 		case "ctrl+s":
-			return m, m.sendMessage()
+			// Ctrl+S sends now, even when editing a scheduled message
+			scheduled := m.sendAt
+			m.sendAt = time.Time{}
+			m.send()
+			if !m.Sent {
+				m.sendAt = scheduled
+			}
+			return m, nil
 
 		case "tab":
 			m.nextField()
+			return m, nil
 
-		case "enter":
-			return m.handleEnter()
+		case "shift+tab":
+			m.prevField()
+			return m, nil
 
-		case "backspace":
-			return m.handleBackspace()
+		case "alt+s":
+			m.openSpelling()
+			return m, nil
 
-		case "left":
-			if m.cursorPos > 0 {
-				m.cursorPos--
+		case "alt+t":
+			m.schedule = NewTextBuffer(false)
+			if !m.sendAt.IsZero() {
+				m.schedule.SetText(m.sendAt.Format("2006-01-02 15:04"))
 			}
+			return m, nil
 
-		case "right":
-			text := m.getCurrentFieldText()
-			if m.cursorPos < len(text) {
-				m.cursorPos++
+		case "alt+m":
+			m.markdown = !m.markdown
+			if m.markdown {
+				m.status = "Markdown on: body is sent as plain text and HTML"
+			} else {
+				m.status = "Markdown off: body is sent as plain text"
 			}
+			return m, nil
 
-		case "up":
-			if m.currentField == BodyField && m.bodyLine > 0 {
-				m.bodyLine--
-				newLineLen := len(m.body[m.bodyLine])
-				if m.cursorPos > newLineLen {
-					m.cursorPos = newLineLen
-				}
+		case "alt+g", "alt+e":
+			m.togglePGP(msg.String() == "alt+e")
+			return m, nil
+
+		case "alt+x":
+			m.toggleSMIME()
+			return m, nil
+
+		case "alt+p":
+			if !m.markdown {
+				m.status = "Preview is only available with Markdown on (Alt+M)"
+				return m, nil
 			}
+			m.preview = true
+			m.previewY = 0
+			return m, nil
+		}
+
+		if m.currentField == FromField {
+			return m.handleFromKey(msg)
+		}
+		updated, cmd := m.handleEditKey(msg)
+		if m.currentField == ToField {
+			m.updateSuggestions()
+		}
+		return updated, cmd
+	}
+
+	return m, nil
+}
+
+// handleSuggestionKey navigates and accepts recipient completions. It
+// reports whether the key was consumed.
+func (m *ComposerModelImpl) handleSuggestionKey(msg tea.KeyMsg) bool {
+	switch msg.String() {
+	case "down", "ctrl+n":
+		m.suggestion = (m.suggestion + 1) % len(m.suggestions)
+	case "up", "ctrl+p":
+		m.suggestion = (m.suggestion - 1 + len(m.suggestions)) % len(m.suggestions)
+	case "tab", "enter":
+		m.acceptSuggestion()
+	case "esc":
+		m.suggestions = nil
+	default:
+		return false
+	}
+	return true
+}
+
+// updateSuggestions completes the recipient currently being typed,
+// which is everything after the last comma in the To field
+func (m *ComposerModelImpl) updateSuggestions() {
+	m.suggestions = nil
+	m.suggestion = 0
+	if m.env.Contacts == nil {
+		return
+	}
+
+	text := m.to.String()
+	query := strings.TrimSpace(text[strings.LastIndex(text, ",")+1:])
+	if query == "" {
+		return
+	}
+
+	m.suggestions = m.env.Contacts.Complete(query, maxSuggestions)
+
+	// Nothing to offer once the input already matches the only candidate
+	if len(m.suggestions) == 1 && m.suggestions[0].Value == query {
+		m.suggestions = nil
+	}
+}
+
+// acceptSuggestion replaces the recipient being typed with the selected
+// completion, expanding groups into their members
+func (m *ComposerModelImpl) acceptSuggestion() {
+	chosen := m.suggestions[m.suggestion]
+	value := chosen.Value
+	if chosen.Group {
+		if expanded, ok := m.env.Contacts.ExpandGroup(chosen.Value); ok {
+			value = expanded
+		}
+	}
+
+	text := m.to.String()
+	prefix := ""
+	if idx := strings.LastIndex(text, ","); idx >= 0 {
+		prefix = text[:idx+1] + " "
+	}
 
-		case "down":
-			if m.currentField == BodyField && m.bodyLine < len(m.body)-1 {
-				m.bodyLine++
-				newLineLen := len(m.body[m.bodyLine])
-				if m.cursorPos > newLineLen {
-					m.cursorPos = newLineLen
+	m.to.SetText(prefix + value + ", ")
+	m.suggestions = nil
+	m.suggestion = 0
+}
+
+// recipientText returns the To field without the trailing separator
+// left behind by autocomplete
+func (m *ComposerModelImpl) recipientText() string {
+	return strings.Trim(strings.TrimSpace(m.to.String()), ", ")
+}
+
+// spellMarks returns the misspelled graphemes of a line in a buffer, or
+// nil when spell checking is unavailable
+func (m *ComposerModelImpl) spellMarks(buffer *TextBuffer, row int) []bool {
+	if m.env.Spell == nil {
+		return nil
+	}
+
+	var ranges [][2]int
+	for _, r := range m.env.Spell.Misspellings(buffer.Line(row)) {
+		ranges = append(ranges, [2]int{r.Start, r.End})
+	}
+	return buffer.ByteRangeColumns(row, ranges)
+}
+
+// openSpelling shows corrections for the misspelled word at the cursor
+func (m *ComposerModelImpl) openSpelling() {
+	if m.env.Spell == nil {
+		m.status = "Spell checking is not available"
+		return
+	}
+	if m.currentField != SubjectField && m.currentField != BodyField {
+		return
+	}
+
+	buffer := m.currentBuffer()
+	row, col := buffer.Cursor()
+	line := buffer.Line(row)
+	offset := buffer.ColumnByteOffset(row, col)
+
+	for _, r := range m.env.Spell.Misspellings(line) {
+		if offset < r.Start || offset > r.End {
+			continue
+		}
+
+		marks := buffer.ByteRangeColumns(row, [][2]int{{r.Start, r.End}})
+		start, end := -1, -1
+		for i, marked := range marks {
+			if marked {
+				if start < 0 {
+					start = i
 				}
+				end = i + 1
 			}
+		}
 
-		default:
-			if len(msg.String()) == 1 {
-				return m.handleCharInput(msg.String())
+		m.spelling = &spellPopup{
+			field:       m.currentField,
+			row:         row,
+			start:       start,
+			end:         end,
+			word:        r.Word,
+			suggestions: m.env.Spell.Suggest(r.Word, maxSuggestions),
+		}
+		return
+	}
+
+	m.status = "No misspelling at the cursor"
+}
+
+// handleSpellingKey applies a correction, adds the word to the personal
+// word list, or closes the popup
+func (m *ComposerModelImpl) handleSpellingKey(msg tea.KeyMsg) {
+	popup := m.spelling
+	m.spelling = nil
+
+	key := msg.String()
+	switch {
+	case key == "a":
+		if err := m.env.Spell.AddToPersonal(popup.word); err != nil {
+			m.status = err.Error()
+		} else {
+			m.status = "Added \"" + popup.word + "\" to personal dictionary"
+		}
+
+	case len(key) == 1 && key[0] >= '1' && key[0] <= '9':
+		choice := int(key[0] - '1')
+		if choice < len(popup.suggestions) {
+			buffer := m.subject
+			if popup.field == BodyField {
+				buffer = m.body
 			}
+			buffer.ReplaceRange(popup.row, popup.start, popup.end, popup.suggestions[choice])
 		}
 	}
+}
 
-	return m, nil
+func (m *ComposerModelImpl) renderSpelling() string {
+	text := "No suggestions for \"" + m.spelling.word + "\""
+	if len(m.spelling.suggestions) > 0 {
+		var choices []string
+		for i, suggestion := range m.spelling.suggestions {
+			choices = append(choices, string(rune('1'+i))+" "+suggestion)
+		}
+		text = m.spelling.word + " → " + strings.Join(choices, "  ")
+	}
+
+	return lipgloss.NewStyle().
+		Foreground(White).
+		Render(text + "  •  a: add to dictionary  •  esc: close")
 }
 
-func (m *ComposerModelImpl) View() string {
-	if m.sending {
-		return lipgloss.NewStyle().
-			Foreground(White).
-			Align(lipgloss.Center, lipgloss.Center).
-			Width(m.width).
-			Height(m.height).
-			Render("✉ Sending...")
+func (m *ComposerModelImpl) handleFromKey(msg tea.KeyMsg) (*ComposerModelImpl, tea.Cmd) {
+	switch msg.String() {
+	case "left", "up":
+		m.cycleIdentity(-1)
+	case "right", "down", " ":
+		m.cycleIdentity(1)
+	case "enter":
+		m.nextField()
 	}
+	return m, nil
+}
+
+func (m *ComposerModelImpl) handleEditKey(msg tea.KeyMsg) (*ComposerModelImpl, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		return m.handleEnter()
+
+	case "backspace":
+		m.currentBuffer().Backspace()
 
-	if m.err != nil {
-		return lipgloss.NewStyle().
-			Foreground(White).
-			Padding(2).
-			Render("✗ Error: " + m.err.Error() + "\n\nPress Esc to go back")
+	case "delete":
+		m.currentBuffer().Delete()
+
+	case "left":
+		m.currentBuffer().Left()
+
+	case "right":
+		m.currentBuffer().Right()
+
+	case "home", "ctrl+a":
+		m.currentBuffer().Home()
+
+	case "end", "ctrl+e":
+		m.currentBuffer().End()
+
+	case "up":
+		if m.currentField == BodyField {
+			m.body.Up()
+		}
+
+	case "down":
+		if m.currentField == BodyField {
+			m.body.Down()
+		}
+
+	default:
+		switch {
+		case msg.Type == tea.KeySpace:
+			m.currentBuffer().InsertString(" ")
+		case msg.Type == tea.KeyRunes && (!msg.Alt || msg.Paste):
+			m.currentBuffer().InsertString(string(msg.Runes))
+		}
 	}
 
+	return m, nil
+}
+
+func (m *ComposerModelImpl) View() string {
 	var sections []string
 
 	// Clean minimal form
+	sections = append(sections, m.renderFromField())
+	sections = append(sections, "")
 	sections = append(sections, m.renderField("To:", m.to, m.currentField == ToField))
+	if m.currentField == ToField && len(m.suggestions) > 0 {
+		sections = append(sections, m.renderSuggestions())
+	}
 	sections = append(sections, "")
 	sections = append(sections, m.renderField("Subject:", m.subject, m.currentField == SubjectField))
 	sections = append(sections, "")
-	sections = append(sections, m.renderBodyField())
+	if m.preview {
+		sections = append(sections, m.renderPreview())
+	} else {
+		sections = append(sections, m.renderBodyField())
+	}
 	sections = append(sections, "")
 
+	if m.spelling != nil {
+		sections = append(sections, m.renderSpelling())
+	} else if m.schedule != nil {
+		sections = append(sections, m.renderSchedule())
+	} else if m.status != "" {
+		sections = append(sections, lipgloss.NewStyle().Foreground(Gray).Render(m.status))
+	}
+
 	// Zen help text
 	help := lipgloss.NewStyle().
 		Foreground(Gray).
 		Align(lipgloss.Center).
-		Render("Tab: next field • Ctrl+S: send • Esc: cancel")
+		Render(m.helpText())
 
 	sections = append(sections, help)
 
 	return lipgloss.JoinVertical(lipgloss.Left, sections...)
 }
 
-func (m *ComposerModelImpl) renderField(label, value string, focused bool) string {
+// handleScheduleKey edits the send time prompt and schedules the
+// message when it is confirmed
+func (m *ComposerModelImpl) handleScheduleKey(msg tea.KeyMsg) {
+	switch msg.String() {
+	case "esc":
+		m.schedule = nil
+	case "enter":
+		sendAt, err := outbox.ParseSendTime(m.schedule.String(), time.Now())
+		if err != nil {
+			m.status = "✗ " + err.Error()
+			return
+		}
+		m.sendAt = sendAt
+		m.schedule = nil
+		m.send()
+		if !m.Sent {
+			m.sendAt = time.Time{}
+		}
+	case "backspace":
+		m.schedule.Backspace()
+	case "delete":
+		m.schedule.Delete()
+	case "left":
+		m.schedule.Left()
+	case "right":
+		m.schedule.Right()
+	default:
+		switch {
+		case msg.Type == tea.KeySpace:
+			m.schedule.InsertString(" ")
+		case msg.Type == tea.KeyRunes && (!msg.Alt || msg.Paste):
+			m.schedule.InsertString(string(msg.Runes))
+		}
+	}
+}
+
+// renderSchedule shows the send time prompt
+func (m *ComposerModelImpl) renderSchedule() string {
+	prompt := lipgloss.NewStyle().Foreground(White).Render("Send at: ") +
+		m.schedule.RenderSingleLine(m.width-12, true, nil)
+	hint := "Enter: schedule • Esc: cancel • " + outbox.ScheduleFormats
+	if m.status != "" {
+		hint = m.status
+	}
+	return lipgloss.JoinVertical(lipgloss.Left,
+		prompt,
+		lipgloss.NewStyle().Foreground(Gray).Render(hint),
+	)
+}
+
+// SendAt returns when a scheduled message should go out, or the zero
+// time for an immediate send
+func (m *ComposerModelImpl) SendAt() time.Time {
+	return m.sendAt
+}
+
+// OutboxID returns the ID of the scheduled message being edited
+func (m *ComposerModelImpl) OutboxID() string {
+	return m.outboxID
+}
+
+// togglePGP switches signing or encryption of the outgoing message
+func (m *ComposerModelImpl) togglePGP(encrypt bool) {
+	if !m.env.PGP {
+		m.status = "PGP is not available: no keyring loaded"
+		return
+	}
+
+	if encrypt {
+		m.pgpEncrypt = !m.pgpEncrypt
+	} else {
+		m.pgpSign = !m.pgpSign
+	}
+	// A message is protected with one scheme only
+	m.smimeSign = false
+
+	switch {
+	case m.pgpSign && m.pgpEncrypt:
+		m.status = "PGP: message will be signed and encrypted"
+	case m.pgpSign:
+		m.status = "PGP: message will be signed"
+	case m.pgpEncrypt:
+		m.status = "PGP: message will be encrypted"
+	default:
+		m.status = "PGP off"
+	}
+}
+
+// toggleSMIME switches S/MIME signing of the outgoing message
+func (m *ComposerModelImpl) toggleSMIME() {
+	if !m.env.SMIME {
+		m.status = "S/MIME is not available: no certificate and key loaded"
+		return
+	}
+
+	m.smimeSign = !m.smimeSign
+	if m.smimeSign {
+		m.pgpSign, m.pgpEncrypt = false, false
+		m.status = "S/MIME: message will be signed"
+	} else {
+		m.status = "S/MIME off"
+	}
+}
+
+func (m *ComposerModelImpl) helpText() string {
+	if m.preview {
+		return "Previewing Markdown • ↑↓ PgUp PgDn: scroll • any other key: back to editing"
+	}
+
+	mode := "Alt+M: markdown"
+	if m.markdown {
+		mode = "Markdown • Alt+P: preview"
+	}
+	if m.env.PGP {
+		mode += " • Alt+G: sign • Alt+E: encrypt"
+	}
+	if m.env.SMIME {
+		mode += " • Alt+X: S/MIME sign"
+	}
+	return "Tab: next field • ←→ on From: identity • Alt+S: spelling • " + mode + " • Ctrl+S: send • Alt+T: schedule • Esc: cancel"
+}
+
+func (m *ComposerModelImpl) renderField(label string, value *TextBuffer, focused bool) string {
 	labelStyle := lipgloss.NewStyle().
 		Foreground(Gray).
 		Width(10)
@@ -187,23 +661,129 @@ func (m *ComposerModelImpl) renderField(label, value string, focused bool) strin
 			BorderForeground(Blue)
 	}
 
-	// Show cursor if focused
-	displayValue := value
+	var marks []bool
+	if value == m.subject {
+		marks = m.spellMarks(value, 0)
+	}
+
+	inputWidth := m.width - 15
+	displayValue := value.RenderSingleLine(inputWidth, focused, marks)
+
+	return lipgloss.JoinHorizontal(
+		lipgloss.Top,
+		labelStyle.Render(label),
+		" ",
+		inputStyle.Width(inputWidth).Render(displayValue),
+	)
+}
+
+func (m *ComposerModelImpl) renderFromField() string {
+	focused := m.currentField == FromField
+
+	labelStyle := lipgloss.NewStyle().
+		Foreground(Gray).
+		Width(10)
+
+	valueStyle := lipgloss.NewStyle().
+		Foreground(White)
+
 	if focused {
-		if m.cursorPos <= len(value) {
-			if m.cursorPos == len(value) {
-				displayValue = value + "█"
-			} else {
-				displayValue = value[:m.cursorPos] + "█" + value[m.cursorPos+1:]
-			}
+		labelStyle = labelStyle.Foreground(Blue)
+		valueStyle = valueStyle.
+			Border(lipgloss.NormalBorder(), false, false, true, false).
+			BorderForeground(Blue)
+	}
+
+	value := m.fromAddress()
+	if focused && len(m.env.Identities) > 1 {
+		value = "‹ " + value + " ›"
+	}
+
+	return lipgloss.JoinHorizontal(
+		lipgloss.Top,
+		labelStyle.Render("From:"),
+		" ",
+		valueStyle.Width(m.width-15).Render(value),
+	)
+}
+
+func (m *ComposerModelImpl) renderSuggestions() string {
+	var lines []string
+	for i, suggestion := range m.suggestions {
+		if i == m.suggestion {
+			lines = append(lines, SelectedEmailStyle.Render(suggestion.Label))
+		} else {
+			lines = append(lines, EmailItemStyle.Render(suggestion.Label))
 		}
 	}
 
+	return lipgloss.NewStyle().
+		MarginLeft(11).
+		Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
+
+// previewHeight is how many lines of the preview fit on screen
+func (m *ComposerModelImpl) previewHeight() int {
+	return max(m.height-13, 3)
+}
+
+// previewLines renders the body the way Markdown mode will send it
+func (m *ComposerModelImpl) previewLines() []string {
+	return renderMarkdownPreview(m.body.String(), m.width-17)
+}
+
+// scrollPreview moves the preview for a scrolling key, and reports
+// whether key was one
+func (m *ComposerModelImpl) scrollPreview(key string) bool {
+	height := m.previewHeight()
+	switch key {
+	case "up", "k":
+		m.previewY--
+	case "down", "j":
+		m.previewY++
+	case "pgup":
+		m.previewY -= height
+	case "pgdown", " ":
+		m.previewY += height
+	case "home", "g":
+		m.previewY = 0
+	case "end", "G":
+		m.previewY = len(m.previewLines())
+	default:
+		return false
+	}
+	m.previewY = max(min(m.previewY, len(m.previewLines())-height), 0)
+	return true
+}
+
+// renderPreview shows the body the way Markdown mode will send it
+func (m *ComposerModelImpl) renderPreview() string {
+	labelStyle := lipgloss.NewStyle().
+		Foreground(Blue).
+		Width(10)
+
+	previewHeight := m.previewHeight()
+	lines := m.previewLines()
+	start := max(min(m.previewY, len(lines)-previewHeight), 0)
+	end := min(start+previewHeight, len(lines))
+
+	label := labelStyle.Render("Preview:")
+	if len(lines) > previewHeight {
+		label = lipgloss.JoinVertical(lipgloss.Left, label,
+			lipgloss.NewStyle().Foreground(Gray).Render(fmt.Sprintf("%d–%d/%d", start+1, end, len(lines))))
+	}
+
+	previewStyle := lipgloss.NewStyle().
+		Width(m.width - 15).
+		Height(previewHeight).
+		Border(lipgloss.NormalBorder()).
+		BorderForeground(Blue)
+
 	return lipgloss.JoinHorizontal(
 		lipgloss.Top,
-		labelStyle.Render(label),
+		label,
 		" ",
-		inputStyle.Width(m.width-15).Render(displayValue),
+		previewStyle.Render(strings.Join(lines[start:end], "\n")),
 	)
 }
 
@@ -212,31 +792,31 @@ func (m *ComposerModelImpl) renderBodyField() string {
 		Foreground(Gray).
 		Width(10)
 
-	if m.currentField == BodyField {
+	focused := m.currentField == BodyField
+	if focused {
 		labelStyle = labelStyle.Foreground(Blue)
 	}
 
-	bodyHeight := m.height - 10
+	bodyHeight := m.height - 13
+	if m.currentField == ToField {
+		bodyHeight -= len(m.suggestions)
+	}
 	if bodyHeight < 3 {
 		bodyHeight = 3
 	}
 
-	var lines []string
-	for i := 0; i < bodyHeight && i < len(m.body); i++ {
-		line := m.body[i]
-
-		// Show cursor on current line if in body field
-		if m.currentField == BodyField && i == m.bodyLine {
-			if m.cursorPos <= len(line) {
-				if m.cursorPos == len(line) {
-					line = line + "█"
-				} else {
-					line = line[:m.cursorPos] + "█" + line[m.cursorPos+1:]
-				}
-			}
-		}
+	// Keep the cursor line inside the visible window
+	row, _ := m.body.Cursor()
+	if row < m.bodyScroll {
+		m.bodyScroll = row
+	}
+	if row >= m.bodyScroll+bodyHeight {
+		m.bodyScroll = row - bodyHeight + 1
+	}
 
-		lines = append(lines, line)
+	var lines []string
+	for i := m.bodyScroll; i < m.bodyScroll+bodyHeight && i < m.body.LineCount(); i++ {
+		lines = append(lines, m.body.RenderLine(i, focused, m.spellMarks(m.body, i)))
 	}
 
 	// Fill empty lines
@@ -249,7 +829,7 @@ func (m *ComposerModelImpl) renderBodyField() string {
 		Width(m.width - 15).
 		Height(bodyHeight)
 
-	if m.currentField == BodyField {
+	if focused {
 		bodyStyle = bodyStyle.
 			Border(lipgloss.NormalBorder()).
 			BorderForeground(Blue)
@@ -267,132 +847,170 @@ func (m *ComposerModelImpl) renderBodyField() string {
 
 func (m *ComposerModelImpl) nextField() {
 	switch m.currentField {
+	case FromField:
+		m.currentField = ToField
 	case ToField:
 		m.currentField = SubjectField
 	case SubjectField:
 		m.currentField = BodyField
 	case BodyField:
-		m.currentField = ToField
+		m.currentField = FromField
+	}
+	if m.currentField == ToField || m.currentField == SubjectField {
+		m.currentBuffer().End()
 	}
-	m.cursorPos = len(m.getCurrentFieldText())
 }
 
-func (m *ComposerModelImpl) getCurrentFieldText() string {
+func (m *ComposerModelImpl) prevField() {
 	switch m.currentField {
+	case FromField:
+		m.currentField = BodyField
 	case ToField:
-		return m.to
+		m.currentField = FromField
 	case SubjectField:
-		return m.subject
+		m.currentField = ToField
 	case BodyField:
-		if m.bodyLine < len(m.body) {
-			return m.body[m.bodyLine]
-		}
-		return ""
+		m.currentField = SubjectField
+	}
+	if m.currentField == ToField || m.currentField == SubjectField {
+		m.currentBuffer().End()
+	}
+}
+
+// fromAddress returns the From header for the selected identity
+func (m *ComposerModelImpl) fromAddress() string {
+	if m.fromIndex < len(m.env.Identities) {
+		return m.env.Identities[m.fromIndex].Address()
+	}
+	if m.env.EmailClient != nil {
+		return m.env.EmailClient.GetUserEmail()
 	}
 	return ""
 }
 
-func (m *ComposerModelImpl) handleEnter() (*ComposerModelImpl, tea.Cmd) {
-	if m.currentField == BodyField {
-		currentLine := ""
-		if m.bodyLine < len(m.body) {
-			currentLine = m.body[m.bodyLine]
+// selectIdentityFor picks the identity a message was addressed to, so
+// replies go out from the same address
+func (m *ComposerModelImpl) selectIdentityFor(recipients []*mail.Address) {
+	for i, identity := range m.env.Identities {
+		for _, recipient := range recipients {
+			if strings.EqualFold(recipient.Address, identity.Email) {
+				m.setIdentity(i)
+				return
+			}
 		}
+	}
+}
 
-		beforeCursor := currentLine[:m.cursorPos]
-		afterCursor := currentLine[m.cursorPos:]
+func (m *ComposerModelImpl) cycleIdentity(delta int) {
+	if len(m.env.Identities) < 2 {
+		return
+	}
+	next := (m.fromIndex + delta + len(m.env.Identities)) % len(m.env.Identities)
+	m.setIdentity(next)
+}
 
-		m.body[m.bodyLine] = beforeCursor
-		newLine := afterCursor
+// setIdentity switches the From identity and swaps the signature in the
+// body for the one belonging to the new identity
+func (m *ComposerModelImpl) setIdentity(index int) {
+	m.fromIndex = index
+	signature := email.FormatSignature(m.env.Identities[index].Signature)
+	if signature == m.signature {
+		return
+	}
 
-		m.body = append(m.body[:m.bodyLine+1], append([]string{newLine}, m.body[m.bodyLine+1:]...)...)
-		m.bodyLine++
-		m.cursorPos = 0
-	} else {
-		m.nextField()
+	text := m.body.String()
+	switch {
+	case m.signature != "" && strings.Contains(text, m.signature):
+		text = strings.Replace(text, m.signature, signature, 1)
+	case m.signature == "" && m.quoted != "" && strings.HasSuffix(text, m.quoted):
+		text = strings.TrimSuffix(text, m.quoted) + signature + "\n\n" + m.quoted
+	default:
+		text = strings.TrimRight(text, "\n") + "\n\n" + signature
 	}
+	m.signature = signature
 
-	return m, nil
+	row, col := m.body.Cursor()
+	m.body.SetText(text)
+	m.body.SetCursor(row, col)
 }
 
-func (m *ComposerModelImpl) handleBackspace() (*ComposerModelImpl, tea.Cmd) {
-	if m.currentField == BodyField {
-		if m.cursorPos > 0 {
-			line := m.body[m.bodyLine]
-			m.body[m.bodyLine] = line[:m.cursorPos-1] + line[m.cursorPos:]
-			m.cursorPos--
-		} else if m.bodyLine > 0 {
-			prevLine := m.body[m.bodyLine-1]
-			currentLine := m.body[m.bodyLine]
-
-			m.body = append(m.body[:m.bodyLine], m.body[m.bodyLine+1:]...)
-			m.bodyLine--
-			m.body[m.bodyLine] = prevLine + currentLine
-			m.cursorPos = len(prevLine)
-		}
-	} else {
-		text := m.getCurrentFieldText()
-		if m.cursorPos > 0 {
-			newText := text[:m.cursorPos-1] + text[m.cursorPos:]
-			m.setCurrentFieldText(newText)
-			m.cursorPos--
-		}
+// resetBody fills the body with the signature of the current identity
+// followed by quoted text, leaving the cursor above both
+func (m *ComposerModelImpl) resetBody(quoted string) {
+	m.quoted = quoted
+	m.signature = ""
+	if m.fromIndex < len(m.env.Identities) {
+		m.signature = email.FormatSignature(m.env.Identities[m.fromIndex].Signature)
 	}
 
-	return m, nil
-}
-
-func (m *ComposerModelImpl) handleCharInput(char string) (*ComposerModelImpl, tea.Cmd) {
-	if m.currentField == BodyField {
-		line := m.body[m.bodyLine]
-		newLine := line[:m.cursorPos] + char + line[m.cursorPos:]
-		m.body[m.bodyLine] = newLine
-		m.cursorPos++
-	} else {
-		text := m.getCurrentFieldText()
-		newText := text[:m.cursorPos] + char + text[m.cursorPos:]
-		m.setCurrentFieldText(newText)
-		m.cursorPos++
+	var parts []string
+	if m.signature != "" {
+		parts = append(parts, m.signature)
+	}
+	if quoted != "" {
+		parts = append(parts, quoted)
 	}
 
-	return m, nil
+	text := ""
+	if len(parts) > 0 {
+		text = "\n\n" + strings.Join(parts, "\n\n")
+	}
+	m.body.SetText(text)
+	m.body.Top()
 }
 
-func (m *ComposerModelImpl) setCurrentFieldText(text string) {
+func (m *ComposerModelImpl) currentBuffer() *TextBuffer {
 	switch m.currentField {
 	case ToField:
-		m.to = text
+		return m.to
 	case SubjectField:
-		m.subject = text
-	case BodyField:
-		if m.bodyLine < len(m.body) {
-			m.body[m.bodyLine] = text
-		}
+		return m.subject
 	}
+	return m.body
 }
 
-func (m *ComposerModelImpl) sendMessage() tea.Cmd {
-	composeData := email.ComposeData{
-		To:      strings.TrimSpace(m.to),
-		Subject: strings.TrimSpace(m.subject),
-		Body:    strings.Join(m.body, "\n"),
+func (m *ComposerModelImpl) handleEnter() (*ComposerModelImpl, tea.Cmd) {
+	if m.currentField == BodyField {
+		m.body.InsertNewline()
+	} else {
+		m.nextField()
 	}
 
-	if err := composeData.Validate(); err != nil {
-		return func() tea.Msg {
-			return SendMessageMsg{Success: false, Error: err}
-		}
-	}
+	return m, nil
+}
 
-	m.sending = true
+// ComposeData returns the message as it will be sent
+func (m *ComposerModelImpl) ComposeData() email.ComposeData {
+	return email.ComposeData{
+		From:    m.fromAddress(),
+		To:      m.recipientText(),
+		Subject: strings.TrimSpace(m.subject.String()),
+		Body:    m.body.String(),
+
+		Markdown:   m.markdown,
+		PGPSign:    m.pgpSign,
+		PGPEncrypt: m.pgpEncrypt,
+		SMIMESign:  m.smimeSign,
+	}
+}
 
-	return func() tea.Msg {
-		err := m.emailClient.SendMessage(context.Background(), composeData.To, composeData.Subject, composeData.Body)
-		return SendMessageMsg{
-			Success: err == nil,
-			Error:   err,
-		}
+// send validates the message and marks the composer as done. The app
+// then holds the message for the send delay before it goes out.
+func (m *ComposerModelImpl) send() {
+	composeData := m.ComposeData()
+	if err := composeData.Validate(); err != nil {
+		m.status = "✗ " + err.Error()
+		return
 	}
+	m.Sent = true
+}
+
+// Reopen puts a sent composer back into editing, for undo or after a
+// failed send
+func (m *ComposerModelImpl) Reopen(status string) {
+	m.Sent = false
+	m.Cancelled = false
+	m.status = status
 }
 
 func (m *ComposerModelImpl) SetSize(width, height int) {
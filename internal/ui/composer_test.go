@@ -0,0 +1,67 @@
+package ui
+
+import (
+	"testing"
+	"time"
+	"vimail/internal/config"
+	"vimail/internal/email"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+func testMessage(t *testing.T, headers map[string]string) *email.Message {
+	t.Helper()
+	payload := &gmail.MessagePart{MimeType: "text/plain", Body: &gmail.MessagePartBody{}}
+	for name, value := range headers {
+		payload.Headers = append(payload.Headers, &gmail.MessagePartHeader{Name: name, Value: value})
+	}
+	msg, err := email.NewMessageFromGmail(&gmail.Message{Id: "1", Payload: payload})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func identityEnv() ComposerEnv {
+	return ComposerEnv{
+		Preferences: config.DefaultPreferences(),
+		Identities: []config.Identity{
+			{Email: "alice@example.com"},
+			{Email: "bob@example.com", Name: "Bob"},
+		},
+	}
+}
+
+func TestReplySelectsAddressedIdentity(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"to", map[string]string{"To": "Bob <bob@example.com>"}, "bob@example.com"},
+		{"cc", map[string]string{"To": "team@example.com", "Cc": "BOB@Example.com"}, "bob@example.com"},
+		{"substring", map[string]string{"To": "jimbob@example.com.au"}, "alice@example.com"},
+		{"none", map[string]string{"To": "carol@example.org"}, "alice@example.com"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			headers := map[string]string{"From": "carol@example.org", "Subject": "Hi"}
+			for name, value := range test.headers {
+				headers[name] = value
+			}
+			composer := NewReplyComposerModelImpl(identityEnv(), testMessage(t, headers))
+			if got := composer.env.Identities[composer.fromIndex].Email; got != test.want {
+				t.Errorf("reply is from %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestScheduledSelectsSavedIdentity(t *testing.T) {
+	data := email.ComposeData{From: "Bob <bob@example.com>", To: "carol@example.org"}
+	composer := NewScheduledComposerModelImpl(identityEnv(), "id", data, time.Now())
+	if composer.fromIndex != 1 {
+		t.Errorf("scheduled message is from %s, want bob@example.com", composer.fromAddress())
+	}
+}
@@ -3,6 +3,11 @@ package ui
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"vimail/internal/config"
 	"vimail/internal/email"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -10,29 +15,39 @@ import (
 )
 
 type InboxModelImpl struct {
-	emailClient *email.Client
-	ctx         context.Context
-	messages    []*email.Message
-	selected    int
-	width       int
-	height      int
-	loading     bool
-	err         error
+	sources    []Mailbox
+	prefs      *config.Preferences
+	keys       keyMap
+	unified    bool
+	generation int
+	ctx        context.Context
+	messages   []*email.Message
+	selected   int
+	width      int
+	height     int
+	loading    bool
+	err        error
 }
 
-func NewInboxModelImpl(ctx context.Context, emailClient *email.Client) *InboxModelImpl {
+func NewInboxModelImpl(ctx context.Context, sources []Mailbox, prefs *config.Preferences, keys keyMap) *InboxModelImpl {
 	return &InboxModelImpl{
-		emailClient: emailClient,
-		ctx:         ctx,
-		messages:    []*email.Message{},
-		selected:    0,
-		loading:     false,
+		sources:  sources,
+		prefs:    prefs,
+		keys:     keys,
+		ctx:      ctx,
+		messages: []*email.Message{},
+		selected: 0,
+		loading:  false,
 	}
 }
 
 type LoadMessagesMsg struct {
 	Messages []*email.Message
 	Error    error
+
+	// generation ties the result to the load that asked for it, so a
+	// slow load doesn't overwrite the inbox after switching accounts
+	generation int
 }
 
 func (m *InboxModelImpl) Init() tea.Cmd {
@@ -46,24 +61,26 @@ func (m *InboxModelImpl) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 
-		switch msg.String() {
-		case "up", "k":
+		switch m.keys.action(msg) {
+		case config.ActionUp:
 			if m.selected > 0 {
 				m.selected--
 			}
-		case "down", "j":
+		case config.ActionDown:
 			if m.selected < len(m.messages)-1 {
 				m.selected++
 			}
 		}
 
 	case LoadMessagesMsg:
+		if msg.generation != m.generation {
+			return m, nil
+		}
 		m.loading = false
-		if msg.Error != nil {
-			m.err = msg.Error
-		} else {
+		m.err = msg.Error
+		// In the unified inbox one account failing still shows the others
+		if msg.Error == nil || len(msg.Messages) > 0 {
 			m.messages = msg.Messages
-			m.err = nil
 			if m.selected >= len(m.messages) {
 				m.selected = len(m.messages) - 1
 			}
@@ -94,7 +111,11 @@ func (m *InboxModelImpl) View() string {
 	var lines []string
 	for i, msg := range m.messages {
 		selected := i == m.selected
-		line := FormatEmailLine(msg.GetDisplayFrom(), msg.Subject, selected)
+		from := msg.GetDisplayFrom()
+		if m.unified {
+			from = "[" + msg.Account + "] " + from
+		}
+		line := FormatEmailLine(m.prefs.FormatDate(msg.Date)+"  "+from, msg.Subject, selected)
 		lines = append(lines, line)
 	}
 
@@ -104,19 +125,77 @@ func (m *InboxModelImpl) View() string {
 
 func (m *InboxModelImpl) LoadMessages() tea.Cmd {
 	m.loading = true
+	m.generation++
+	sources, ctx, generation, pageSize := m.sources, m.ctx, m.generation, m.prefs.PageSize
 	return func() tea.Msg {
-		messages, err := m.emailClient.GetInboxMessages(m.ctx, 20)
+		messages, err := loadInboxes(ctx, sources, pageSize)
 		return LoadMessagesMsg{
-			Messages: messages,
-			Error:    err,
+			Messages:   messages,
+			Error:      err,
+			generation: generation,
 		}
 	}
 }
 
+// loadInboxes fetches the inbox of every source at once and merges them
+// newest first, marking each message with its account. Each inbox
+// contributes up to pageSize messages.
+func loadInboxes(ctx context.Context, sources []Mailbox, pageSize int) ([]*email.Message, error) {
+	results := make([][]*email.Message, len(sources))
+	errs := make([]error, len(sources))
+
+	var wg sync.WaitGroup
+	for i, source := range sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			messages, err := source.Client.GetInboxMessages(ctx, int64(pageSize))
+			if err != nil && len(sources) > 1 {
+				err = fmt.Errorf("%s: %w", source.Account.Name, err)
+			}
+			for _, msg := range messages {
+				msg.Account = source.Account.Name
+			}
+			results[i], errs[i] = messages, err
+		}()
+	}
+	wg.Wait()
+
+	var merged []*email.Message
+	for _, messages := range results {
+		merged = append(merged, messages...)
+	}
+	if len(sources) > 1 {
+		sort.SliceStable(merged, func(i, j int) bool {
+			return merged[i].Date.After(merged[j].Date)
+		})
+	}
+	return merged, errors.Join(errs...)
+}
+
+// SetSources changes which accounts the inbox shows; unified marks each
+// message with its account
+func (m *InboxModelImpl) SetSources(sources []Mailbox, unified bool) {
+	m.sources = sources
+	m.unified = unified
+	m.messages = nil
+	m.selected = 0
+	m.err = nil
+}
+
 func (m *InboxModelImpl) Refresh() tea.Cmd {
 	return m.LoadMessages()
 }
 
+// SetPreferences switches to reloaded preferences and key bindings. It
+// reports whether the page size changed, which needs a reload.
+func (m *InboxModelImpl) SetPreferences(prefs *config.Preferences, keys keyMap) bool {
+	resize := prefs.PageSize != m.prefs.PageSize
+	m.prefs = prefs
+	m.keys = keys
+	return resize
+}
+
 func (m *InboxModelImpl) SetSize(width, height int) {
 	m.width = width
 	m.height = height
@@ -129,6 +208,16 @@ func (m *InboxModelImpl) GetSelectedMessage() *email.Message {
 	return nil
 }
 
+// ReplaceMessage swaps in an updated copy of a message with the same ID
+func (m *InboxModelImpl) ReplaceMessage(updated *email.Message) {
+	for i, msg := range m.messages {
+		if msg.ID == updated.ID {
+			m.messages[i] = updated
+			return
+		}
+	}
+}
+
 func (m *InboxModelImpl) MessageCount() int {
 	return len(m.messages)
 }
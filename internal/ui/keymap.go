@@ -0,0 +1,69 @@
+// internal/ui/keymap.go - Key bindings from the preferences
+package ui
+
+import (
+	"slices"
+	"strings"
+	"vimail/internal/config"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// keyMap maps a pressed key to its action in the preferences keymap.
+// The outbox actions may share keys with others, so they are only
+// matched with is.
+type keyMap struct {
+	actions map[string]string
+	keys    map[string][]string
+}
+
+// newKeyMap builds the lookup for the bindings of the preferences
+func newKeyMap(prefs *config.Preferences) keyMap {
+	k := keyMap{actions: map[string]string{}, keys: prefs.Bindings()}
+	for action, keys := range k.keys {
+		if config.IsOutboxAction(action) {
+			continue
+		}
+		for _, key := range keys {
+			k.actions[teaKeyName(key)] = action
+		}
+	}
+	return k
+}
+
+// teaKeyName converts the key names of the preferences to those of
+// tea.KeyMsg.String, which reports the space bar as " "
+func teaKeyName(key string) string {
+	if name, ok := strings.CutSuffix(key, "space"); ok {
+		return name + " "
+	}
+	return key
+}
+
+// action returns the action bound to the pressed key, if any
+func (k keyMap) action(msg tea.KeyMsg) string {
+	return k.actions[msg.String()]
+}
+
+// is reports whether the pressed key is bound to action
+func (k keyMap) is(msg tea.KeyMsg, action string) bool {
+	return slices.ContainsFunc(k.keys[action], func(key string) bool {
+		return teaKeyName(key) == msg.String()
+	})
+}
+
+// help returns the keys of an action for the help line, such as "q" or
+// "↑/k"
+func (k keyMap) help(action string) string {
+	names := make([]string, len(k.keys[action]))
+	for i, key := range k.keys[action] {
+		switch key {
+		case "up":
+			key = "↑"
+		case "down":
+			key = "↓"
+		}
+		names[i] = key
+	}
+	return strings.Join(names, "/")
+}
@@ -0,0 +1,287 @@
+// internal/ui/outbox.go - Scheduled and queued messages
+package ui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"vimail/internal/config"
+	"vimail/internal/email"
+	"vimail/internal/outbox"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// outboxFlushInterval is how often the running client sends messages
+// that have become due
+const outboxFlushInterval = 30 * time.Second
+
+type OutboxModelImpl struct {
+	store    *outbox.Store
+	prefs    *config.Preferences
+	keys     keyMap
+	messages []*outbox.Message
+	selected int
+	width    int
+	height   int
+	err      error
+}
+
+func NewOutboxModelImpl(store *outbox.Store, prefs *config.Preferences, keys keyMap) *OutboxModelImpl {
+	return &OutboxModelImpl{store: store, prefs: prefs, keys: keys}
+}
+
+// OutboxLoadedMsg carries the contents of the outbox
+type OutboxLoadedMsg struct {
+	Messages []*outbox.Message
+	Error    error
+}
+
+// OutboxFlushedMsg reports the scheduled messages sent in the background
+type OutboxFlushedMsg struct {
+	Results []outbox.Result
+	Error   error
+}
+
+type outboxTickMsg struct{}
+
+func outboxTick() tea.Cmd {
+	return tea.Tick(outboxFlushInterval, func(time.Time) tea.Msg {
+		return outboxTickMsg{}
+	})
+}
+
+// flushOutbox sends every scheduled message from the account that is due
+func flushOutbox(ctx context.Context, store *outbox.Store, account string, client *email.Client) tea.Cmd {
+	return func() tea.Msg {
+		results, err := store.Flush(ctx, account, client, time.Now())
+		return OutboxFlushedMsg{Results: results, Error: err}
+	}
+}
+
+func (m *OutboxModelImpl) Init() tea.Cmd {
+	return m.Load()
+}
+
+// Load reads the outbox from disk
+func (m *OutboxModelImpl) Load() tea.Cmd {
+	store := m.store
+	return func() tea.Msg {
+		messages, err := store.List()
+		return OutboxLoadedMsg{Messages: messages, Error: err}
+	}
+}
+
+func (m *OutboxModelImpl) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch m.keys.action(msg) {
+		case config.ActionUp:
+			if m.selected > 0 {
+				m.selected--
+			}
+		case config.ActionDown:
+			if m.selected < len(m.messages)-1 {
+				m.selected++
+			}
+		}
+
+	case OutboxLoadedMsg:
+		m.err = msg.Error
+		if msg.Error == nil {
+			m.messages = msg.Messages
+			if m.selected >= len(m.messages) {
+				m.selected = len(m.messages) - 1
+			}
+			if m.selected < 0 {
+				m.selected = 0
+			}
+		}
+	}
+
+	return m, nil
+}
+
+func (m *OutboxModelImpl) View() string {
+	if m.err != nil {
+		return lipgloss.NewStyle().
+			Foreground(Gray).
+			Padding(5, 2).
+			Render("✗ " + m.err.Error())
+	}
+
+	if len(m.messages) == 0 {
+		return lipgloss.NewStyle().
+			Foreground(Gray).
+			Padding(5, 2).
+			Render("Outbox is empty")
+	}
+
+	var lines []string
+	for i, msg := range m.messages {
+		when := m.prefs.FormatDate(msg.SendAt)
+		subject := msg.Data.Subject
+		switch {
+		case msg.Failed:
+			subject += " (failed: " + msg.LastError + ", " + m.keys.help(config.ActionEditScheduled) + ": edit)"
+		case msg.Retrying():
+			when = "retry " + msg.NextAttempt.Format("15:04:05")
+			subject += fmt.Sprintf(" (attempt %d failed: %s)", msg.Attempts, msg.LastError)
+		}
+		lines = append(lines, FormatEmailLine(when+"  "+msg.Data.To, subject, i == m.selected))
+	}
+
+	help := lipgloss.NewStyle().
+		Foreground(Gray).
+		Render(strings.Join([]string{
+			m.keys.help(config.ActionEditScheduled) + ": edit",
+			m.keys.help(config.ActionSendNow) + ": send now",
+			m.keys.help(config.ActionCancelScheduled) + ": cancel",
+			m.keys.help(config.ActionBack) + ": back",
+		}, " • "))
+
+	content := lipgloss.JoinVertical(lipgloss.Left, lines...)
+	return lipgloss.JoinVertical(lipgloss.Left, SimpleBorderStyle.Render(content), help)
+}
+
+// SetPreferences switches to reloaded preferences and key bindings
+func (m *OutboxModelImpl) SetPreferences(prefs *config.Preferences, keys keyMap) {
+	m.prefs = prefs
+	m.keys = keys
+}
+
+func (m *OutboxModelImpl) SetSize(width, height int) {
+	m.width = width
+	m.height = height
+}
+
+// QueuedCount returns how many messages are waiting to be retried
+func (m *OutboxModelImpl) QueuedCount() int {
+	count := 0
+	for _, msg := range m.messages {
+		if msg.Retrying() {
+			count++
+		}
+	}
+	return count
+}
+
+// GetSelectedMessage returns the highlighted scheduled message
+func (m *OutboxModelImpl) GetSelectedMessage() *outbox.Message {
+	if m.selected >= 0 && m.selected < len(m.messages) {
+		return m.messages[m.selected]
+	}
+	return nil
+}
+
+// handleOutboxKey edits, cancels or sends the selected scheduled message
+func (m Model) handleOutboxKey(msg tea.KeyMsg) (Model, tea.Cmd) {
+	selected := m.outbox.GetSelectedMessage()
+	store := m.outbox.store
+
+	switch {
+	case m.keys.is(msg, config.ActionBack):
+		m.viewMode = InboxView
+		return m, nil
+
+	case m.keys.is(msg, config.ActionEditScheduled) || m.keys.is(msg, config.ActionOpen):
+		if selected != nil {
+			if selected.Leased(time.Now()) {
+				m.status = "Message is being sent, it can't be edited"
+				return m, nil
+			}
+			// Editing re-queues the message under the composer's account,
+			// so it must be the one the message was queued for
+			mb := m.mailboxFor(selected.Account)
+			if mb == nil {
+				m.status = notConnected(selected.Account) + ", can't edit the message"
+				return m, nil
+			}
+			composer := NewScheduledComposerModelImpl(m.composerEnv(mb), selected.ID, selected.Data, selected.SendAt)
+			return m.openComposer(composer)
+		}
+
+	case m.keys.is(msg, config.ActionCancelScheduled):
+		if selected != nil {
+			_, err := store.Remove(selected.ID)
+			switch {
+			case errors.Is(err, outbox.ErrLeased):
+				m.status = "Message is being sent, it can't be cancelled"
+			case err != nil:
+				m.status = "✗ " + err.Error()
+			default:
+				m.status = "Cancelled scheduled message"
+			}
+			return m, m.outbox.Load()
+		}
+
+	case m.keys.is(msg, config.ActionSendNow):
+		if selected != nil {
+			mb := m.mailboxFor(selected.Account)
+			if mb == nil {
+				m.status = notConnected(selected.Account) + ", can't send the message"
+				return m, nil
+			}
+			if err := store.Reschedule(selected.ID, time.Now()); errors.Is(err, outbox.ErrLeased) {
+				m.status = "Message is being sent"
+				return m, m.outbox.Load()
+			} else if err != nil {
+				m.status = "✗ " + err.Error()
+				return m, nil
+			}
+			return m, flushOutbox(m.ctx, store, mb.name(), mb.Client)
+		}
+	}
+
+	updated, cmd := m.outbox.Update(msg)
+	if outboxModel, ok := updated.(*OutboxModelImpl); ok {
+		m.outbox = outboxModel
+	}
+	return m, cmd
+}
+
+// handleOutboxFlushed reports scheduled messages sent in the background
+func (m Model) handleOutboxFlushed(msg OutboxFlushedMsg) (Model, tea.Cmd) {
+	var cmds []tea.Cmd
+
+	sent := 0
+	for _, result := range msg.Results {
+		switch {
+		case result.Error == nil:
+			sent++
+			cmds = append(cmds, m.recordSent(result.Message.Data))
+		case result.Permanent():
+			// The message stays in the outbox until the edit is sent
+			m.status = "✗ Send failed: " + result.Error.Error()
+			queued := result.Message
+			if mb := m.mailboxFor(queued.Account); mb != nil {
+				composer := NewScheduledComposerModelImpl(m.composerEnv(mb), queued.ID, queued.Data, queued.SendAt)
+				m.sendBack(composer)
+			}
+		default:
+			m.status = "⟳ Send failed, will retry: " + result.Error.Error()
+		}
+	}
+
+	switch {
+	case msg.Error != nil:
+		m.status = "✗ Outbox: " + msg.Error.Error()
+	case sent == 1:
+		m.status = "✓ Sent 1 scheduled message"
+	case sent > 1:
+		m.status = fmt.Sprintf("✓ Sent %d scheduled messages", sent)
+	}
+
+	if len(msg.Results) > 0 {
+		cmds = append(cmds, m.inbox.Refresh(), m.outbox.Load())
+	}
+	if m.viewMode != ComposerView {
+		var cmd tea.Cmd
+		m, cmd = m.reopenNext()
+		cmds = append(cmds, cmd)
+	}
+	return m, tea.Batch(cmds...)
+}
@@ -0,0 +1,283 @@
+// internal/ui/pending.go - Send delay with undo
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"vimail/internal/email"
+	"vimail/internal/outbox"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// pendingSend is a message held back for the send delay so it can
+// still be undone
+type pendingSend struct {
+	composer *ComposerModelImpl
+	data     email.ComposeData
+	deadline time.Time
+}
+
+// SendMessageMsg reports the result of sending a message
+type SendMessageMsg struct {
+	Composer *ComposerModelImpl
+	Data     email.ComposeData
+	Error    error
+}
+
+// pendingTickMsg drives the send delay countdown
+type pendingTickMsg struct{}
+
+func pendingTick() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg {
+		return pendingTickMsg{}
+	})
+}
+
+// queueSend puts a scheduled message in the outbox, or holds a finished
+// composer's message for the send delay, or sends it right away when
+// there is no delay
+func (m Model) queueSend(composer *ComposerModelImpl) (Model, tea.Cmd) {
+	data := composer.ComposeData()
+	store := m.outbox.store
+
+	// An edited scheduled message is taken out of the outbox first, unless
+	// the background flush got to it already
+	if id := composer.OutboxID(); id != "" {
+		found, err := store.Remove(id)
+		if errors.Is(err, outbox.ErrLeased) {
+			m.status = "Message is being sent, the edit wasn't saved"
+			return m, m.outbox.Load()
+		}
+		if err != nil {
+			m.status = "✗ " + err.Error()
+			composer.Reopen(m.status)
+			m.reopen = append(m.reopen, composer)
+			return m, nil
+		}
+		if !found {
+			m.status = "Scheduled message was already sent"
+			return m, nil
+		}
+	}
+
+	if !composer.SendAt().IsZero() {
+		msg, err := store.Add(composer.Account(), composer.OutboxID(), data, composer.SendAt())
+		if err != nil {
+			m.status = "✗ Failed to schedule message: " + err.Error()
+			composer.Reopen(m.status)
+			m.reopen = append(m.reopen, composer)
+			return m, nil
+		}
+		m.status = "Scheduled for " + m.prefs.FormatDate(msg.SendAt)
+		return m, m.outbox.Load()
+	}
+
+	delay := m.prefs.SendDelayDuration()
+	if delay <= 0 {
+		return m.dispatchSend(composer, data)
+	}
+
+	m.pending = append(m.pending, &pendingSend{
+		composer: composer,
+		data:     data,
+		deadline: time.Now().Add(delay),
+	})
+	if m.ticking {
+		return m, nil
+	}
+	m.ticking = true
+	return m, pendingTick()
+}
+
+// dispatchSend starts the API call for a message
+func (m Model) dispatchSend(composer *ComposerModelImpl, data email.ComposeData) (Model, tea.Cmd) {
+	// The account may have been removed while the message waited
+	mb := m.mailboxFor(composer.Account())
+	if mb == nil {
+		m.status = notConnected(composer.Account()) + ", the message wasn't sent"
+		m.sendBack(composer)
+		if m.viewMode != ComposerView {
+			return m.reopenNext()
+		}
+		return m, nil
+	}
+
+	m.inFlight++
+	client, ctx := mb.Client, m.ctx
+	return m, func() tea.Msg {
+		err := client.SendMessage(ctx, &data)
+		return SendMessageMsg{Composer: composer, Data: data, Error: err}
+	}
+}
+
+// flushPending sends every message whose delay is over, or all of them
+// when force is set
+func (m Model) flushPending(force bool) (Model, tea.Cmd) {
+	var cmds []tea.Cmd
+	var waiting []*pendingSend
+	now := time.Now()
+
+	for _, p := range m.pending {
+		if !force && now.Before(p.deadline) {
+			waiting = append(waiting, p)
+			continue
+		}
+		var cmd tea.Cmd
+		m, cmd = m.dispatchSend(p.composer, p.data)
+		cmds = append(cmds, cmd)
+	}
+	m.pending = waiting
+
+	return m, tea.Batch(cmds...)
+}
+
+// undoSend takes the most recent pending message back into the composer
+func (m Model) undoSend() (Model, tea.Cmd) {
+	if len(m.pending) == 0 {
+		return m, nil
+	}
+
+	last := m.pending[len(m.pending)-1]
+	m.pending = m.pending[:len(m.pending)-1]
+	last.composer.Reopen("Sending cancelled")
+	return m.openComposer(last.composer)
+}
+
+// handleSendResult reports a finished send. A temporary failure queues
+// the message in the outbox for retry; a permanent one sends it back to
+// the composer so it can be fixed.
+func (m Model) handleSendResult(msg SendMessageMsg) (Model, tea.Cmd) {
+	m.inFlight--
+
+	var cmds []tea.Cmd
+	switch {
+	case msg.Error == nil:
+		m.status = "✓ Message sent"
+		cmds = append(cmds, m.recordSent(msg.Data), m.inbox.Refresh())
+
+	case email.IsRetryable(msg.Error):
+		queued, err := m.outbox.store.Queue(msg.Composer.Account(), msg.Data, msg.Error, time.Now())
+		if err == nil {
+			m.status = "⟳ Send failed, will retry in " + time.Until(queued.NextAttempt).Round(time.Second).String()
+			cmds = append(cmds, m.outbox.Load())
+			break
+		}
+		m.status = "✗ Send failed and could not be queued: " + err.Error()
+		m.sendBack(msg.Composer)
+
+	default:
+		m.status = "✗ Send failed: " + msg.Error.Error()
+		m.sendBack(msg.Composer)
+	}
+
+	if m.quitting && m.inFlight == 0 {
+		return m, tea.Quit
+	}
+
+	if m.viewMode != ComposerView {
+		var cmd tea.Cmd
+		m, cmd = m.reopenNext()
+		cmds = append(cmds, cmd)
+	}
+	return m, tea.Batch(cmds...)
+}
+
+// sendBack queues a composer to be reopened with the current status,
+// and stays open so the message can be fixed instead of lost
+func (m *Model) sendBack(composer *ComposerModelImpl) {
+	composer.Reopen(m.status)
+	m.reopen = append(m.reopen, composer)
+	m.quitting = false
+}
+
+// reopenNext opens the next composer waiting to be edited after a
+// failed send
+func (m Model) reopenNext() (Model, tea.Cmd) {
+	if len(m.reopen) == 0 {
+		return m, nil
+	}
+	next := m.reopen[0]
+	m.reopen = m.reopen[1:]
+	return m.openComposer(next)
+}
+
+// recordSent updates the address book after a successful send
+func (m Model) recordSent(data email.ComposeData) tea.Cmd {
+	store := m.contacts
+	if store == nil {
+		return nil
+	}
+
+	addrs, err := data.Recipients()
+	if err != nil {
+		return nil
+	}
+	store.RecordSent(addrs, time.Now())
+
+	return func() tea.Msg {
+		if err := store.Save(); err != nil {
+			return NewErrorMsg(fmt.Errorf("failed to save contacts: %w", err))
+		}
+		return nil
+	}
+}
+
+// requestQuit quits at once unless messages are still waiting to be
+// sent, in which case it asks what to do with them first
+func (m Model) requestQuit() (Model, tea.Cmd) {
+	if len(m.pending) > 0 {
+		m.confirmQuit = true
+		return m, nil
+	}
+	if m.inFlight > 0 {
+		m.quitting = true
+		return m, nil
+	}
+	return m, tea.Quit
+}
+
+// handleQuitKey answers the send now / discard prompt shown when
+// quitting during the send delay
+func (m Model) handleQuitKey(msg tea.KeyMsg) (Model, tea.Cmd) {
+	switch msg.String() {
+	case "s", "y":
+		m.confirmQuit = false
+		m.quitting = true
+		return m.flushPending(true)
+	case "d":
+		return m, tea.Quit
+	case "esc", "n":
+		m.confirmQuit = false
+	}
+	return m, nil
+}
+
+// pendingStatus describes the countdown of the next pending message
+func (m Model) pendingStatus() string {
+	switch {
+	case m.confirmQuit:
+		return fmt.Sprintf("%d message(s) not sent yet • s: send now • d: discard • esc: keep editing", len(m.pending))
+	case m.quitting:
+		return "Waiting for messages to finish sending..."
+	case len(m.pending) == 0:
+		return m.status
+	}
+
+	last := m.pending[len(m.pending)-1]
+	remaining := time.Until(last.deadline).Round(time.Second)
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	status := fmt.Sprintf("Sending %q in %s", last.data.Subject, remaining)
+	if len(m.pending) > 1 {
+		status += fmt.Sprintf(" (%d waiting)", len(m.pending))
+	}
+	// The composer takes u as text, so undo is only offered elsewhere
+	if m.viewMode != ComposerView {
+		status += " • u: undo"
+	}
+	return status
+}
@@ -0,0 +1,219 @@
+// internal/ui/preview.go - Markdown preview as terminal text
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"vimail/internal/email"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+)
+
+// minPreviewWidth keeps the preview readable in very narrow terminals
+const minPreviewWidth = 20
+
+// renderMarkdownPreview renders a Markdown body as styled terminal text
+// wrapped to width, showing what the HTML part will look like
+func renderMarkdownPreview(body string, width int) []string {
+	doc, source := email.ParseMarkdown(body)
+	r := previewRenderer{source: source}
+	return strings.Split(r.blocks(doc, max(width, minPreviewWidth), "\n\n"), "\n")
+}
+
+type previewRenderer struct {
+	source []byte
+}
+
+// blocks renders the block children of n, joined by sep
+func (r *previewRenderer) blocks(n ast.Node, width int, sep string) string {
+	var parts []string
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		if part, ok := r.block(child, width); ok {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+func (r *previewRenderer) block(n ast.Node, width int) (string, bool) {
+	text := lipgloss.NewStyle().Foreground(White)
+
+	switch n := n.(type) {
+	case *ast.Heading:
+		return wrapPreview(r.inline(n, text.Foreground(Blue).Bold(true)), width), true
+
+	case *ast.Paragraph, *ast.TextBlock:
+		return wrapPreview(r.inline(n, text), width), true
+
+	case *ast.ThematicBreak:
+		return lipgloss.NewStyle().Foreground(DarkGray).Render(strings.Repeat("─", width)), true
+
+	case *ast.FencedCodeBlock, *ast.CodeBlock:
+		var lines []string
+		segments := n.Lines()
+		for i := 0; i < segments.Len(); i++ {
+			segment := segments.At(i)
+			line := strings.TrimRight(string(segment.Value(r.source)), "\n")
+			lines = append(lines, "  "+lipgloss.NewStyle().Foreground(Gray).Render(line))
+		}
+		return strings.Join(lines, "\n"), true
+
+	case *ast.Blockquote:
+		bar := lipgloss.NewStyle().Foreground(DarkGray).Render("│ ")
+		lines := strings.Split(r.blocks(n, width-2, "\n\n"), "\n")
+		for i := range lines {
+			lines[i] = bar + lines[i]
+		}
+		return strings.Join(lines, "\n"), true
+
+	case *ast.List:
+		return r.list(n, width), true
+
+	case *extast.Table:
+		return r.table(n), true
+
+	case *ast.HTMLBlock:
+		// Raw HTML is left out of the message too
+		return "", false
+	}
+
+	return r.blocks(n, width, "\n\n"), true
+}
+
+// list renders the items of a list with their bullets or numbers, the
+// item text indented past them
+func (r *previewRenderer) list(n *ast.List, width int) string {
+	sep := "\n\n"
+	if n.IsTight {
+		sep = "\n"
+	}
+
+	var items []string
+	number := n.Start
+	for item := n.FirstChild(); item != nil; item = item.NextSibling() {
+		marker := "• "
+		if n.IsOrdered() {
+			marker = fmt.Sprintf("%d. ", number)
+			number++
+		}
+		indent := strings.Repeat(" ", lipgloss.Width(marker))
+		lines := strings.Split(r.blocks(item, width-len(indent), sep), "\n")
+		for i := range lines {
+			if i == 0 {
+				lines[i] = lipgloss.NewStyle().Foreground(Gray).Render(marker) + lines[i]
+			} else if lines[i] != "" {
+				lines[i] = indent + lines[i]
+			}
+		}
+		items = append(items, strings.Join(lines, "\n"))
+	}
+	return strings.Join(items, sep)
+}
+
+// table lines up the cells of a table in columns
+func (r *previewRenderer) table(n *extast.Table) string {
+	text := lipgloss.NewStyle().Foreground(White)
+
+	var rows [][]string
+	var widths []int
+	for row := n.FirstChild(); row != nil; row = row.NextSibling() {
+		style := text
+		if _, header := row.(*extast.TableHeader); header {
+			style = style.Bold(true)
+		}
+		var cells []string
+		for i, cell := 0, row.FirstChild(); cell != nil; i, cell = i+1, cell.NextSibling() {
+			rendered := r.inline(cell, style)
+			cells = append(cells, rendered)
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], lipgloss.Width(rendered))
+		}
+		rows = append(rows, cells)
+	}
+
+	border := lipgloss.NewStyle().Foreground(DarkGray)
+	var lines []string
+	for i, cells := range rows {
+		for j, cell := range cells {
+			cells[j] = cell + strings.Repeat(" ", widths[j]-lipgloss.Width(cell))
+		}
+		lines = append(lines, strings.Join(cells, border.Render(" │ ")))
+		if i == 0 {
+			var rules []string
+			for _, w := range widths {
+				rules = append(rules, strings.Repeat("─", w))
+			}
+			lines = append(lines, border.Render(strings.Join(rules, "─┼─")))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// inline renders the inline children of n. Each piece of text is styled
+// on its own, so nested emphasis keeps the styles around it.
+func (r *previewRenderer) inline(n ast.Node, style lipgloss.Style) string {
+	var b strings.Builder
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		switch child := child.(type) {
+		case *ast.Text:
+			b.WriteString(style.Render(string(child.Value(r.source))))
+			// Markdown mode sends line breaks as they were typed
+			if child.SoftLineBreak() || child.HardLineBreak() {
+				b.WriteString("\n")
+			}
+
+		case *ast.String:
+			b.WriteString(style.Render(string(child.Value)))
+
+		case *ast.CodeSpan:
+			b.WriteString(r.inline(child, style.Foreground(Gray)))
+
+		case *ast.Emphasis:
+			if child.Level >= 2 {
+				b.WriteString(r.inline(child, style.Bold(true)))
+			} else {
+				b.WriteString(r.inline(child, style.Italic(true)))
+			}
+
+		case *extast.Strikethrough:
+			b.WriteString(r.inline(child, style.Strikethrough(true)))
+
+		case *ast.Link:
+			label := r.inline(child, style.Foreground(Blue).Underline(true))
+			b.WriteString(label)
+			if destination := string(child.Destination); destination != "" && lipgloss.Width(label) > 0 && destination != ansi.Strip(label) {
+				b.WriteString(style.Foreground(Gray).Render(" (" + destination + ")"))
+			}
+
+		case *ast.AutoLink:
+			b.WriteString(style.Foreground(Blue).Underline(true).Render(string(child.URL(r.source))))
+
+		case *ast.Image:
+			b.WriteString(style.Foreground(Gray).Render("[image: " + ansi.Strip(r.inline(child, style)) + "]"))
+
+		case *extast.TaskCheckBox:
+			box := "[ ] "
+			if child.IsChecked {
+				box = "[x] "
+			}
+			b.WriteString(style.Foreground(Gray).Render(box))
+
+		case *ast.RawHTML:
+			// Left out of the message, like HTML blocks
+
+		default:
+			b.WriteString(r.inline(child, style))
+		}
+	}
+	return b.String()
+}
+
+// wrapPreview wraps styled text to width, keeping its line breaks
+func wrapPreview(text string, width int) string {
+	return lipgloss.NewStyle().Width(width).Render(text)
+}
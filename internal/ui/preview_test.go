@@ -0,0 +1,43 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+func TestMarkdownPreviewIsTerminalText(t *testing.T) {
+	body := "# Plans\n\nSee **the list**\nbelow, and [the docs](https://example.com).\n\n" +
+		"- one\n- two\n\n1. first\n2. second\n\n> quoted\n\n```\ncode here\n```\n\n<div>raw</div>\n"
+	lines := renderMarkdownPreview(body, 60)
+
+	var plain []string
+	for _, line := range lines {
+		plain = append(plain, strings.TrimRight(ansi.Strip(line), " "))
+	}
+	text := strings.Join(plain, "\n")
+
+	for _, unwanted := range []string{"<html", "<p>", "<strong>", "**", "<div>", "raw"} {
+		if strings.Contains(text, unwanted) {
+			t.Errorf("preview contains %q:\n%s", unwanted, text)
+		}
+	}
+	for _, wanted := range []string{"Plans", "See the list\nbelow", "the docs (https://example.com)", "• one\n• two", "1. first\n2. second", "│ quoted", "  code here"} {
+		if !strings.Contains(text, wanted) {
+			t.Errorf("preview lacks %q:\n%s", wanted, text)
+		}
+	}
+}
+
+func TestMarkdownPreviewWraps(t *testing.T) {
+	lines := renderMarkdownPreview(strings.Repeat("word ", 40), 30)
+	if len(lines) < 5 {
+		t.Fatalf("got %d lines, want the paragraph wrapped", len(lines))
+	}
+	for _, line := range lines {
+		if width := ansi.StringWidth(line); width > 30 {
+			t.Errorf("line is %d columns wide, want at most 30: %q", width, ansi.Strip(line))
+		}
+	}
+}
@@ -3,6 +3,7 @@ package ui
 
 import (
 	"strings"
+	"vimail/internal/config"
 	"vimail/internal/email"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -11,14 +12,19 @@ import (
 
 type ReaderModelImpl struct {
 	message   *email.Message
+	prefs     *config.Preferences
+	keys      keyMap
 	width     int
 	height    int
 	scrollY   int
+	lines     []string
 	bodyLines []string
 }
 
-func NewReaderModelImpl() *ReaderModelImpl {
+func NewReaderModelImpl(prefs *config.Preferences, keys keyMap) *ReaderModelImpl {
 	return &ReaderModelImpl{
+		prefs:   prefs,
+		keys:    keys,
 		scrollY: 0,
 	}
 }
@@ -29,18 +35,26 @@ func (m *ReaderModelImpl) Init() tea.Cmd {
 
 func (m *ReaderModelImpl) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case SecurityProcessedMsg:
+		if m.message == nil || msg.Message == nil || msg.Message.ID != m.message.ID {
+			return m, nil
+		}
+		scrollY := m.scrollY
+		m.SetMessage(msg.Message)
+		m.scrollY = scrollY
+
 	case tea.KeyMsg:
 		if m.message == nil {
 			return m, nil
 		}
 
-		switch msg.String() {
-		case "up", "k":
+		switch m.keys.action(msg) {
+		case config.ActionUp:
 			if m.scrollY > 0 {
 				m.scrollY--
 			}
-		case "down", "j":
-			maxScroll := len(m.bodyLines) - (m.height - 6)
+		case config.ActionDown:
+			maxScroll := len(m.bodyLines) - (m.height - 7)
 			if maxScroll < 0 {
 				maxScroll = 0
 			}
@@ -68,8 +82,36 @@ func (m *ReaderModelImpl) View() string {
 		Padding(1, 2).
 		Render(m.message.Subject)
 
+	// Sender and date, in the configured format and time zone
+	from := m.message.GetDisplayFrom()
+	if date := m.prefs.FormatDate(m.message.Date); date != "" {
+		from += " • " + date
+	}
+	sender := lipgloss.NewStyle().
+		Foreground(Gray).
+		Padding(0, 2).
+		Render(from)
+
+	// Signature and encryption status, when the message has any
+	status := ""
+	if m.message.Security != nil {
+		color := Gray
+		if m.message.Security.Signed && !m.message.Security.Verified || m.message.Security.Error != "" {
+			color = Red
+		}
+		status = lipgloss.NewStyle().
+			Foreground(color).
+			Padding(0, 2).
+			Render(m.message.Security.Summary())
+	} else if email.NeedsSecurity(m.message) {
+		status = lipgloss.NewStyle().
+			Foreground(Gray).
+			Padding(0, 2).
+			Render("Checking signature and encryption...")
+	}
+
 	// Clean email body - white text, no decorations
-	bodyHeight := m.height - 6
+	bodyHeight := m.height - 7
 	if bodyHeight < 1 {
 		bodyHeight = 1
 	}
@@ -93,7 +135,8 @@ func (m *ReaderModelImpl) View() string {
 	return lipgloss.JoinVertical(
 		lipgloss.Top,
 		header,
-		"",
+		sender,
+		status,
 		body,
 	)
 }
@@ -103,22 +146,85 @@ func (m *ReaderModelImpl) SetMessage(message *email.Message) {
 	m.scrollY = 0
 
 	if message != nil {
-		m.bodyLines = strings.Split(message.Body, "\n")
+		m.lines = strings.Split(message.Body, "\n")
 		// Clean up empty lines at the end
-		for len(m.bodyLines) > 0 && strings.TrimSpace(m.bodyLines[len(m.bodyLines)-1]) == "" {
-			m.bodyLines = m.bodyLines[:len(m.bodyLines)-1]
+		for len(m.lines) > 0 && strings.TrimSpace(m.lines[len(m.lines)-1]) == "" {
+			m.lines = m.lines[:len(m.lines)-1]
 		}
-		if len(m.bodyLines) == 0 {
-			m.bodyLines = []string{"(Empty message)"}
+		if len(m.lines) == 0 {
+			m.lines = []string{"(Empty message)"}
 		}
 	} else {
-		m.bodyLines = []string{}
+		m.lines = []string{}
+	}
+	m.wrap()
+}
+
+// wrap breaks the body lines at the configured wrap width, or at the
+// window width when it is narrower or no width is set
+func (m *ReaderModelImpl) wrap() {
+	// EmailTextStyle pads the body by two columns on each side
+	width := m.width - 4
+	if m.prefs.WrapWidth > 0 && (width <= 0 || m.prefs.WrapWidth < width) {
+		width = m.prefs.WrapWidth
+	}
+
+	m.bodyLines = m.bodyLines[:0]
+	for _, line := range m.lines {
+		m.bodyLines = append(m.bodyLines, wrapLine(line, width)...)
 	}
+	if m.scrollY >= len(m.bodyLines) {
+		m.scrollY = max(len(m.bodyLines)-1, 0)
+	}
+}
+
+// wrapLine breaks a line between words so no part is wider than width,
+// splitting words that are wider on their own
+func wrapLine(line string, width int) []string {
+	if width <= 0 || lipgloss.Width(line) <= width {
+		return []string{line}
+	}
+
+	var wrapped []string
+	var current []rune
+	currentWidth := 0
+	for _, word := range strings.SplitAfter(line, " ") {
+		if currentWidth+lipgloss.Width(strings.TrimRight(word, " ")) > width && currentWidth > 0 {
+			wrapped = append(wrapped, strings.TrimRight(string(current), " "))
+			current, currentWidth = nil, 0
+		}
+		for _, r := range word {
+			runeWidth := lipgloss.Width(string(r))
+			if currentWidth+runeWidth > width && r != ' ' {
+				wrapped = append(wrapped, string(current))
+				current, currentWidth = nil, 0
+			}
+			current = append(current, r)
+			currentWidth += runeWidth
+		}
+	}
+	return append(wrapped, strings.TrimRight(string(current), " "))
+}
+
+// SecurityProcessedMsg carries a message after decryption and
+// signature verification
+type SecurityProcessedMsg struct {
+	Message *email.Message
+	Error   error
+}
+
+// SetPreferences switches to reloaded preferences and key bindings,
+// wrapping the message again
+func (m *ReaderModelImpl) SetPreferences(prefs *config.Preferences, keys keyMap) {
+	m.prefs = prefs
+	m.keys = keys
+	m.wrap()
 }
 
 func (m *ReaderModelImpl) SetSize(width, height int) {
 	m.width = width
 	m.height = height
+	m.wrap()
 }
 
 func (m *ReaderModelImpl) GetMessage() *email.Message {
@@ -0,0 +1,92 @@
+// internal/ui/reauth.go - Logging in again after a revoked sign-in
+package ui
+
+import (
+	"context"
+	"io"
+	"vimail/internal/auth"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ReauthenticatedMsg reports the end of logging in again
+type ReauthenticatedMsg struct {
+	Account string
+	Error   error
+}
+
+// loginCommand runs the OAuth flow in the terminal while the TUI is
+// suspended
+type loginCommand struct {
+	ctx          context.Context
+	tokens       *auth.TokenSource
+	redirectURIs []string
+	stdin        io.Reader
+}
+
+func (c *loginCommand) Run() error {
+	clientID, clientSecret := c.tokens.Credentials()
+	flow := auth.NewOAuthFlow(clientID, clientSecret)
+	flow.SetRedirectURIs(c.redirectURIs)
+	if c.stdin != nil {
+		flow.SetInput(c.stdin)
+	}
+
+	token, err := flow.AuthenticateWith(c.ctx, auth.ModeAuto)
+	if err != nil {
+		return err
+	}
+	return c.tokens.Reset(token)
+}
+
+func (c *loginCommand) SetStdin(r io.Reader) { c.stdin = r }
+func (c *loginCommand) SetStdout(io.Writer)  {}
+func (c *loginCommand) SetStderr(io.Writer)  {}
+
+// needsReauth returns the first account whose sign-in was revoked
+func (m Model) needsReauth() *mailbox {
+	for _, mb := range m.mailboxes {
+		if mb.Tokens != nil && mb.Tokens.NeedsReauth() {
+			return mb
+		}
+	}
+	return nil
+}
+
+// reauthenticate suspends the TUI to log the account in again
+func (m Model) reauthenticate(mb *mailbox) (Model, tea.Cmd) {
+	name := mb.name()
+	login := &loginCommand{ctx: m.ctx, tokens: mb.Tokens, redirectURIs: mb.Account.OAuth.RedirectURIs}
+	return m, tea.Exec(login, func(err error) tea.Msg {
+		return ReauthenticatedMsg{Account: name, Error: err}
+	})
+}
+
+// handleReauthenticated resumes the account's work after logging in
+func (m Model) handleReauthenticated(msg ReauthenticatedMsg) (Model, tea.Cmd) {
+	if msg.Error != nil {
+		m.status = "✗ Login failed: " + msg.Error.Error()
+		return m, nil
+	}
+
+	mb := m.mailboxFor(msg.Account)
+	if mb == nil {
+		return m, nil
+	}
+	m.status = "✓ Signed in again as " + mb.Account.UserEmail
+	return m, tea.Batch(
+		m.inbox.Refresh(),
+		m.loadUnreadCounts(),
+		loadIdentities(m.ctx, mb),
+		flushOutbox(m.ctx, m.outbox.store, mb.name(), mb.Client),
+	)
+}
+
+// reauthStatus is the prompt shown while an account can't be used
+func (m Model) reauthStatus() string {
+	mb := m.needsReauth()
+	if mb == nil {
+		return ""
+	}
+	return "⚠ " + mb.name() + ": sign-in expired or revoked • L: log in again"
+}
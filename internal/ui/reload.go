@@ -0,0 +1,184 @@
+// internal/ui/reload.go - Applying config edits while running
+package ui
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+	"time"
+	"vimail/internal/config"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// configWatchInterval is how often the config and preferences files are
+// checked for edits
+const configWatchInterval = 2 * time.Second
+
+// ReloadMsg asks the app to read the config and preferences again, as
+// on SIGHUP
+type ReloadMsg struct{}
+
+// SettingsLoadedMsg carries the config and preferences read from disk.
+// Either is nil when it can't be used, and Error says why.
+type SettingsLoadedMsg struct {
+	Config      *config.Config
+	Preferences *config.Preferences
+	Error       error
+
+	// requested is set when the reload was asked for, so it is confirmed
+	// even when nothing changed
+	requested bool
+}
+
+type configWatchMsg struct{}
+
+func configWatchTick() tea.Cmd {
+	return tea.Tick(configWatchInterval, func(time.Time) tea.Msg {
+		return configWatchMsg{}
+	})
+}
+
+// fileStamp tells whether a file's content changed since it was last
+// read
+type fileStamp struct {
+	exists bool
+	digest [sha256.Size]byte
+}
+
+// settingsStamps hashes the config and preferences files. Tokens and
+// save times vimail writes to the config file itself are left out, so
+// only edits trigger a reload.
+func settingsStamps() map[string]fileStamp {
+	stamps := map[string]fileStamp{}
+	if path, err := config.GetConfigPath(); err == nil {
+		stamps[path] = readStamp(path, config.SettingsContent)
+	}
+	if path, err := config.GetPreferencesPath(); err == nil {
+		stamps[path] = readStamp(path, nil)
+	}
+	return stamps
+}
+
+// readStamp hashes a file, or the part of it that content picks out
+func readStamp(path string, content func([]byte) []byte) fileStamp {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	if content != nil {
+		data = content(data)
+	}
+	return fileStamp{exists: true, digest: sha256.Sum256(data)}
+}
+
+// checkSettings reloads the settings when either file changed
+func (m Model) checkSettings() (Model, tea.Cmd) {
+	stamps := settingsStamps()
+	if maps.Equal(stamps, m.settingsStamps) {
+		return m, nil
+	}
+	m.settingsStamps = stamps
+	return m, loadSettings(false)
+}
+
+// loadSettings reads and checks the config and preferences in the
+// background
+func loadSettings(requested bool) tea.Cmd {
+	return func() tea.Msg {
+		prefs, prefsErr := loadPreferences()
+		cfg, cfgErr := config.LoadSettings()
+		return SettingsLoadedMsg{
+			Config:      cfg,
+			Preferences: prefs,
+			Error:       errors.Join(prefsErr, cfgErr),
+			requested:   requested,
+		}
+	}
+}
+
+// loadPreferences reads the preferences as they are on disk, without
+// migrating or saving them. A missing file gives the defaults.
+func loadPreferences() (*config.Preferences, error) {
+	path, err := config.GetPreferencesPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		data = []byte("{}")
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read preferences: %w", err)
+	}
+	return config.ParsePreferences(path, data)
+}
+
+// applySettings switches the running app to reloaded settings: the
+// theme and key bindings from the preferences, and the signatures and
+// identities of the connected accounts. A file that fails to load
+// leaves its previous settings in place.
+func (m Model) applySettings(msg SettingsLoadedMsg) (Model, tea.Cmd) {
+	var cmd tea.Cmd
+	changed := false
+	if msg.Preferences != nil && !samePreferences(m.prefs, msg.Preferences) {
+		changed = true
+		prefs, keys := msg.Preferences, newKeyMap(msg.Preferences)
+		ApplyTheme(config.Themes[prefs.Theme])
+		m.prefs, m.keys = prefs, keys
+		if m.inbox.SetPreferences(prefs, keys) {
+			cmd = m.inbox.Refresh()
+		}
+		m.reader.SetPreferences(prefs, keys)
+		m.outbox.SetPreferences(prefs, keys)
+		// The open composer keeps its signature; new ones get the new
+		// settings from composerEnv
+		m.composer.env.Preferences = prefs
+	}
+
+	var added []string
+	var accounts []*config.Account
+	if msg.Config != nil {
+		accounts = msg.Config.Accounts
+	}
+	for _, account := range accounts {
+		mb := m.mailboxFor(account.Name)
+		if mb == nil {
+			added = append(added, account.Name)
+			continue
+		}
+		if mb.Account.UpdateSettings(account) {
+			mb.identities = mb.Account.MergeIdentities(mb.aliases)
+			changed = true
+		}
+	}
+
+	switch {
+	case msg.Error != nil:
+		m.status = "✗ Settings not reloaded: " + firstProblem(msg.Error)
+	case len(added) > 0:
+		m.status = "Settings reloaded • restart vimail to connect " + strings.Join(added, ", ")
+	case changed || msg.requested:
+		m.status = "✓ Settings reloaded"
+	}
+	return m, cmd
+}
+
+// samePreferences compares preferences by what they save
+func samePreferences(a, b *config.Preferences) bool {
+	left, errLeft := json.Marshal(a)
+	right, errRight := json.Marshal(b)
+	return errLeft == nil && errRight == nil && string(left) == string(right)
+}
+
+// firstProblem shortens a load error to one line for the status bar
+func firstProblem(err error) string {
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) > 1 {
+		return fmt.Sprintf("%s (and %d more)", lines[0], len(lines)-1)
+	}
+	return lines[0]
+}
@@ -0,0 +1,86 @@
+// internal/ui/save.go - Saving messages to the download directory
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"vimail/internal/email"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// MessageSavedMsg reports where a message was saved
+type MessageSavedMsg struct {
+	Path  string
+	Error error
+}
+
+// saveMessage downloads the full source of a message and writes it to
+// the download directory as an .eml file
+func (m Model) saveMessage(msg *email.Message) tea.Cmd {
+	mb, ctx := m.mailboxFor(msg.Account), m.ctx
+	dir, dirErr := m.prefs.DownloadPath()
+	return func() tea.Msg {
+		if dirErr != nil {
+			return MessageSavedMsg{Error: dirErr}
+		}
+		if mb == nil {
+			return MessageSavedMsg{Error: fmt.Errorf("account %s is not connected", msg.Account)}
+		}
+		client := mb.Client
+		raw, err := client.GetRawMessage(ctx, msg.ID)
+		if err != nil {
+			return MessageSavedMsg{Error: err}
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return MessageSavedMsg{Error: err}
+		}
+		path, err := writeNewFile(dir, messageFileName(msg), ".eml", raw)
+		return MessageSavedMsg{Path: path, Error: err}
+	}
+}
+
+// messageFileName names a saved message after its subject
+func messageFileName(msg *email.Message) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.TrimSpace(msg.Subject))
+	name = strings.Trim(name, "_")
+	if runes := []rune(name); len(runes) > 60 {
+		name = string(runes[:60])
+	}
+	if name == "" {
+		name = msg.ID
+	}
+	return name
+}
+
+// writeNewFile writes data to name+ext in dir, numbering the name
+// instead of overwriting an existing file
+func writeNewFile(dir, name, ext string, data []byte) (string, error) {
+	for i := 1; ; i++ {
+		path := filepath.Join(dir, name+ext)
+		if i > 1 {
+			path = filepath.Join(dir, fmt.Sprintf("%s (%d)%s", name, i, ext))
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if _, err := file.Write(data); err != nil {
+			file.Close()
+			return "", err
+		}
+		return path, file.Close()
+	}
+}
@@ -0,0 +1,774 @@
+// internal/ui/setup.go - First-run setup wizard
+package ui
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"vimail/internal/auth"
+	"vimail/internal/config"
+	"vimail/internal/email"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"golang.org/x/oauth2"
+)
+
+// setupStep is one page of the setup wizard
+type setupStep int
+
+const (
+	setupBackendStep setupStep = iota
+	setupCredentialsStep
+	setupAuthorizeStep
+	setupTestStep
+	setupPreferencesStep
+)
+
+var setupStepNames = []string{"Backend", "Credentials", "Authorize", "Test", "Preferences"}
+
+// Fields of the credentials step. The source selector comes first; the
+// file field replaces the ID and secret when importing.
+const (
+	credSourceField = iota
+	credClientIDField
+	credSecretField
+	credFileField = credClientIDField
+)
+
+// Fields of the preferences step
+const (
+	prefNameField = iota
+	prefSignatureField
+	prefSendDelayField
+	prefSpellField
+	prefFieldCount
+)
+
+// setupTickMsg redraws the authorization progress
+type setupTickMsg struct{ attempt int }
+
+// setupAuthorizedMsg carries the result of the OAuth flow
+type setupAuthorizedMsg struct {
+	attempt int
+	token   *oauth2.Token
+	err     error
+}
+
+// setupTestedMsg carries the result of the connection test
+type setupTestedMsg struct {
+	attempt int
+	email   string
+	err     error
+}
+
+// SetupWizard walks through adding the first account: choosing the
+// backend, entering or importing the OAuth client, logging in, testing
+// the connection and picking initial preferences. Every step can go back
+// to the one before it with Esc.
+type SetupWizard struct {
+	ctx    context.Context
+	cfg    *config.Config
+	prefs  *config.Preferences
+	mode   auth.Mode
+	width  int
+	height int
+	step   setupStep
+	status string
+
+	backend int
+
+	importFile      bool
+	credField       int
+	clientID        *TextBuffer
+	clientSecret    *TextBuffer
+	credentialsPath *TextBuffer
+	client          *auth.ClientFile
+
+	// attempt numbers each login, so results of a cancelled one are
+	// ignored
+	attempt int
+	cancel  context.CancelFunc
+	output  *flowOutput
+	paste   *TextBuffer
+	pasteTo *io.PipeWriter
+	started time.Time
+	now     time.Time
+	token   *oauth2.Token
+
+	testing   bool
+	testErr   error
+	userEmail string
+
+	prefField int
+	name      *TextBuffer
+	signature *TextBuffer
+	sendDelay *TextBuffer
+	spell     bool
+
+	account   *config.Account
+	cancelled bool
+}
+
+// NewSetupWizard creates the wizard for adding an account to cfg; the
+// undo delay chosen is set in prefs. mode selects how to log in; in
+// manual mode the redirected URL is pasted into the wizard.
+func NewSetupWizard(ctx context.Context, cfg *config.Config, prefs *config.Preferences, mode auth.Mode) *SetupWizard {
+	w := &SetupWizard{
+		ctx:             ctx,
+		cfg:             cfg,
+		prefs:           prefs,
+		mode:            auth.DetectMode(mode),
+		clientID:        NewTextBuffer(false),
+		clientSecret:    NewTextBuffer(false),
+		credentialsPath: NewTextBuffer(false),
+		paste:           NewTextBuffer(false),
+		name:            NewTextBuffer(false),
+		signature:       NewTextBuffer(false),
+		sendDelay:       NewTextBuffer(false),
+		spell:           !cfg.Spell.Disabled,
+	}
+	w.sendDelay.SetText(strconv.Itoa(int(prefs.SendDelayDuration() / time.Second)))
+	return w
+}
+
+// Account returns the account added by the wizard, or nil if setup was
+// cancelled
+func (w *SetupWizard) Account() *config.Account {
+	return w.account
+}
+
+// Cancelled reports whether the user left the wizard before finishing
+func (w *SetupWizard) Cancelled() bool {
+	return w.cancelled
+}
+
+func (w *SetupWizard) Init() tea.Cmd {
+	return nil
+}
+
+func (w *SetupWizard) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		w.width = msg.Width
+		w.height = msg.Height
+		return w, nil
+
+	case setupTickMsg:
+		if msg.attempt != w.attempt || w.step != setupAuthorizeStep {
+			return w, nil
+		}
+		w.now = time.Now()
+		return w, w.tick()
+
+	case setupAuthorizedMsg:
+		if msg.attempt != w.attempt || w.step != setupAuthorizeStep {
+			return w, nil
+		}
+		w.stopLogin()
+		if msg.err != nil {
+			w.step = setupCredentialsStep
+			w.status = "✗ Login failed: " + msg.err.Error()
+			return w, nil
+		}
+		w.token = msg.token
+		w.step = setupTestStep
+		return w, w.testConnection()
+
+	case setupTestedMsg:
+		if msg.attempt != w.attempt || w.step != setupTestStep {
+			return w, nil
+		}
+		w.testing = false
+		w.testErr = msg.err
+		if msg.err == nil {
+			w.userEmail = msg.email
+			if w.name.String() == "" {
+				w.name.SetText(config.SuggestAccountName(msg.email))
+			}
+		}
+		return w, nil
+
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			w.stopLogin()
+			w.cancelled = true
+			return w, tea.Quit
+		}
+		w.status = ""
+		switch w.step {
+		case setupBackendStep:
+			return w.handleBackendKey(msg)
+		case setupCredentialsStep:
+			return w.handleCredentialsKey(msg)
+		case setupAuthorizeStep:
+			return w.handleAuthorizeKey(msg)
+		case setupTestStep:
+			return w.handleTestKey(msg)
+		case setupPreferencesStep:
+			return w.handlePreferencesKey(msg)
+		}
+	}
+	return w, nil
+}
+
+func (w *SetupWizard) handleBackendKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "q":
+		w.cancelled = true
+		return w, tea.Quit
+	case "up", "k":
+		if w.backend > 0 {
+			w.backend--
+		}
+	case "down", "j":
+		if w.backend < len(config.Backends)-1 {
+			w.backend++
+		}
+	case "enter":
+		w.step = setupCredentialsStep
+	}
+	return w, nil
+}
+
+// credFieldCount is the number of fields shown for the chosen source
+func (w *SetupWizard) credFieldCount() int {
+	if w.importFile {
+		return credFileField + 1
+	}
+	return credSecretField + 1
+}
+
+func (w *SetupWizard) credBuffer() *TextBuffer {
+	switch {
+	case w.credField == credSourceField:
+		return nil
+	case w.importFile:
+		return w.credentialsPath
+	case w.credField == credClientIDField:
+		return w.clientID
+	default:
+		return w.clientSecret
+	}
+}
+
+func (w *SetupWizard) handleCredentialsKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		w.step = setupBackendStep
+		return w, nil
+	case "tab", "down":
+		w.credField = (w.credField + 1) % w.credFieldCount()
+		return w, nil
+	case "shift+tab", "up":
+		w.credField = (w.credField + w.credFieldCount() - 1) % w.credFieldCount()
+		return w, nil
+	case "enter":
+		if w.credField < w.credFieldCount()-1 {
+			w.credField++
+			return w, nil
+		}
+		client, err := w.validateCredentials()
+		if err != nil {
+			w.status = "✗ " + err.Error()
+			return w, nil
+		}
+		w.client = client
+		return w, w.startLogin()
+	}
+
+	if w.credField == credSourceField {
+		switch msg.String() {
+		case "left", "right", " ", "h", "l":
+			w.importFile = !w.importFile
+		}
+		return w, nil
+	}
+	editField(w.credBuffer(), msg)
+	return w, nil
+}
+
+// validateCredentials checks the typed in client or reads the imported
+// credentials file
+func (w *SetupWizard) validateCredentials() (*auth.ClientFile, error) {
+	if w.importFile {
+		path := strings.TrimSpace(w.credentialsPath.String())
+		if path == "" {
+			return nil, fmt.Errorf("enter the path of the downloaded credentials.json")
+		}
+		return auth.LoadClientFile(expandHome(path))
+	}
+
+	clientID := strings.TrimSpace(w.clientID.String())
+	clientSecret := strings.TrimSpace(w.clientSecret.String())
+	if err := auth.ValidateCredentials(clientID, clientSecret); err != nil {
+		return nil, err
+	}
+	return &auth.ClientFile{ClientID: clientID, ClientSecret: clientSecret}, nil
+}
+
+// startLogin runs the OAuth flow in the background, showing what it
+// prints in the wizard
+func (w *SetupWizard) startLogin() tea.Cmd {
+	w.attempt++
+	w.step = setupAuthorizeStep
+	w.token = nil
+	w.output = &flowOutput{}
+	w.paste.SetText("")
+	w.started = time.Now()
+	w.now = w.started
+
+	ctx, cancel := context.WithCancel(w.ctx)
+	w.cancel = cancel
+
+	flow := auth.NewOAuthFlow(w.client.ClientID, w.client.ClientSecret)
+	flow.SetRedirectURIs(w.client.RedirectURIs)
+	if w.client.Type != "" {
+		flow.SetEndpoint(w.client.Endpoint())
+	}
+	flow.SetOutput(w.output)
+
+	// In manual mode the pasted URL reaches the flow through a pipe
+	pasteFrom, pasteTo := io.Pipe()
+	w.pasteTo = pasteTo
+	flow.SetInput(pasteFrom)
+
+	attempt, mode := w.attempt, w.mode
+	login := func() tea.Msg {
+		token, err := flow.AuthenticateWith(ctx, mode)
+		return setupAuthorizedMsg{attempt: attempt, token: token, err: err}
+	}
+	return tea.Batch(login, w.tick())
+}
+
+// stopLogin cancels a running OAuth flow
+func (w *SetupWizard) stopLogin() {
+	if w.cancel != nil {
+		w.cancel()
+		w.cancel = nil
+	}
+	if w.pasteTo != nil {
+		w.pasteTo.CloseWithError(context.Canceled)
+		w.pasteTo = nil
+	}
+}
+
+func (w *SetupWizard) tick() tea.Cmd {
+	attempt := w.attempt
+	return tea.Tick(250*time.Millisecond, func(time.Time) tea.Msg {
+		return setupTickMsg{attempt: attempt}
+	})
+}
+
+func (w *SetupWizard) handleAuthorizeKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		w.stopLogin()
+		w.attempt++
+		w.step = setupCredentialsStep
+		w.status = "Login cancelled"
+		return w, nil
+	case "enter":
+		if w.mode != auth.ModeManual || w.pasteTo == nil {
+			return w, nil
+		}
+		pasted := strings.TrimSpace(w.paste.String())
+		if pasted == "" {
+			w.status = "✗ Paste the address the browser was sent to"
+			return w, nil
+		}
+		pasteTo := w.pasteTo
+		w.pasteTo = nil
+		go pasteTo.Write([]byte(pasted + "\n"))
+		return w, nil
+	}
+
+	if w.mode == auth.ModeManual && w.pasteTo != nil {
+		editField(w.paste, msg)
+	}
+	return w, nil
+}
+
+// testConnection checks the new token against the mail API
+func (w *SetupWizard) testConnection() tea.Cmd {
+	w.testing = true
+	w.testErr = nil
+	ctx, client, token, attempt := w.ctx, w.client, w.token, w.attempt
+	return func() tea.Msg {
+		source := auth.NewTokenSource(ctx, client.ClientID, client.ClientSecret, token, nil)
+		emailClient, err := email.NewClient(ctx, source)
+		if err == nil {
+			err = emailClient.TestConnection(ctx)
+		}
+		if err != nil {
+			return setupTestedMsg{attempt: attempt, err: err}
+		}
+		return setupTestedMsg{attempt: attempt, email: emailClient.GetUserEmail()}
+	}
+}
+
+func (w *SetupWizard) handleTestKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if w.testing {
+		if msg.String() == "esc" {
+			w.attempt++
+			w.testing = false
+			w.step = setupCredentialsStep
+		}
+		return w, nil
+	}
+
+	switch msg.String() {
+	case "esc":
+		w.step = setupCredentialsStep
+	case "r":
+		if w.testErr != nil {
+			return w, w.testConnection()
+		}
+	case "enter":
+		if w.testErr == nil {
+			w.step = setupPreferencesStep
+		}
+	}
+	return w, nil
+}
+
+func (w *SetupWizard) prefBuffer() *TextBuffer {
+	switch w.prefField {
+	case prefNameField:
+		return w.name
+	case prefSignatureField:
+		return w.signature
+	case prefSendDelayField:
+		return w.sendDelay
+	}
+	return nil
+}
+
+func (w *SetupWizard) handlePreferencesKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		w.step = setupTestStep
+		return w, nil
+	case "tab", "down":
+		w.prefField = (w.prefField + 1) % prefFieldCount
+		return w, nil
+	case "shift+tab", "up":
+		w.prefField = (w.prefField + prefFieldCount - 1) % prefFieldCount
+		return w, nil
+	case "enter":
+		if w.prefField < prefFieldCount-1 {
+			w.prefField++
+			return w, nil
+		}
+		if err := w.finish(); err != nil {
+			w.status = "✗ " + err.Error()
+			return w, nil
+		}
+		return w, tea.Quit
+	}
+
+	if w.prefField == prefSpellField {
+		switch msg.String() {
+		case "left", "right", " ", "h", "l":
+			w.spell = !w.spell
+		}
+		return w, nil
+	}
+	editField(w.prefBuffer(), msg)
+	return w, nil
+}
+
+// finish validates the preferences and adds the account to the config.
+// Saving is left to the caller.
+func (w *SetupWizard) finish() error {
+	name := strings.TrimSpace(w.name.String())
+	account, err := config.NewAccount(name, config.Backends[w.backend])
+	if err != nil {
+		w.prefField = prefNameField
+		return err
+	}
+
+	delay, err := strconv.Atoi(strings.TrimSpace(w.sendDelay.String()))
+	if err != nil || delay < 0 {
+		w.prefField = prefSendDelayField
+		return fmt.Errorf("the undo send delay must be a whole number of seconds")
+	}
+
+	account.OAuth = config.OAuthConfig{
+		ClientID:     w.client.ClientID,
+		ClientSecret: w.client.ClientSecret,
+		RedirectURIs: w.client.RedirectURIs,
+		Token:        w.token,
+	}
+	account.UserEmail = w.userEmail
+	account.Signature = strings.TrimSpace(w.signature.String())
+	if err := w.cfg.AddAccount(account); err != nil {
+		w.prefField = prefNameField
+		return err
+	}
+
+	w.prefs.SendDelay = config.Duration(time.Duration(delay) * time.Second)
+	w.cfg.Spell.Disabled = !w.spell
+	w.account = account
+	return nil
+}
+
+// editField applies an editing key to a single line field
+func editField(buffer *TextBuffer, msg tea.KeyMsg) {
+	switch msg.String() {
+	case "backspace":
+		buffer.Backspace()
+	case "delete":
+		buffer.Delete()
+	case "left":
+		buffer.Left()
+	case "right":
+		buffer.Right()
+	case "home", "ctrl+a":
+		buffer.Home()
+	case "end", "ctrl+e":
+		buffer.End()
+	case "ctrl+u":
+		buffer.SetText("")
+	default:
+		switch {
+		case msg.Type == tea.KeySpace:
+			buffer.InsertString(" ")
+		case msg.Type == tea.KeyRunes && (!msg.Alt || msg.Paste):
+			// Pasted text may end in a newline or carry surrounding spaces
+			text := string(msg.Runes)
+			if msg.Paste {
+				text = strings.TrimSpace(text)
+			}
+			buffer.InsertString(text)
+		}
+	}
+}
+
+func (w *SetupWizard) View() string {
+	var body string
+	switch w.step {
+	case setupBackendStep:
+		body = w.backendView()
+	case setupCredentialsStep:
+		body = w.credentialsView()
+	case setupAuthorizeStep:
+		body = w.authorizeView()
+	case setupTestStep:
+		body = w.testView()
+	case setupPreferencesStep:
+		body = w.preferencesView()
+	}
+
+	status := ""
+	if w.status != "" {
+		style := lipgloss.NewStyle().Foreground(White)
+		if strings.HasPrefix(w.status, "✗") {
+			style = style.Foreground(Red)
+		}
+		status = style.Render(w.status)
+	}
+
+	return lipgloss.NewStyle().Padding(1, 2).Render(lipgloss.JoinVertical(lipgloss.Left,
+		HeaderStyle.Render("vimail setup"),
+		"",
+		w.progressView(),
+		"",
+		body,
+		"",
+		status,
+		lipgloss.NewStyle().Foreground(Gray).Render(w.helpText()),
+	))
+}
+
+// progressView lists the steps, highlighting the current one
+func (w *SetupWizard) progressView() string {
+	parts := make([]string, len(setupStepNames))
+	for i, name := range setupStepNames {
+		style := lipgloss.NewStyle().Foreground(DarkGray)
+		switch {
+		case setupStep(i) == w.step:
+			style = lipgloss.NewStyle().Foreground(White).Bold(true)
+		case setupStep(i) < w.step:
+			style = lipgloss.NewStyle().Foreground(Gray)
+		}
+		parts[i] = style.Render(fmt.Sprintf("%d %s", i+1, name))
+	}
+	return strings.Join(parts, lipgloss.NewStyle().Foreground(DarkGray).Render(" › "))
+}
+
+func (w *SetupWizard) helpText() string {
+	switch w.step {
+	case setupBackendStep:
+		return "↑/↓: choose • Enter: next • Esc: quit"
+	case setupCredentialsStep, setupPreferencesStep:
+		return "Tab/↑/↓: field • Space: toggle • Enter: next • Esc: back • Ctrl+C: quit"
+	case setupAuthorizeStep:
+		if w.mode == auth.ModeManual {
+			return "Enter: submit pasted address • Esc: cancel login"
+		}
+		return "Esc: cancel login"
+	case setupTestStep:
+		switch {
+		case w.testing:
+			return "Esc: cancel"
+		case w.testErr != nil:
+			return "r: retry • Esc: back"
+		}
+		return "Enter: next • Esc: back"
+	}
+	return ""
+}
+
+func (w *SetupWizard) backendView() string {
+	descriptions := map[string]string{
+		config.BackendGmail: "Gmail API, logging in with a Google OAuth client",
+	}
+
+	lines := []string{"Which kind of account do you want to add?", ""}
+	for i, backend := range config.Backends {
+		line := fmt.Sprintf("%-8s %s", backend, descriptions[backend])
+		if i == w.backend {
+			lines = append(lines, SelectedEmailStyle.Render("› "+line))
+		} else {
+			lines = append(lines, EmailItemStyle.Render("  "+line))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (w *SetupWizard) credentialsView() string {
+	lines := []string{
+		"vimail logs in with your own Google OAuth client:",
+		"  1. Create a project at https://console.cloud.google.com/ and enable the Gmail API",
+		"  2. Create OAuth credentials of the Desktop application type",
+		"  3. Download the JSON file, or copy the client ID and secret",
+		"",
+	}
+
+	source := "[ Type in ]  Import file"
+	if w.importFile {
+		source = "  Type in  [ Import file ]"
+	}
+	lines = append(lines, w.renderLabel("Source", w.credField == credSourceField)+" "+source)
+
+	if w.importFile {
+		lines = append(lines, w.renderInput("File", w.credentialsPath, w.credField == credFileField, false))
+	} else {
+		lines = append(lines,
+			w.renderInput("Client ID", w.clientID, w.credField == credClientIDField, false),
+			w.renderInput("Secret", w.clientSecret, w.credField == credSecretField, true),
+		)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (w *SetupWizard) authorizeView() string {
+	elapsed := w.now.Sub(w.started).Round(time.Second)
+	lines := []string{fmt.Sprintf("Waiting for you to allow access… %s", elapsed), ""}
+	if text := strings.TrimSpace(w.output.String()); text != "" {
+		lines = append(lines, lipgloss.NewStyle().Width(w.contentWidth()).Render(text), "")
+	}
+	if w.mode == auth.ModeManual {
+		lines = append(lines, w.renderInput("Address", w.paste, w.pasteTo != nil, false))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (w *SetupWizard) testView() string {
+	switch {
+	case w.testing:
+		return "Testing the connection…"
+	case w.testErr != nil:
+		return lipgloss.NewStyle().Foreground(Red).Width(w.contentWidth()).
+			Render("✗ Connection test failed: " + w.testErr.Error())
+	}
+	return "✓ Connected as " + w.userEmail
+}
+
+func (w *SetupWizard) preferencesView() string {
+	spell := "[ on ]  off"
+	if !w.spell {
+		spell = "  on  [ off ]"
+	}
+	return strings.Join([]string{
+		"A few preferences to start with; they can be changed in the config file later.",
+		"",
+		w.renderInput("Name", w.name, w.prefField == prefNameField, false),
+		w.renderInput("Signature", w.signature, w.prefField == prefSignatureField, false),
+		w.renderInput("Undo (s)", w.sendDelay, w.prefField == prefSendDelayField, false),
+		w.renderLabel("Spelling", w.prefField == prefSpellField) + " " + spell,
+	}, "\n")
+}
+
+func (w *SetupWizard) contentWidth() int {
+	if w.width < 20 {
+		return 76
+	}
+	return w.width - 4
+}
+
+func (w *SetupWizard) renderLabel(label string, focused bool) string {
+	style := lipgloss.NewStyle().Foreground(Gray).Width(11)
+	if focused {
+		style = style.Foreground(Blue)
+	}
+	return style.Render(label)
+}
+
+// renderInput draws a labelled single line field. Masked fields show a
+// bullet per character, keeping the cursor where it is.
+func (w *SetupWizard) renderInput(label string, value *TextBuffer, focused, masked bool) string {
+	if masked {
+		_, col := value.Cursor()
+		shown := NewTextBuffer(false)
+		shown.SetText(strings.Repeat("•", len(value.lines[0])))
+		shown.SetCursor(0, col)
+		value = shown
+	}
+	inputStyle := lipgloss.NewStyle().Foreground(White)
+	if focused {
+		inputStyle = inputStyle.Foreground(Blue)
+	}
+	inputWidth := w.contentWidth() - 12
+	return w.renderLabel(label, focused) + " " +
+		inputStyle.Render(value.RenderSingleLine(inputWidth, focused, nil))
+}
+
+// flowOutput collects what the OAuth flow prints, which arrives from its
+// own goroutine
+type flowOutput struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *flowOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Write(p)
+}
+
+func (o *flowOutput) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
+
+// expandHome resolves a leading ~ in a typed path
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
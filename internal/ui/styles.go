@@ -2,50 +2,84 @@
 package ui
 
 import (
+	"vimail/internal/config"
+
 	"github.com/charmbracelet/lipgloss"
 )
 
-// Minimal color palette
+// Minimal color palette, set from the theme in the preferences
 var (
 	// Simple colors
-	White    = lipgloss.Color("#ffffff")
-	Gray     = lipgloss.Color("#888888")
-	DarkGray = lipgloss.Color("#444444")
-	Blue     = lipgloss.Color("#5555ff")
-	Black    = lipgloss.Color("#000000")
+	White    lipgloss.Color
+	Gray     lipgloss.Color
+	DarkGray lipgloss.Color
+	Blue     lipgloss.Color
+	Red      lipgloss.Color
+	Black    lipgloss.Color
+
+	// Selected is the text color on Blue
+	Selected lipgloss.Color
 )
 
-// Minimal styles
+// Minimal styles, built from the palette by ApplyTheme
 var (
 	// Clean email list item
-	EmailItemStyle = lipgloss.NewStyle().
-			Foreground(Gray).
-			Padding(0, 2)
+	EmailItemStyle lipgloss.Style
 
 	// Selected email - simple highlight
-	SelectedEmailStyle = lipgloss.NewStyle().
-				Foreground(White).
-				Background(Blue).
-				Padding(0, 2)
+	SelectedEmailStyle lipgloss.Style
 
 	// Email text - clean white text
-	EmailTextStyle = lipgloss.NewStyle().
-			Foreground(White).
-			Padding(1, 2)
+	EmailTextStyle lipgloss.Style
 
 	// Simple border
-	SimpleBorderStyle = lipgloss.NewStyle().
-				Border(lipgloss.NormalBorder()).
-				BorderForeground(DarkGray).
-				Padding(1)
+	SimpleBorderStyle lipgloss.Style
 
 	// Clean header
-	HeaderStyle = lipgloss.NewStyle().
-			Foreground(White).
-			Background(DarkGray).
-			Padding(0, 2)
+	HeaderStyle lipgloss.Style
 )
 
+func init() {
+	ApplyTheme(config.Themes[config.DefaultTheme])
+}
+
+// ApplyTheme switches the palette and rebuilds the styles. The colors
+// keep the names of the zen theme they started as: White is the text
+// color, Gray muted text, DarkGray borders, Blue the accent, Red errors
+// and Black the background.
+func ApplyTheme(theme config.Theme) {
+	White = lipgloss.Color(theme.Text)
+	Gray = lipgloss.Color(theme.Muted)
+	DarkGray = lipgloss.Color(theme.Subtle)
+	Blue = lipgloss.Color(theme.Accent)
+	Red = lipgloss.Color(theme.Error)
+	Black = lipgloss.Color(theme.Background)
+	Selected = lipgloss.Color(theme.Selected)
+
+	EmailItemStyle = lipgloss.NewStyle().
+		Foreground(Gray).
+		Padding(0, 2)
+
+	SelectedEmailStyle = lipgloss.NewStyle().
+		Foreground(Selected).
+		Background(Blue).
+		Padding(0, 2)
+
+	EmailTextStyle = lipgloss.NewStyle().
+		Foreground(White).
+		Padding(1, 2)
+
+	SimpleBorderStyle = lipgloss.NewStyle().
+		Border(lipgloss.NormalBorder()).
+		BorderForeground(DarkGray).
+		Padding(1)
+
+	HeaderStyle = lipgloss.NewStyle().
+		Foreground(White).
+		Background(DarkGray).
+		Padding(0, 2)
+}
+
 // Simple utility functions
 func FormatEmailLine(from, subject string, selected bool) string {
 	text := from + " - " + subject
@@ -0,0 +1,396 @@
+// internal/ui/textbuffer.go - Grapheme-aware text buffer
+package ui
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/rivo/uniseg"
+)
+
+// TextBuffer is an editable block of text stored as grapheme clusters.
+// The cursor is addressed by grapheme, so multi-byte runes, combining
+// marks and emoji sequences are always edited as a single unit.
+type TextBuffer struct {
+	lines     [][]string
+	row       int
+	col       int
+	goalCol   int
+	multiline bool
+}
+
+// NewTextBuffer creates an empty buffer. Single-line buffers turn
+// newlines in inserted text into spaces.
+func NewTextBuffer(multiline bool) *TextBuffer {
+	return &TextBuffer{
+		lines:     [][]string{{}},
+		multiline: multiline,
+	}
+}
+
+// splitGraphemes breaks a string into its grapheme clusters
+func splitGraphemes(s string) []string {
+	var clusters []string
+	g := uniseg.NewGraphemes(s)
+	for g.Next() {
+		clusters = append(clusters, g.Str())
+	}
+	return clusters
+}
+
+// graphemesWidth returns the display width of a run of graphemes
+func graphemesWidth(clusters []string) int {
+	width := 0
+	for _, c := range clusters {
+		width += uniseg.StringWidth(c)
+	}
+	return width
+}
+
+// SetText replaces the buffer contents and moves the cursor to the end
+func (b *TextBuffer) SetText(text string) {
+	b.lines = [][]string{{}}
+	b.row, b.col = 0, 0
+	b.InsertString(text)
+}
+
+// String returns the buffer contents joined with newlines
+func (b *TextBuffer) String() string {
+	lines := make([]string, len(b.lines))
+	for i, line := range b.lines {
+		lines[i] = strings.Join(line, "")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Lines returns each line of the buffer as a string
+func (b *TextBuffer) Lines() []string {
+	lines := make([]string, len(b.lines))
+	for i, line := range b.lines {
+		lines[i] = strings.Join(line, "")
+	}
+	return lines
+}
+
+// Line returns one line of the buffer as a string
+func (b *TextBuffer) Line(row int) string {
+	return strings.Join(b.lines[row], "")
+}
+
+// LineCount returns the number of lines in the buffer
+func (b *TextBuffer) LineCount() int {
+	return len(b.lines)
+}
+
+// Cursor returns the cursor row and grapheme column
+func (b *TextBuffer) Cursor() (row, col int) {
+	return b.row, b.col
+}
+
+// CursorColumn returns the display column of the cursor on its line
+func (b *TextBuffer) CursorColumn() int {
+	return graphemesWidth(b.lines[b.row][:b.col])
+}
+
+// InsertString inserts text at the cursor. It accepts anything from a
+// single keystroke to a bracketed paste of many lines.
+func (b *TextBuffer) InsertString(text string) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	text = strings.ReplaceAll(text, "\t", "    ")
+	if !b.multiline {
+		text = strings.ReplaceAll(text, "\n", " ")
+	}
+
+	for i, segment := range strings.Split(text, "\n") {
+		if i > 0 {
+			b.InsertNewline()
+		}
+		clusters := splitGraphemes(segment)
+		if len(clusters) == 0 {
+			continue
+		}
+
+		line := b.lines[b.row]
+		updated := make([]string, 0, len(line)+len(clusters))
+		updated = append(updated, line[:b.col]...)
+		updated = append(updated, clusters...)
+		updated = append(updated, line[b.col:]...)
+
+		// Re-segment around the insertion point so a combining mark typed
+		// after its base character joins the same cluster
+		joined := strings.Join(updated, "")
+		before := strings.Join(updated[:b.col+len(clusters)], "")
+		b.lines[b.row] = splitGraphemes(joined)
+		b.col = uniseg.GraphemeClusterCount(before)
+		if b.col > len(b.lines[b.row]) {
+			b.col = len(b.lines[b.row])
+		}
+	}
+	b.goalCol = b.CursorColumn()
+}
+
+// InsertNewline splits the current line at the cursor
+func (b *TextBuffer) InsertNewline() {
+	if !b.multiline {
+		return
+	}
+
+	line := b.lines[b.row]
+	head := append([]string{}, line[:b.col]...)
+	tail := append([]string{}, line[b.col:]...)
+
+	b.lines[b.row] = head
+	b.lines = append(b.lines[:b.row+1], append([][]string{tail}, b.lines[b.row+1:]...)...)
+	b.row++
+	b.col = 0
+	b.goalCol = 0
+}
+
+// Backspace deletes the grapheme before the cursor, joining lines at
+// the start of a line
+func (b *TextBuffer) Backspace() {
+	if b.col > 0 {
+		line := b.lines[b.row]
+		b.lines[b.row] = append(line[:b.col-1], line[b.col:]...)
+		b.col--
+	} else if b.row > 0 {
+		b.row--
+		b.col = b.joinLines(b.row)
+	}
+	b.goalCol = b.CursorColumn()
+}
+
+// Delete removes the grapheme under the cursor, joining lines at the
+// end of a line
+func (b *TextBuffer) Delete() {
+	line := b.lines[b.row]
+	if b.col < len(line) {
+		b.lines[b.row] = append(line[:b.col], line[b.col+1:]...)
+	} else if b.row < len(b.lines)-1 {
+		b.col = b.joinLines(b.row)
+	}
+	b.goalCol = b.CursorColumn()
+}
+
+// joinLines appends the line after row to it and returns the grapheme
+// column where they meet. The joined line is segmented again, as a
+// combining mark starting the second line belongs to the cluster before.
+func (b *TextBuffer) joinLines(row int) int {
+	head := strings.Join(b.lines[row], "")
+	b.lines[row] = splitGraphemes(head + strings.Join(b.lines[row+1], ""))
+	b.lines = append(b.lines[:row+1], b.lines[row+2:]...)
+	return min(uniseg.GraphemeClusterCount(head), len(b.lines[row]))
+}
+
+// Left moves the cursor back one grapheme
+func (b *TextBuffer) Left() {
+	if b.col > 0 {
+		b.col--
+	} else if b.row > 0 {
+		b.row--
+		b.col = len(b.lines[b.row])
+	}
+	b.goalCol = b.CursorColumn()
+}
+
+// Right moves the cursor forward one grapheme
+func (b *TextBuffer) Right() {
+	if b.col < len(b.lines[b.row]) {
+		b.col++
+	} else if b.row < len(b.lines)-1 {
+		b.row++
+		b.col = 0
+	}
+	b.goalCol = b.CursorColumn()
+}
+
+// Up moves the cursor to the previous line, keeping its display column
+func (b *TextBuffer) Up() bool {
+	if b.row == 0 {
+		return false
+	}
+	b.row--
+	b.col = b.colForWidth(b.goalCol)
+	return true
+}
+
+// Down moves the cursor to the next line, keeping its display column
+func (b *TextBuffer) Down() bool {
+	if b.row >= len(b.lines)-1 {
+		return false
+	}
+	b.row++
+	b.col = b.colForWidth(b.goalCol)
+	return true
+}
+
+// Top moves the cursor to the start of the buffer
+func (b *TextBuffer) Top() {
+	b.row, b.col = 0, 0
+	b.goalCol = 0
+}
+
+// SetCursor moves the cursor, clamping it to the buffer contents
+func (b *TextBuffer) SetCursor(row, col int) {
+	if row >= len(b.lines) {
+		row = len(b.lines) - 1
+	}
+	if row < 0 {
+		row = 0
+	}
+	if col > len(b.lines[row]) {
+		col = len(b.lines[row])
+	}
+	if col < 0 {
+		col = 0
+	}
+	b.row, b.col = row, col
+	b.goalCol = b.CursorColumn()
+}
+
+// Home moves the cursor to the start of the line
+func (b *TextBuffer) Home() {
+	b.col = 0
+	b.goalCol = 0
+}
+
+// End moves the cursor to the end of the line
+func (b *TextBuffer) End() {
+	b.col = len(b.lines[b.row])
+	b.goalCol = b.CursorColumn()
+}
+
+// colForWidth finds the grapheme index on the current line closest to
+// the given display column without passing it
+func (b *TextBuffer) colForWidth(width int) int {
+	used := 0
+	for i, c := range b.lines[b.row] {
+		w := uniseg.StringWidth(c)
+		if used+w > width {
+			return i
+		}
+		used += w
+	}
+	return len(b.lines[b.row])
+}
+
+// ByteRangeColumns converts byte ranges within a line into a per-grapheme
+// mark, for highlighting parts of the line when it is rendered
+func (b *TextBuffer) ByteRangeColumns(row int, ranges [][2]int) []bool {
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	marked := make([]bool, len(b.lines[row]))
+	offset := 0
+	for i, cluster := range b.lines[row] {
+		for _, r := range ranges {
+			if offset >= r[0] && offset < r[1] {
+				marked[i] = true
+				break
+			}
+		}
+		offset += len(cluster)
+	}
+	return marked
+}
+
+// ColumnByteOffset returns the byte offset of a grapheme column
+func (b *TextBuffer) ColumnByteOffset(row, col int) int {
+	return len(strings.Join(b.lines[row][:col], ""))
+}
+
+// ReplaceRange replaces graphemes [start, end) on a line with text and
+// puts the cursor after the replacement
+func (b *TextBuffer) ReplaceRange(row, start, end int, text string) {
+	line := b.lines[row]
+	rest := append([]string{}, line[end:]...)
+	b.lines[row] = append(line[:start:start], rest...)
+	b.row, b.col = row, start
+	b.InsertString(text)
+}
+
+// renderSpan renders graphemes [from, to) of a line, drawing the cursor
+// and underlining marked graphemes
+func (b *TextBuffer) renderSpan(row, from, to int, showCursor bool, marked []bool) string {
+	line := b.lines[row]
+	cursorStyle := lipgloss.NewStyle().Reverse(true)
+	markStyle := lipgloss.NewStyle().Underline(true)
+
+	var sb strings.Builder
+	var run strings.Builder
+	runMarked := false
+	flush := func() {
+		if run.Len() == 0 {
+			return
+		}
+		if runMarked {
+			sb.WriteString(markStyle.Render(run.String()))
+		} else {
+			sb.WriteString(run.String())
+		}
+		run.Reset()
+	}
+
+	for i := from; i < to; i++ {
+		isMarked := i < len(marked) && marked[i]
+		if showCursor && row == b.row && i == b.col {
+			flush()
+			style := cursorStyle
+			if isMarked {
+				style = style.Underline(true)
+			}
+			sb.WriteString(style.Render(line[i]))
+			continue
+		}
+		if isMarked != runMarked {
+			flush()
+			runMarked = isMarked
+		}
+		run.WriteString(line[i])
+	}
+	flush()
+
+	if showCursor && row == b.row && b.col == to && to == len(line) {
+		sb.WriteString("█")
+	}
+	return sb.String()
+}
+
+// RenderLine renders one line with the cursor drawn on it when it is
+// the cursor line. The grapheme under the cursor is shown in reverse
+// video so wide characters keep their width. Marked graphemes are
+// underlined.
+func (b *TextBuffer) RenderLine(row int, showCursor bool, marked []bool) string {
+	return b.renderSpan(row, 0, len(b.lines[row]), showCursor, marked)
+}
+
+// RenderSingleLine renders the first line clipped to width display
+// cells, scrolling horizontally so the cursor stays visible
+func (b *TextBuffer) RenderSingleLine(width int, showCursor bool, marked []bool) string {
+	line := b.lines[0]
+	if width <= 0 || graphemesWidth(line)+1 <= width {
+		return b.RenderLine(0, showCursor, marked)
+	}
+
+	// Find the first grapheme such that the cursor fits in the window
+	start := 0
+	for graphemesWidth(line[start:b.col])+1 > width && start < b.col {
+		start++
+	}
+
+	// Then take as many graphemes as fit
+	end := start
+	used := 0
+	for end < len(line) {
+		w := uniseg.StringWidth(line[end])
+		if used+w > width {
+			break
+		}
+		used += w
+		end++
+	}
+
+	return b.renderSpan(0, start, end, showCursor, marked)
+}
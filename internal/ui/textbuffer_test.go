@@ -0,0 +1,153 @@
+package ui
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTextBufferEditing(t *testing.T) {
+	tests := []struct {
+		name      string
+		multiline bool
+		edit      func(b *TextBuffer)
+		lines     []string
+		row, col  int
+		column    int
+	}{
+		{
+			name: "CJK is two columns per character",
+			edit: func(b *TextBuffer) {
+				b.InsertString("日本語")
+				b.Left()
+			},
+			lines: []string{"日本語"},
+			col:   2, column: 4,
+		},
+		{
+			name: "emoji ZWJ sequence is one grapheme",
+			edit: func(b *TextBuffer) {
+				b.InsertString("a👩\u200d💻b")
+				b.Left()
+				b.Backspace()
+			},
+			lines: []string{"ab"},
+			col:   1, column: 1,
+		},
+		{
+			name: "combining mark typed after its base joins it",
+			edit: func(b *TextBuffer) {
+				b.InsertString("e")
+				b.InsertString("\u0301")
+				b.InsertString("t")
+			},
+			lines: []string{"e\u0301t"},
+			col:   2, column: 2,
+		},
+		{
+			name: "deleting a combining mark takes its base",
+			edit: func(b *TextBuffer) {
+				b.InsertString("cafe\u0301")
+				b.Backspace()
+			},
+			lines: []string{"caf"},
+			col:   3, column: 3,
+		},
+		{
+			name:      "pasted lines",
+			multiline: true,
+			edit: func(b *TextBuffer) {
+				b.InsertString("one\r\ntwo\rthree\n")
+			},
+			lines: []string{"one", "two", "three", ""},
+			row:   3,
+		},
+		{
+			name: "paste into a single line",
+			edit: func(b *TextBuffer) {
+				b.InsertString("one\ntwo")
+			},
+			lines: []string{"one two"},
+			col:   7, column: 7,
+		},
+		{
+			name:      "backspace joins lines and segments the join",
+			multiline: true,
+			edit: func(b *TextBuffer) {
+				b.InsertString("e\n\u0301x")
+				b.Home()
+				b.Backspace()
+			},
+			lines: []string{"e\u0301x"},
+			col:   1, column: 1,
+		},
+		{
+			name:      "delete joins lines and segments the join",
+			multiline: true,
+			edit: func(b *TextBuffer) {
+				b.InsertString("e\n\u0301x")
+				b.Up()
+				b.End()
+				b.Delete()
+			},
+			lines: []string{"e\u0301x"},
+			col:   1, column: 1,
+		},
+		{
+			name:      "up keeps the display column across wide characters",
+			multiline: true,
+			edit: func(b *TextBuffer) {
+				b.InsertString("日本語\nabcdef")
+				b.Left()
+				b.Left()
+				b.Up()
+			},
+			lines: []string{"日本語", "abcdef"},
+			col:   2, column: 4,
+		},
+		{
+			name:      "down never lands inside a wide character",
+			multiline: true,
+			edit: func(b *TextBuffer) {
+				b.InsertString("abc\n日本語")
+				b.Up()
+				b.Home()
+				b.Right()
+				b.Right()
+				b.Right()
+				b.Down()
+			},
+			lines: []string{"abc", "日本語"},
+			row:   1, col: 1, column: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := NewTextBuffer(test.multiline)
+			test.edit(b)
+			if lines := b.Lines(); !slices.Equal(lines, test.lines) {
+				t.Errorf("got lines %q, want %q", lines, test.lines)
+			}
+			if row, col := b.Cursor(); row != test.row || col != test.col {
+				t.Errorf("cursor at %d:%d, want %d:%d", row, col, test.row, test.col)
+			}
+			if column := b.CursorColumn(); column != test.column {
+				t.Errorf("cursor in display column %d, want %d", column, test.column)
+			}
+		})
+	}
+}
+
+func TestTextBufferDeleteResetsGoalColumn(t *testing.T) {
+	b := NewTextBuffer(true)
+	b.InsertString("abcdef\nab\ncdef")
+	b.SetCursor(0, 5)
+	b.Down()
+	// Joining the short line with the next leaves the cursor in column 2,
+	// which is where moving up must go rather than the earlier column 5
+	b.Delete()
+	b.Up()
+	if row, col := b.Cursor(); row != 0 || col != 2 {
+		t.Fatalf("cursor at %d:%d after moving up, want 0:2", row, col)
+	}
+}
@@ -2,12 +2,19 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"vimail/cmd"
 	"vimail/internal/auth"
 	"vimail/internal/config"
-	"vimail/internal/email"
+	"vimail/internal/contacts"
+	"vimail/internal/outbox"
+	"vimail/internal/spell"
 	"vimail/internal/ui"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -17,54 +24,88 @@ func main() {
 	// Setup context
 	ctx := context.Background()
 
-	// Check if config exists, if not run setup
-	if !config.Exists() {
+	// Files from before the XDG directories were used move once
+	if legacyDir, err := config.MigrateLegacyDir(contacts.FileName, outbox.FileName, spell.PersonalFileName); err != nil {
+		log.Printf("Warning: Failed to move files from %s: %v", config.LegacyDirName, err)
+	} else if legacyDir != "" {
+		configDir, _ := config.GetConfigDir()
+		dataDir, _ := config.GetDataDir()
+		log.Printf("Moved settings from %s to %s and %s", legacyDir, configDir, dataDir)
+	}
+
+	// Run a subcommand if one was given
+	if len(args) > 0 {
+		if command, ok := cmd.Lookup(args[0]); ok {
+			if err := command.Run(ctx, args[1:]); err != nil {
+				log.Fatalf("%s: %v", command.Name, err)
+			}
+			return
+		}
+	}
+
+	// Run setup when there is no config yet, or to add an account
+	if forceSetup || !config.Exists() {
 		if err := runSetup(ctx); err != nil {
 			log.Fatalf("Setup failed: %v", err)
 		}
 	}
 
-	// Load configuration
-	cfg, err := config.Load()
+	// Load configuration and connect every account
+	cfg, err := cmd.LoadConfig()
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		log.Fatal(err)
+	}
+	if len(cfg.Accounts) == 0 {
+		log.Fatal("No accounts configured, add one with: vimail account add NAME")
 	}
 
-	// Refresh token if needed
-	newToken, err := auth.RefreshTokenIfNeeded(cfg.OAuth.Token, cfg.OAuth.ClientID, cfg.OAuth.ClientSecret)
+	// Preferences are migrated to the current schema as they load
+	prefs, err := config.LoadPreferences(cfg)
 	if err != nil {
-		log.Fatalf("Failed to refresh token: %v", err)
+		log.Fatalf("Invalid preferences:\n%v", err)
 	}
 
-	// Update config if token was refreshed
-	if newToken != cfg.OAuth.Token {
-		cfg.OAuth.Token = newToken
-		if err := cfg.Save(); err != nil {
-			log.Printf("Warning: Failed to save updated token: %v", err)
+	security := cmd.LoadSecurity(cfg)
+	var mailboxes []ui.Mailbox
+	for _, account := range cfg.Accounts {
+		emailClient, tokens, err := cmd.ConnectAccount(ctx, cfg, account)
+		if errors.Is(err, auth.ErrReauthRequired) {
+			// Log in again before the TUI takes over the terminal
+			if err = cmd.Reauthenticate(ctx, cfg, account, loginMode); err == nil {
+				emailClient, tokens, err = cmd.ConnectAccount(ctx, cfg, account)
+			}
+		}
+		if err != nil {
+			// One unreachable account shouldn't keep the others closed
+			log.Printf("Warning: %v", err)
+			continue
 		}
+		emailClient.SetSecurity(security)
+		mailboxes = append(mailboxes, ui.Mailbox{Account: account, Client: emailClient, Tokens: tokens})
+	}
+	if len(mailboxes) == 0 {
+		log.Fatal("Could not connect to any account")
 	}
 
-	// Create email client
-	emailClient, err := email.NewClient(ctx, cfg.OAuth.Token, cfg.OAuth.ClientID, cfg.OAuth.ClientSecret)
+	dataDir, err := config.GetDataDir()
 	if err != nil {
-		log.Fatalf("Failed to create email client: %v", err)
+		log.Fatalf("Failed to find data directory: %v", err)
 	}
 
-	// Test connection
-	if err := emailClient.TestConnection(ctx); err != nil {
-		log.Fatalf("Gmail API connection failed: %v", err)
+	// Load the address book used for recipient autocomplete
+	addressBook, err := contacts.OpenDefault(dataDir)
+	if err != nil {
+		log.Printf("Warning: Failed to load contacts: %v", err)
 	}
 
-	// Update user email in config
-	if cfg.UserEmail != emailClient.GetUserEmail() {
-		cfg.UserEmail = emailClient.GetUserEmail()
-		if err := cfg.Save(); err != nil {
-			log.Printf("Warning: Failed to save user email: %v", err)
-		}
+	// Scheduled messages wait in the outbox in the data directory
+	scheduled := outbox.OpenDefault(dataDir)
+	if err := scheduled.AssignAccount(cfg.DefaultAccountName()); err != nil {
+		log.Printf("Warning: Failed to update outbox: %v", err)
 	}
 
 	// Create and run TUI application
-	model := ui.NewModel(ctx, emailClient, cfg)
+	model := ui.NewModel(ctx, cfg, prefs, mailboxes, addressBook, scheduled)
 
 	program := tea.NewProgram(
 		model,
@@ -72,82 +113,58 @@ func main() {
 		tea.WithMouseCellMotion(),
 	)
 
+	// SIGHUP reloads the settings, as editing the files does
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			program.Send(ui.ReloadMsg{})
+		}
+	}()
+
 	if _, err := program.Run(); err != nil {
 		log.Fatalf("Application error: %v", err)
 	}
 }
 
-// runSetup handles the initial OAuth setup
+// runSetup adds an account with the setup wizard, creating the config
+// the first time
 func runSetup(ctx context.Context) error {
 	fmt.Println("🔧 Terminal Email Client Setup")
 	fmt.Println("==============================")
 	fmt.Println()
 
-	// Get OAuth credentials from user
-	var clientID, clientSecret string
-
-	fmt.Println("To use this email client, you need to create a Google OAuth application.")
-	fmt.Println("Visit: https://console.developers.google.com/")
-	fmt.Println("1. Create a new project or select existing")
-	fmt.Println("2. Enable Gmail API")
-	fmt.Println("3. Create OAuth 2.0 credentials (Desktop application)")
-	fmt.Println("4. Download the credentials and enter them below")
-	fmt.Println()
-
-	fmt.Print("Enter Client ID: ")
-	if _, err := fmt.Scanln(&clientID); err != nil {
-		return fmt.Errorf("failed to read client ID: %w", err)
+	// The passphrase is asked for before the wizard takes over the screen
+	cfg := config.NewConfig()
+	if config.Exists() {
+		var err error
+		if cfg, err = cmd.LoadConfig(); err != nil {
+			return err
+		}
+	} else if err := cmd.UnlockConfig(cfg); err != nil {
+		return err
 	}
 
-	fmt.Print("Enter Client Secret: ")
-	if _, err := fmt.Scanln(&clientSecret); err != nil {
-		return fmt.Errorf("failed to read client secret: %w", err)
+	prefs, err := config.LoadPreferences(cfg)
+	if err != nil {
+		return err
 	}
 
-	if clientID == "" || clientSecret == "" {
-		return fmt.Errorf("client ID and secret are required")
+	wizard := ui.NewSetupWizard(ctx, cfg, prefs, loginMode)
+	if _, err := tea.NewProgram(wizard, tea.WithAltScreen()).Run(); err != nil {
+		return err
 	}
-
-	fmt.Println()
-	fmt.Println("🔐 Starting OAuth authentication...")
-
-	// Perform OAuth flow
-	oauthFlow := auth.NewOAuthFlow(clientID, clientSecret)
-	token, err := oauthFlow.Authenticate(ctx)
-	if err != nil {
-		return fmt.Errorf("OAuth authentication failed: %w", err)
+	if wizard.Cancelled() || wizard.Account() == nil {
+		return errors.New("setup cancelled")
 	}
-
-	fmt.Println("✅ Authentication successful!")
-
-	// Create and save configuration
-	cfg := config.NewConfig()
-	cfg.OAuth.ClientID = clientID
-	cfg.OAuth.ClientSecret = clientSecret
-	cfg.OAuth.Token = token
-
 	if err := cfg.Save(); err != nil {
 		return fmt.Errorf("failed to save configuration: %w", err)
 	}
-
-	// Test the connection
-	fmt.Println("🧪 Testing Gmail API connection...")
-	emailClient, err := email.NewClient(ctx, token, clientID, clientSecret)
-	if err != nil {
-		return fmt.Errorf("failed to create email client: %w", err)
-	}
-
-	if err := emailClient.TestConnection(ctx); err != nil {
-		return fmt.Errorf("Gmail API connection test failed: %w", err)
+	if err := prefs.Save(); err != nil {
+		return err
 	}
 
-	// Update config with user email
-	cfg.UserEmail = emailClient.GetUserEmail()
-	if err := cfg.Save(); err != nil {
-		return fmt.Errorf("failed to save user email: %w", err)
-	}
-
-	fmt.Printf("✅ Setup complete! Connected as: %s\n", emailClient.GetUserEmail())
+	fmt.Printf("✅ Setup complete! Connected as: %s\n", wizard.Account().UserEmail)
 	fmt.Println()
 	fmt.Println("🚀 Starting Terminal Email Client...")
 	fmt.Println()
@@ -165,10 +182,20 @@ func showUsage() {
 	fmt.Println("Usage:")
 	fmt.Println("  terminal-email-client          # Start the client")
 	fmt.Println("  terminal-email-client --help   # Show this help")
-	fmt.Println("  terminal-email-client --setup  # Re-run setup")
+	fmt.Println("  terminal-email-client --setup  # Add another account with the setup wizard")
+	fmt.Println("  terminal-email-client --config PATH  # Use another config file")
+	fmt.Println("  terminal-email-client --login=manual  # Log in by pasting the redirect URL, for SSH")
+	fmt.Println("  terminal-email-client --login=device  # Log in with a code entered on another device")
+	fmt.Println()
+	fmt.Println("Commands:")
+	for _, command := range cmd.Commands() {
+		fmt.Printf("  %-14s %s\n", command.Name, command.Short)
+		fmt.Printf("  %-14s vimail %s\n", "", command.Usage)
+	}
 	fmt.Println()
 	fmt.Println("First time setup:")
-	fmt.Println("  1. Run the application")
+	fmt.Println("  1. Run the application, or `vimail setup --credentials credentials.json`")
+	fmt.Println("     with the OAuth client downloaded from the Google Cloud console")
 	fmt.Println("  2. Follow OAuth setup instructions")
 	fmt.Println("  3. Authenticate with your Google account")
 	fmt.Println()
@@ -176,28 +203,78 @@ func showUsage() {
 	fmt.Println("  ↑/↓ or j/k    Navigate message list")
 	fmt.Println("  Enter         Read selected message")
 	fmt.Println("  c             Compose new message")
+	fmt.Println("  s             Save message to the download directory")
 	fmt.Println("  r             Reply to message")
+	fmt.Println("  f             Forward message")
+	fmt.Println("  u             Undo send during the send delay")
+	fmt.Println("  o             Outbox: scheduled and queued messages")
+	fmt.Println("  a             Switch account, or open the unified inbox")
+	fmt.Println("  Tab           Next account's inbox")
 	fmt.Println("  q             Quit application")
 	fmt.Println("  Esc           Go back/cancel")
 	fmt.Println()
 	fmt.Println("Configuration:")
-	fmt.Println("  Config file: ~/.terminal-email/config.json")
+	fmt.Println("  Config file: $XDG_CONFIG_HOME/vimail/config.json (~/.config/vimail/config.json)")
+	fmt.Println("               or the file given with --config PATH or VIMAIL_CONFIG")
+	fmt.Println("  Preferences: preferences.json next to the config file: page_size, date_format,")
+	fmt.Println("               time_zone, theme, keymap, wrap_width, download_dir, send_delay")
+	fmt.Println("  Credentials: secrets.json next to the config file, encrypted with a passphrase")
+	fmt.Println("  Contacts and outbox: $XDG_DATA_HOME/vimail (~/.local/share/vimail)")
+	fmt.Println("  Set VIMAIL_PASSPHRASE or run `vimail secrets agent` to avoid the prompt")
+	fmt.Println("  Edits to the keymap, theme and signatures apply while running, or on SIGHUP")
 	fmt.Println()
 }
 
+// loginMode is how the first-run setup logs in, set with --login=MODE
+var loginMode = auth.ModeAuto
+
+// forceSetup runs the setup wizard to add another account, set with
+// --setup
+var forceSetup bool
+
+// args are the command line arguments without --config PATH
+var args []string
+
 func init() {
+	// --config may come anywhere, also after a subcommand
+	var path string
+	for i := 1; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		if value, ok := strings.CutPrefix(arg, "--config="); ok {
+			path = value
+			continue
+		}
+		if arg == "--config" {
+			if i+1 == len(os.Args) {
+				log.Fatal("--config needs a path")
+			}
+			i++
+			path = os.Args[i]
+			continue
+		}
+		args = append(args, arg)
+	}
+	if path != "" {
+		if err := config.SetConfigPath(path); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	// Check for help flag
-	for _, arg := range os.Args[1:] {
+	for _, arg := range args {
+		if value, ok := strings.CutPrefix(arg, "--login="); ok {
+			mode, err := auth.ParseMode(value)
+			if err != nil {
+				log.Fatal(err)
+			}
+			loginMode = mode
+		}
 		if arg == "--help" || arg == "-h" {
 			showUsage()
 			os.Exit(0)
 		}
 		if arg == "--setup" {
-			// Force re-setup by removing config
-			configPath, err := config.GetConfigPath()
-			if err == nil {
-				os.Remove(configPath)
-			}
+			forceSetup = true
 		}
 	}
 }